@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// OracleMaxInListSize - maximum number of expressions allowed by Oracle in an IN list
+const OracleMaxInListSize int = 1000
+
+// DefaultBatchSize - batch size used when none is given
+const DefaultBatchSize int = 500
+
+// BatchProgress - progress callback; done keys were processed out of total
+type BatchProgress func(done int, total int)
+
+// DeleteByKeys - deletes the rows of table whose keyCol is in keys (a slice),
+// in batches of batchSize keys, in a single transaction.
+// progress may be nil. Returns the number of deleted rows
+func (u *DbUtils) DeleteByKeys(table string, keyCol string, keys interface{}, batchSize int, progress BatchProgress) (int64, error) {
+	if !identRegexp.MatchString(table) {
+		return 0, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%%s)", table, keyCol)
+
+	return u.execByKeys(query, nil, keyCol, keys, batchSize, progress)
+}
+
+// UpdateByKeys - sets the values in set (column name -> value) for the rows of table
+// whose keyCol is in keys (a slice), in batches of batchSize keys, in a single transaction.
+// progress may be nil. Returns the number of updated rows
+func (u *DbUtils) UpdateByKeys(table string, set map[string]interface{}, keyCol string, keys interface{}, batchSize int, progress BatchProgress) (int64, error) {
+	if !identRegexp.MatchString(table) {
+		return 0, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	if len(set) == 0 {
+		return 0, errors.New("no columns to update")
+	}
+
+	cols := make([]string, 0, len(set))
+	for col := range set {
+		if !identRegexp.MatchString(col) {
+			return 0, fmt.Errorf("invalid column name: %s", col)
+		}
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	assignments := make([]string, len(cols))
+	setArgs := make([]interface{}, len(cols))
+	for i, col := range cols {
+		assignments[i] = col + " = ?"
+		setArgs[i] = set[col]
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s IN (%%s)", table, strings.Join(assignments, ", "), keyCol)
+
+	return u.execByKeys(query, setArgs, keyCol, keys, batchSize, progress)
+}
+
+func (u *DbUtils) execByKeys(query string, args []interface{}, keyCol string, keys interface{}, batchSize int, progress BatchProgress) (int64, error) {
+	if !identRegexp.MatchString(keyCol) {
+		return 0, fmt.Errorf("invalid column name: %s", keyCol)
+	}
+
+	keyArgs, err := sliceToArgs(keys)
+	if err != nil {
+		return 0, err
+	}
+
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	if batchSize > OracleMaxInListSize {
+		switch u.dbType {
+		case Oracle, Oracle11g, Oci8:
+			batchSize = OracleMaxInListSize
+		}
+	}
+
+	total := len(keyArgs)
+	if total == 0 {
+		return 0, nil
+	}
+
+	tx, err := u.BeginTransaction()
+	if err != nil {
+		return 0, err
+	}
+	defer u.Rollback(tx)
+
+	var affected int64
+
+	for start := 0; start < total; start += batchSize {
+		end := start + batchSize
+		if end > total {
+			end = total
+		}
+
+		batch := keyArgs[start:end]
+		params := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+
+		batchArgs := make([]interface{}, 0, len(args)+len(batch))
+		batchArgs = append(batchArgs, args...)
+		batchArgs = append(batchArgs, batch...)
+
+		pq := u.PQuery(fmt.Sprintf(query, params), batchArgs...)
+
+		res, err := u.ExecTx(tx, pq)
+		if err != nil {
+			return 0, err
+		}
+
+		n, err := res.RowsAffected()
+		if err == nil {
+			affected += n
+		}
+
+		if progress != nil {
+			progress(end, total)
+		}
+	}
+
+	if err := u.Commit(tx); err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// sliceToArgs - converts a slice (or array) of any type into a slice of query arguments
+func sliceToArgs(slice interface{}) ([]interface{}, error) {
+	if args, ok := slice.([]interface{}); ok {
+		return args, nil
+	}
+
+	v := reflect.ValueOf(slice)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a slice, got %T", slice)
+	}
+
+	n := v.Len()
+	args := make([]interface{}, n)
+	for i := 0; i < n; i++ {
+		args[i] = v.Index(i).Interface()
+	}
+
+	return args, nil
+}
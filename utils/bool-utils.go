@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+var (
+	boolType    = reflect.TypeOf(false)
+	boolPtrType = reflect.TypeOf(new(bool))
+)
+
+// boolFromDriver - reads a flag column: SQL Server BIT, MySQL tinyint(1), Oracle NUMBER(1) / CHAR(1)
+// (1 / 0, Y / N) and Postgres boolean
+func boolFromDriver(src interface{}) (bool, error) {
+	switch v := src.(type) {
+	case bool:
+		return v, nil
+	case int64:
+		return v != 0, nil
+	case float64:
+		return v != 0, nil
+	case []byte:
+		return parseSQLBool(string(v))
+	case string:
+		return parseSQLBool(v)
+	}
+
+	return false, fmt.Errorf("can't read %T as a bool", src)
+}
+
+func parseSQLBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "t", "true", "y", "yes", "on":
+		return true, nil
+	case "0", "f", "false", "n", "no", "off":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("can't read %q as a bool", s)
+}
+
+// boolConverter - returns the scan converter of bool and *bool fields, nil for other fields
+func boolConverter(fieldType reflect.Type) ConverterFunc {
+	if fieldType != boolType && fieldType != boolPtrType {
+		return nil
+	}
+
+	return func(src interface{}) (interface{}, error) {
+		if src == nil {
+			return nil, nil
+		}
+
+		b, err := boolFromDriver(src)
+		if err != nil {
+			return nil, err
+		}
+
+		if fieldType == boolPtrType {
+			return &b, nil
+		}
+
+		return b, nil
+	}
+}
+
+// bindBools - binds the bool args as 1 / 0, except in Postgres which has a boolean type
+func (pq *PreparedQuery) bindBools() {
+	if pq.DbType == Postgres {
+		return
+	}
+
+	for i, arg := range pq.Args {
+		var b bool
+
+		switch v := arg.(type) {
+		case bool:
+			b = v
+		case *bool:
+			if v == nil {
+				continue
+			}
+			b = *v
+		default:
+			continue
+		}
+
+		if b {
+			pq.Args[i] = int64(1)
+		} else {
+			pq.Args[i] = int64(0)
+		}
+	}
+}
@@ -1,34 +1,34 @@
-package utils
-
-import (
-	"errors"
-	"io"
-	"io/ioutil"
-)
-
-type unbufferedReaderAt struct {
-	R io.Reader
-	N int64
-}
-
-// NewUnbufferedReaderAt io.Reader to io.ReaderAt helper
-func NewUnbufferedReaderAt(r io.Reader) io.ReaderAt {
-	return &unbufferedReaderAt{R: r}
-}
-
-func (u *unbufferedReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
-	if off < u.N {
-		return 0, errors.New("invalid offset")
-	}
-
-	diff := off - u.N
-	written, err := io.CopyN(ioutil.Discard, u.R, diff)
-	u.N += written
-	if err != nil {
-		return 0, err
-	}
-
-	n, err = u.R.Read(p)
-	u.N += int64(n)
-	return
-}
+package utils
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+)
+
+type unbufferedReaderAt struct {
+	R io.Reader
+	N int64
+}
+
+// NewUnbufferedReaderAt io.Reader to io.ReaderAt helper
+func NewUnbufferedReaderAt(r io.Reader) io.ReaderAt {
+	return &unbufferedReaderAt{R: r}
+}
+
+func (u *unbufferedReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < u.N {
+		return 0, errors.New("invalid offset")
+	}
+
+	diff := off - u.N
+	written, err := io.CopyN(ioutil.Discard, u.R, diff)
+	u.N += written
+	if err != nil {
+		return 0, err
+	}
+
+	n, err = u.R.Read(p)
+	u.N += int64(n)
+	return
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+const (
+	// BundleManifestName - name of the manifest entry in a bundle
+	BundleManifestName string = "manifest.json"
+	// BundleSignatureName - name of the entry holding the hex HMAC-SHA256 of the manifest
+	BundleSignatureName string = "manifest.sig"
+)
+
+// ErrBundleSignature - the manifest signature doesn't match
+var ErrBundleSignature = errors.New("invalid bundle signature")
+
+// BundleManifest - lists the bundle files and their hex SHA-256 digests
+type BundleManifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// Bundle - verified runtime bundle (configuration, SQL query files, templates) shipped as a zip.
+// Bundle implements fs.FS
+type Bundle struct {
+	r *zip.Reader
+}
+
+// LoadBundle - opens and verifies the bundle at path with the HMAC key
+func LoadBundle(path string, key []byte) (*Bundle, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBundle(content, key)
+}
+
+// NewBundle - opens and verifies an in memory bundle with the HMAC key.
+// The manifest signature must match and every entry must be listed in the
+// manifest with its SHA-256 digest
+func NewBundle(content []byte, key []byte) (*Bundle, error) {
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	manifestData, err := readZipFile(r, BundleManifestName)
+	if err != nil {
+		return nil, fmt.Errorf("bundle manifest: %v", err)
+	}
+
+	sig, err := readZipFile(r, BundleSignatureName)
+	if err != nil {
+		return nil, fmt.Errorf("bundle signature: %v", err)
+	}
+
+	expected, err := hex.DecodeString(strings.TrimSpace(string(sig)))
+	if err != nil {
+		return nil, ErrBundleSignature
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(manifestData)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, ErrBundleSignature
+	}
+
+	var manifest BundleManifest
+	err = json.Unmarshal(manifestData, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("bundle manifest: %v", err)
+	}
+
+	for _, f := range r.File {
+		if f.Name == BundleManifestName || f.Name == BundleSignatureName || f.FileInfo().IsDir() {
+			continue
+		}
+
+		digest, ok := manifest.Files[f.Name]
+		if !ok {
+			return nil, fmt.Errorf("bundle entry %s is not in the manifest", f.Name)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), digest) {
+			return nil, fmt.Errorf("bundle entry %s digest mismatch", f.Name)
+		}
+
+		delete(manifest.Files, f.Name)
+	}
+
+	if len(manifest.Files) > 0 {
+		missing := make([]string, 0, len(manifest.Files))
+		for name := range manifest.Files {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+
+		return nil, fmt.Errorf("bundle entries missing: %s", strings.Join(missing, ", "))
+	}
+
+	return &Bundle{r: r}, nil
+}
+
+// Open - opens a bundle file (fs.FS)
+func (b *Bundle) Open(name string) (fs.File, error) {
+	return b.r.Open(name)
+}
+
+// ReadFile - returns the content of a bundle file
+func (b *Bundle) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(b.r, name)
+}
+
+// LoadConfig - decodes the JSON configuration file name into v
+func (b *Bundle) LoadConfig(name string, v interface{}) error {
+	content, err := b.ReadFile(name)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, v)
+}
+
+// Queries - loads the SQL files matching pattern (ex: "queries/*.sql") into a QueryStore
+func (b *Bundle) Queries(pattern string) (*QueryStore, error) {
+	return NewQueryStoreFromFS(b, pattern)
+}
+
+// Templates - parses the template files matching patterns
+func (b *Bundle) Templates(patterns ...string) (*template.Template, error) {
+	return template.ParseFS(b, patterns...)
+}
+
+func readZipFile(r *zip.Reader, name string) ([]byte, error) {
+	f, err := r.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ioutil.ReadAll(f)
+}
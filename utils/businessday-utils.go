@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// HolidayCalendar - tells the non working days besides the weekends (Saturday and Sunday)
+type HolidayCalendar interface {
+	IsHoliday(day time.Time) bool
+}
+
+// Holidays - HolidayCalendar of fixed dates.
+// A nil *Holidays is an empty calendar (Add does nothing), the zero value is ready to use
+type Holidays struct {
+	mux  sync.RWMutex
+	days map[string]string
+}
+
+// Holiday - a date (ISODate) and its name, as loaded by LoadHolidaysJSON
+type Holiday struct {
+	Date string `json:"date"`
+	Name string `json:"name"`
+}
+
+// NewHolidays - instantiates a Holidays calendar with days
+func NewHolidays(days ...time.Time) *Holidays {
+	h := &Holidays{days: make(map[string]string)}
+
+	for _, day := range days {
+		h.Add(day, "")
+	}
+
+	return h
+}
+
+// LoadHolidaysJSON - loads a Holidays calendar from a JSON file holding either
+// a list of dates (["2021-12-25", ...]) or a list of Holiday ([{"date": "2021-12-25", "name": "Christmas"}, ...])
+func LoadHolidaysJSON(path string) (*Holidays, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(b, &items); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	h := NewHolidays()
+
+	for _, item := range items {
+		var hd Holiday
+
+		if err := json.Unmarshal(item, &hd.Date); err != nil {
+			if err := json.Unmarshal(item, &hd); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+
+		day, err := String2date(hd.Date, UTCDate)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		h.Add(day, hd.Name)
+	}
+
+	return h, nil
+}
+
+// LoadHolidays - loads a Holidays calendar from the date column of table
+func (u *DbUtils) LoadHolidays(table, dateColumn string) (*Holidays, error) {
+	if !identRegexp.MatchString(table) || !identRegexp.MatchString(dateColumn) {
+		return nil, fmt.Errorf("invalid table or column name: %s.%s", table, dateColumn)
+	}
+
+	var days []time.Time
+	pq := u.PQuery("SELECT " + dateColumn + " FROM " + table)
+
+	if err := u.RunQueryIntoSlice(pq, &days); err != nil {
+		return nil, err
+	}
+
+	return NewHolidays(days...), nil
+}
+
+// Add - adds the date of day (in its location) as a holiday
+func (h *Holidays) Add(day time.Time, name string) {
+	if h == nil {
+		return
+	}
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if h.days == nil {
+		h.days = make(map[string]string)
+	}
+
+	h.days[day.Format(ISODate)] = name
+}
+
+// Name - returns the name of the holiday on the date of day
+func (h *Holidays) Name(day time.Time) string {
+	if h == nil {
+		return ""
+	}
+
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+
+	return h.days[day.Format(ISODate)]
+}
+
+// IsHoliday - checks if the date of day (in its location) is a holiday
+func (h *Holidays) IsHoliday(day time.Time) bool {
+	if h == nil {
+		return false
+	}
+
+	h.mux.RLock()
+	defer h.mux.RUnlock()
+
+	_, ok := h.days[day.Format(ISODate)]
+	return ok
+}
+
+// IsBusinessDay - checks if the date of t is neither a weekend day nor a holiday of cal (may be nil)
+func IsBusinessDay(t time.Time, cal HolidayCalendar) bool {
+	if t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		return false
+	}
+
+	return cal == nil || !cal.IsHoliday(t)
+}
+
+// AddBusinessDays - moves t by n business days (back for n < 0), keeping its time of day
+func AddBusinessDays(t time.Time, n int, cal HolidayCalendar) time.Time {
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+
+	for n > 0 {
+		t = t.AddDate(0, 0, step)
+		if IsBusinessDay(t, cal) {
+			n--
+		}
+	}
+
+	return t
+}
+
+// BusinessDaysBetween - returns the number of business days after the date of from, up to and
+// including the date of to (negative if to is before from), so AddBusinessDays(from, n) is n days away
+func BusinessDaysBetween(from, to time.Time, cal HolidayCalendar) int {
+	sign := 1
+	if to.Before(from) {
+		from, to = to, from
+		sign = -1
+	}
+
+	loc := from.Location()
+	day := StartOfDay(from)
+	last := StartOfDay(to.In(loc))
+
+	n := 0
+	for day.Before(last) {
+		day = day.AddDate(0, 0, 1)
+		if IsBusinessDay(day, cal) {
+			n++
+		}
+	}
+
+	return sign * n
+}
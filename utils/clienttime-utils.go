@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientTimeResolver - resolves the time zone of the client making a request, used by
+// Server2ClientLocal, Server2ClientDmy and Server2ClientDmyTime.
+// A nil location (with a nil error) means the resolver does not know the zone of the client
+type ClientTimeResolver interface {
+	ClientLocation(r *http.Request) (*time.Location, error)
+}
+
+// ClientTimeResolverFunc - adapts a function to the ClientTimeResolver interface
+type ClientTimeResolverFunc func(r *http.Request) (*time.Location, error)
+
+// ClientLocation - calls f(r)
+func (f ClientTimeResolverFunc) ClientLocation(r *http.Request) (*time.Location, error) {
+	return f(r)
+}
+
+// ChainResolvers - returns a resolver trying resolvers in order, until one finds the zone.
+// An error stops the chain
+func ChainResolvers(resolvers ...ClientTimeResolver) ClientTimeResolver {
+	return ClientTimeResolverFunc(func(r *http.Request) (*time.Location, error) {
+		for _, res := range resolvers {
+			loc, err := res.ClientLocation(r)
+			if err != nil || loc != nil {
+				return loc, err
+			}
+		}
+
+		return nil, nil
+	})
+}
+
+// ZoneSourcesResolver - resolves the zone with the client zone sources (see SetClientZoneSources)
+func ZoneSourcesResolver() ClientTimeResolver {
+	return ClientTimeResolverFunc(func(r *http.Request) (*time.Location, error) {
+		loc, _ := ClientLocation(r)
+		return loc, nil
+	})
+}
+
+// OffsetCookieResolver - resolves the zone from a cookie holding the offset of the client in minutes,
+// as returned by the javascript Date.getTimezoneOffset (-120 for UTC+2).
+// The offset is a fixed zone, so it is wrong for the dates across a DST change
+func OffsetCookieResolver(name string) ClientTimeResolver {
+	return ClientTimeResolverFunc(func(r *http.Request) (*time.Location, error) {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return nil, nil
+		}
+
+		offset := String2int(strings.TrimSpace(cookie.Value))
+		return time.FixedZone("", -offset*60), nil
+	})
+}
+
+var (
+	clientTimeResolverMux sync.RWMutex
+	clientTimeResolver    = ChainResolvers(ZoneSourcesResolver(), OffsetCookieResolver("time_zone_offset"))
+)
+
+// SetClientTimeResolver - sets the resolver of the client zone used by the Server2Client helpers.
+// Defaults to the client zone sources, then the time_zone_offset cookie; nil restores the default.
+// When the zone is not found (or the resolver fails) the helpers use UTC
+func SetClientTimeResolver(res ClientTimeResolver) {
+	if res == nil {
+		res = ChainResolvers(ZoneSourcesResolver(), OffsetCookieResolver("time_zone_offset"))
+	}
+
+	clientTimeResolverMux.Lock()
+	defer clientTimeResolverMux.Unlock()
+
+	clientTimeResolver = res
+}
+
+// GetClientTimeResolver - returns the resolver of the client zone used by the Server2Client helpers
+func GetClientTimeResolver() ClientTimeResolver {
+	clientTimeResolverMux.RLock()
+	defer clientTimeResolverMux.RUnlock()
+
+	return clientTimeResolver
+}
+
+// ProfileZoneResolver - resolves the zone of the logged in user from a user profile table.
+// The zones read are cached per user (see SetCacheTTL)
+type ProfileZoneResolver struct {
+	dbutl  *DbUtils
+	query  string
+	userID func(r *http.Request) (interface{}, bool)
+	err    error
+
+	mux   sync.Mutex
+	ttl   time.Duration
+	cache map[string]profileZone
+}
+
+type profileZone struct {
+	loc     *time.Location
+	expires time.Time
+}
+
+// NewProfileZoneResolver - returns a resolver reading the IANA zone name from zoneColumn of the row
+// of table where userColumn is the id returned by userID (ex: from the session).
+// Requests without a user id, users without a row and NULL / empty zones are not resolved.
+// The zones are cached for 5 minutes
+func (u *DbUtils) NewProfileZoneResolver(table, userColumn, zoneColumn string, userID func(r *http.Request) (interface{}, bool)) *ProfileZoneResolver {
+	p := &ProfileZoneResolver{
+		dbutl:  u,
+		userID: userID,
+		ttl:    5 * time.Minute,
+		cache:  make(map[string]profileZone),
+	}
+
+	if !identRegexp.MatchString(table) || !identRegexp.MatchString(userColumn) || !identRegexp.MatchString(zoneColumn) {
+		p.err = fmt.Errorf("invalid table or column name: %s (%s, %s)", table, userColumn, zoneColumn)
+		return p
+	}
+
+	p.query = "SELECT " + zoneColumn + " FROM " + table + " WHERE " + userColumn + " = ?"
+
+	return p
+}
+
+// SetCacheTTL - sets for how long the zone of a user is cached, 0 disables the cache
+func (p *ProfileZoneResolver) SetCacheTTL(ttl time.Duration) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	p.ttl = ttl
+	p.cache = make(map[string]profileZone)
+}
+
+// Forget - removes the cached zone of user id (ex: after the user changed it)
+func (p *ProfileZoneResolver) Forget(id interface{}) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	delete(p.cache, profileCacheKey(id))
+}
+
+// profileCacheKey - the cache key of user id. The id returned by userID may not be
+// comparable (ex: a []byte session id), so it can't be a map key itself
+func profileCacheKey(id interface{}) string {
+	return fmt.Sprintf("%T:%v", id, id)
+}
+
+// ClientLocation implements the ClientTimeResolver interface.
+func (p *ProfileZoneResolver) ClientLocation(r *http.Request) (*time.Location, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	id, ok := p.userID(r)
+	if !ok || id == nil {
+		return nil, nil
+	}
+
+	now := Now()
+	key := profileCacheKey(id)
+
+	p.mux.Lock()
+	cached, found := p.cache[key]
+	p.mux.Unlock()
+
+	if found && now.Before(cached.expires) {
+		return cached.loc, nil
+	}
+
+	var zones []sql.NullString
+	if err := p.dbutl.RunQueryIntoSlice(p.dbutl.PQuery(p.query, id), &zones); err != nil {
+		return nil, err
+	}
+
+	var loc *time.Location
+	if len(zones) > 0 && zones[0].Valid && strings.TrimSpace(zones[0].String) != "" {
+		l, err := LoadLocation(strings.TrimSpace(zones[0].String))
+		if err != nil {
+			return nil, fmt.Errorf("time zone of user %v: %w", id, err)
+		}
+		loc = l
+	}
+
+	p.mux.Lock()
+	if p.ttl > 0 {
+		p.cache[key] = profileZone{loc: loc, expires: now.Add(p.ttl)}
+	}
+	p.mux.Unlock()
+
+	return loc, nil
+}
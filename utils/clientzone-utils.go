@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ClientZoneSource - reads the IANA time zone name of the client ("Europe/Bucharest") from a request,
+// "" if not found
+type ClientZoneSource func(r *http.Request) string
+
+// ZoneFromCookie - reads the zone from the cookie name
+func ZoneFromCookie(name string) ClientZoneSource {
+	return func(r *http.Request) string {
+		cookie, err := r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// ZoneFromHeader - reads the zone from the header name
+func ZoneFromHeader(name string) ClientZoneSource {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// ZoneFromQuery - reads the zone from the query parameter name
+func ZoneFromQuery(name string) ClientZoneSource {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+type clientZoneKeyType struct{}
+
+// WithClientZone - returns a context carrying the zone of the client (set by a middleware,
+// from the session or the user profile), read by ZoneFromContext
+func WithClientZone(ctx context.Context, zone string) context.Context {
+	return context.WithValue(ctx, clientZoneKeyType{}, zone)
+}
+
+// ZoneFromContext - reads the zone set on the request context with WithClientZone
+func ZoneFromContext() ClientZoneSource {
+	return func(r *http.Request) string {
+		zone, _ := r.Context().Value(clientZoneKeyType{}).(string)
+		return zone
+	}
+}
+
+var (
+	clientZoneMux     sync.RWMutex
+	clientZoneSources = []ClientZoneSource{
+		ZoneFromContext(),
+		ZoneFromCookie("time_zone"),
+		ZoneFromHeader("Time-Zone"),
+	}
+)
+
+// SetClientZoneSources - sets the sources of the client zone, tried in order by ClientLocation.
+// Defaults to the request context, the time_zone cookie and the Time-Zone header
+func SetClientZoneSources(sources ...ClientZoneSource) {
+	clientZoneMux.Lock()
+	defer clientZoneMux.Unlock()
+
+	clientZoneSources = sources
+}
+
+// ClientLocation - returns the location of the first valid IANA zone name found by the client zone sources
+func ClientLocation(r *http.Request) (*time.Location, bool) {
+	clientZoneMux.RLock()
+	sources := clientZoneSources
+	clientZoneMux.RUnlock()
+
+	for _, source := range sources {
+		zone := strings.TrimSpace(source(r))
+		if zone == "" {
+			continue
+		}
+
+		loc, err := LoadLocation(zone)
+		if err == nil {
+			return loc, true
+		}
+	}
+
+	return nil, false
+}
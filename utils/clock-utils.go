@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock - source of the current time. The package reads the time through the clock set
+// with SetClock (AuditLog timestamps, Trace / Un, date helpers), so tests of code built on
+// this package can freeze or advance it with a MockClock
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+
+// SystemClock - the real clock, used by default
+var SystemClock Clock = systemClock{}
+
+var (
+	clockMux sync.RWMutex
+	clock    = SystemClock
+)
+
+// SetClock - sets the clock used by the package. nil restores SystemClock
+func SetClock(c Clock) {
+	if c == nil {
+		c = SystemClock
+	}
+
+	clockMux.Lock()
+	clock = c
+	clockMux.Unlock()
+}
+
+// GetClock - returns the clock used by the package
+func GetClock() Clock {
+	clockMux.RLock()
+	defer clockMux.RUnlock()
+
+	return clock
+}
+
+// Now - returns the current time of the package clock
+func Now() time.Time {
+	return GetClock().Now()
+}
+
+// MockClock - clock whose time only changes with Set and Advance.
+// After channels fire (and Sleep calls return) when the time reaches their deadline
+type MockClock struct {
+	mux     sync.Mutex
+	now     time.Time
+	waiters []mockWaiter
+}
+
+type mockWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewMockClock - instantiates a MockClock frozen at now
+func NewMockClock(now time.Time) *MockClock {
+	return &MockClock{now: now}
+}
+
+// Now - returns the time of the clock
+func (c *MockClock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.now
+}
+
+// After - returns a channel receiving the time of the clock once it is advanced by d
+func (c *MockClock) After(d time.Duration) <-chan time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	ch := make(chan time.Time, 1)
+
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+
+	c.waiters = append(c.waiters, mockWaiter{deadline: c.now.Add(d), ch: ch})
+
+	return ch
+}
+
+// Sleep - blocks until the clock is advanced by d
+func (c *MockClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Advance - moves the clock forward by d, firing the due After channels
+func (c *MockClock) Advance(d time.Duration) {
+	c.mux.Lock()
+	now := c.now.Add(d)
+	c.mux.Unlock()
+
+	c.Set(now)
+}
+
+// Set - sets the time of the clock, firing the due After channels in deadline order
+func (c *MockClock) Set(now time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.now = now
+
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+
+	pending := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(now) {
+			pending = append(pending, w)
+			continue
+		}
+
+		w.ch <- now
+	}
+
+	c.waiters = pending
+}
+
+// Waiters - returns the number of After channels (and Sleep calls) waiting for the clock,
+// so a test can wait for a goroutine to block before advancing the clock
+func (c *MockClock) Waiters() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return len(c.waiters)
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ConverterFunc - converts a driver value (nil for NULL) into the value of a struct field
+type ConverterFunc func(src interface{}) (interface{}, error)
+
+var (
+	converterMux sync.RWMutex
+	converters   = make(map[reflect.Type]ConverterFunc)
+)
+
+// RegisterConverter - registers the converter used by SQLScan for the fields of type fieldType
+// (money types, enums, encrypted columns, etc). The returned value must be assignable or
+// convertible to fieldType; nil leaves the field at its zero value.
+// The SQLScan helpers already in use apply it from the next row they scan.
+//
+//	utils.RegisterConverter(reflect.TypeOf(Money{}), func(src interface{}) (interface{}, error) {
+//		return ParseMoney(fmt.Sprint(src))
+//	})
+func RegisterConverter(fieldType reflect.Type, conv ConverterFunc) {
+	converterMux.Lock()
+	converters[fieldType] = conv
+	converterMux.Unlock()
+
+	// the cached scan plans don't know about the new converter
+	resetScanPlans()
+}
+
+func getConverter(fieldType reflect.Type) ConverterFunc {
+	converterMux.RLock()
+	defer converterMux.RUnlock()
+
+	return converters[fieldType]
+}
+
+// setConverted - sets field to the value returned by conv for src
+func setConverted(field reflect.Value, conv ConverterFunc, src interface{}) error {
+	// the driver may reuse the memory of []byte values
+	if b, ok := src.([]byte); ok {
+		src = append([]byte(nil), b...)
+	}
+
+	val, err := conv(src)
+	if err != nil {
+		return err
+	}
+
+	if val == nil {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	v := reflect.ValueOf(val)
+
+	switch {
+	case v.Type().AssignableTo(field.Type()):
+		field.Set(v)
+	case v.Type().ConvertibleTo(field.Type()):
+		field.Set(v.Convert(field.Type()))
+	default:
+		return fmt.Errorf("converter returned %s, not assignable to %s", v.Type(), field.Type())
+	}
+
+	return nil
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// bindValuers - args implementing driver.Valuer with a pointer receiver are passed by pointer,
+// so database/sql calls their Value method. Valuer args are not changed by the other rewrites
+func (pq *PreparedQuery) bindValuers() {
+	for i, arg := range pq.Args {
+		if arg == nil {
+			continue
+		}
+
+		if _, ok := arg.(driver.Valuer); ok {
+			continue
+		}
+
+		t := reflect.TypeOf(arg)
+		if t.Kind() == reflect.Ptr || !reflect.PtrTo(t).Implements(valuerType) {
+			continue
+		}
+
+		p := reflect.New(t)
+		p.Elem().Set(reflect.ValueOf(arg))
+		pq.Args[i] = p.Interface()
+	}
+}
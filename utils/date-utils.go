@@ -1,217 +1,475 @@
-package utils
-
-import (
-	"net/http"
-	"strings"
-	"time"
-)
-
-const (
-	// ISODate - iso date format
-	ISODate string = "2006-01-02"
-	// ISODateTime - iso date time format
-	ISODateTime string = "2006-01-02 15:04:05"
-	// ISODateTimestamp - iso timestamp format
-	ISODateTimestamp string = "2006-01-02 15:04:05.000"
-	// ISODateTimeZ - iso datetime with timezone format
-	ISODateTimeZ string = "2006-01-02 15:04:05Z07:00"
-	// ISODateTimestampZ - iso timestamp with timezone format
-	ISODateTimestampZ string = "2006-01-02 15:04:05.000Z07:00"
-	// ISOTime - iso time format
-	ISOTime string = "15:04:05"
-	// ISOTimeMS - iso time format with miliseconds
-	ISOTimeMS string = "15:04:05.000"
-	// DMY - dd/MM/yyyy
-	DMY string = "02/01/2006"
-	// DMYTime - dd/MM/yyyy HH:m:ss
-	DMYTime string = "02/01/2006 15:04:05"
-	// UTCDate - date at midnight UTC
-	UTCDate string = "UTCDate"
-	// UTCDateTime - ISODateTime at UTC
-	UTCDateTime string = "UTC"
-	// UTCDateTimestamp - ISODateTimestamp at UTC
-	UTCDateTimestamp string = "UTCTimestamp"
-	// DateOffset - time zone offset
-	DateOffset string = "Z07:00"
-	// RSSDateTime - rss date time format
-	RSSDateTime string = "Mon, 02 Jan 2006 15:04:05 Z07:00"
-	// RSSDateTime1 - rss date time format 1
-	RSSDateTime1 string = "Mon, _2 Jan 2006 15:04:05 Z07:00"
-	// RSSDateTime2 - rss date time format 2
-	RSSDateTime2 string = "Mon, 02 Jan 2006 15:04:05 Z0700"
-	// RSSDateTime3 - rss date time format 3
-	RSSDateTime3 string = "Mon, _2 Jan 2006 15:04:05 Z0700"
-	// RSSDateTimeTZ - rss date time format with named timezone
-	RSSDateTimeTZ string = "Mon, 02 Jan 2006 15:04:05 MST"
-	// RSSDateTimeTZ1 - rss date time format with named timezone 1
-	RSSDateTimeTZ1 string = "Mon, _2 Jan 2006 15:04:05 MST"
-)
-
-// IsISODate - checks if is in iso date format
-func IsISODate(sval string) bool {
-	_, err := String2date(sval, ISODate)
-
-	if err != nil {
-		return false
-	}
-
-	return true
-}
-
-// IsISODateTime - checks if is in iso datetime format
-func IsISODateTime(sval string) bool {
-	_, err := String2date(sval, ISODateTime)
-
-	if err != nil {
-		return false
-	}
-
-	return true
-}
-
-// DateFromISODateTime - Date From ISODateTime
-func DateFromISODateTime(sval string) (time.Time, error) {
-	return String2date(sval, ISODateTime)
-}
-
-// Date2string - Date to string
-func Date2string(val time.Time, format string) string {
-	switch format {
-	case UTCDate:
-		return val.UTC().Format(ISODate)
-	case UTCDateTime:
-		return val.UTC().Format(ISODateTimeZ)
-	case UTCDateTimestamp:
-		return val.UTC().Format(ISODateTimestampZ)
-	default:
-		return val.Format(format)
-	}
-}
-
-// String2dateNoErr - String to date NoErrCheck
-func String2dateNoErr(sval string, format string) time.Time {
-	dt, err := String2date(sval, format)
-	if err != nil {
-		panic(err)
-	}
-	return dt
-}
-
-// String2date - String to date
-func String2date(sval string, format string) (time.Time, error) {
-	switch format {
-	case ISODate, ISODateTime, ISODateTimestamp, ISODateTimeZ, ISODateTimestampZ, DMY, DMYTime, DateOffset:
-		loc, err := time.LoadLocation("Local")
-		if err != nil {
-			return time.Now(), err
-		}
-
-		t, err := time.ParseInLocation(format, sval, loc)
-		if err != nil {
-			return time.Now(), err
-		}
-		return t, nil
-	case UTCDate:
-		loc, err := time.LoadLocation("UTC")
-		if err != nil {
-			return time.Now(), err
-		}
-
-		t, err := time.ParseInLocation(ISODate, sval, loc)
-		if err != nil {
-			return time.Now(), err
-		}
-		return t, nil
-	case UTCDateTime:
-		loc, err := time.LoadLocation("UTC")
-		if err != nil {
-			return time.Now(), err
-		}
-
-		t, err := time.ParseInLocation(ISODateTime, sval, loc)
-		if err != nil {
-			return time.Now(), err
-		}
-		return t, nil
-	case UTCDateTimestamp:
-		loc, err := time.LoadLocation("UTC")
-		if err != nil {
-			return time.Now(), err
-		}
-
-		t, err := time.ParseInLocation(ISODateTimestamp, sval, loc)
-		if err != nil {
-			return time.Now(), err
-		}
-		return t, nil
-	default:
-		loc, err := time.LoadLocation("UTC")
-		if err != nil {
-			return time.Now(), err
-		}
-
-		t, err := time.ParseInLocation(format, sval, loc)
-		if err != nil {
-			return time.Now(), err
-		}
-		return t, nil
-	}
-}
-
-// Server2ClientDmy - Server2ClientDmy
-func Server2ClientDmy(r *http.Request, serverTime time.Time) string {
-	t := Server2ClientLocal(r, serverTime)
-	return Date2string(t, DMY)
-}
-
-// Server2ClientDmyTime - Server2ClientDmyTime
-func Server2ClientDmyTime(r *http.Request, serverTime time.Time) string {
-	t := Server2ClientLocal(r, serverTime)
-	return Date2string(t, DMYTime)
-}
-
-// Server2ClientLocal - Server2ClientLocal
-func Server2ClientLocal(r *http.Request, serverTime time.Time) time.Time {
-	timeOffset := 0
-
-	cookie, err := r.Cookie("time_zone_offset")
-	if err != nil && err != http.ErrNoCookie {
-		return serverTime.UTC()
-	} else if err == http.ErrNoCookie {
-		timeOffset = 0
-	} else {
-		timeOffset = String2int(cookie.Value)
-	}
-
-	return serverTime.UTC().Add(time.Duration(-1*timeOffset) * time.Minute)
-}
-
-// ParseRSSDate - try to parse RSS date in multiple formats
-func ParseRSSDate(sdate string) (time.Time, error) {
-	var err error
-	var dt time.Time
-
-	formats := []string{
-		RSSDateTimeTZ,
-		RSSDateTimeTZ1,
-		RSSDateTime,
-		RSSDateTime1,
-		RSSDateTime2,
-		RSSDateTime3,
-		"02 Jan 2006 15:04:05 Z0700",
-		"_2 Jan 2006 15:04:05 Z0700",
-		ISODateTime,
-		ISODateTimeZ,
-	}
-
-	sdt := strings.TrimSpace(sdate)
-
-	for _, format := range formats {
-		dt, err = String2date(sdt, format)
-		if err == nil {
-			break
-		}
-	}
-
-	return dt.UTC(), err
-}
+package utils
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ISODate - iso date format
+	ISODate string = "2006-01-02"
+	// ISODateTime - iso date time format
+	ISODateTime string = "2006-01-02 15:04:05"
+	// ISODateTimestamp - iso timestamp format
+	ISODateTimestamp string = "2006-01-02 15:04:05.000"
+	// ISODateTimeZ - iso datetime with timezone format
+	ISODateTimeZ string = "2006-01-02 15:04:05Z07:00"
+	// ISODateTimestampZ - iso timestamp with timezone format
+	ISODateTimestampZ string = "2006-01-02 15:04:05.000Z07:00"
+	// ISOTime - iso time format
+	ISOTime string = "15:04:05"
+	// ISOTimeMS - iso time format with miliseconds
+	ISOTimeMS string = "15:04:05.000"
+	// DMY - dd/MM/yyyy
+	DMY string = "02/01/2006"
+	// DMYTime - dd/MM/yyyy HH:m:ss
+	DMYTime string = "02/01/2006 15:04:05"
+	// UTCDate - date at midnight UTC
+	UTCDate string = "UTCDate"
+	// UTCDateTime - ISODateTime at UTC
+	UTCDateTime string = "UTC"
+	// UTCDateTimestamp - ISODateTimestamp at UTC
+	UTCDateTimestamp string = "UTCTimestamp"
+	// DateOffset - time zone offset
+	DateOffset string = "Z07:00"
+	// RSSDateTime - rss date time format
+	RSSDateTime string = "Mon, 02 Jan 2006 15:04:05 Z07:00"
+	// RSSDateTime1 - rss date time format 1
+	RSSDateTime1 string = "Mon, _2 Jan 2006 15:04:05 Z07:00"
+	// RSSDateTime2 - rss date time format 2
+	RSSDateTime2 string = "Mon, 02 Jan 2006 15:04:05 Z0700"
+	// RSSDateTime3 - rss date time format 3
+	RSSDateTime3 string = "Mon, _2 Jan 2006 15:04:05 Z0700"
+	// RSSDateTimeTZ - rss date time format with named timezone
+	RSSDateTimeTZ string = "Mon, 02 Jan 2006 15:04:05 MST"
+	// RSSDateTimeTZ1 - rss date time format with named timezone 1
+	RSSDateTimeTZ1 string = "Mon, _2 Jan 2006 15:04:05 MST"
+	// HTTPDate - the IMF-fixdate of the HTTP headers (RFC 7231), for UTC times (see FormatHTTPDate)
+	HTTPDate string = "Mon, 02 Jan 2006 15:04:05 GMT"
+)
+
+// IsISODate - checks if is in iso date format
+func IsISODate(sval string) bool {
+	_, err := String2date(sval, ISODate)
+
+	if err != nil {
+		return false
+	}
+
+	return true
+}
+
+// IsISODateTime - checks if is in iso datetime format
+func IsISODateTime(sval string) bool {
+	_, err := String2date(sval, ISODateTime)
+
+	if err != nil {
+		return false
+	}
+
+	return true
+}
+
+// DateFromISODateTime - Date From ISODateTime
+func DateFromISODateTime(sval string) (time.Time, error) {
+	return String2date(sval, ISODateTime)
+}
+
+// Date2string - Date to string. The optional locale ("ro", "it", see RegisterDateLocale)
+// writes the month and day names in its language; an unknown one keeps the English names
+func Date2string(val time.Time, format string, locale ...string) string {
+	switch format {
+	case UTCDate:
+		return val.UTC().Format(ISODate)
+	case UTCDateTime:
+		return val.UTC().Format(ISODateTimeZ)
+	case UTCDateTimestamp:
+		return val.UTC().Format(ISODateTimestampZ)
+	default:
+		if l, _ := dateLocale(locale); l != nil {
+			return formatInLocale(val, format, l)
+		}
+		return val.Format(format)
+	}
+}
+
+// String2dateNoErr - String to date NoErrCheck
+func String2dateNoErr(sval string, format string, locale ...string) time.Time {
+	dt, err := String2date(sval, format, locale...)
+	if err != nil {
+		panic(err)
+	}
+	return dt
+}
+
+// String2date - String to date. The optional locale ("ro", "it", see RegisterDateLocale)
+// reads the month and day names in its language: String2date("12 marzo 2024", "2 January 2006", "it")
+func String2date(sval string, format string, locale ...string) (time.Time, error) {
+	l, err := dateLocale(locale)
+	if err != nil {
+		return Now(), err
+	}
+
+	if l != nil {
+		sval = translateDateNames(sval, format, l)
+	}
+
+	switch format {
+	case ISODate, ISODateTime, ISODateTimestamp, ISODateTimeZ, ISODateTimestampZ, DMY, DMYTime, DateOffset:
+		loc, err := LoadLocation("Local")
+		if err != nil {
+			return Now(), err
+		}
+
+		t, err := time.ParseInLocation(format, sval, loc)
+		if err != nil {
+			return Now(), err
+		}
+		return t, nil
+	case UTCDate:
+		loc, err := LoadLocation("UTC")
+		if err != nil {
+			return Now(), err
+		}
+
+		t, err := time.ParseInLocation(ISODate, sval, loc)
+		if err != nil {
+			return Now(), err
+		}
+		return t, nil
+	case UTCDateTime:
+		loc, err := LoadLocation("UTC")
+		if err != nil {
+			return Now(), err
+		}
+
+		t, err := time.ParseInLocation(ISODateTime, sval, loc)
+		if err != nil {
+			return Now(), err
+		}
+		return t, nil
+	case UTCDateTimestamp:
+		loc, err := LoadLocation("UTC")
+		if err != nil {
+			return Now(), err
+		}
+
+		t, err := time.ParseInLocation(ISODateTimestamp, sval, loc)
+		if err != nil {
+			return Now(), err
+		}
+		return t, nil
+	default:
+		loc, err := LoadLocation("UTC")
+		if err != nil {
+			return Now(), err
+		}
+
+		t, err := time.ParseInLocation(format, sval, loc)
+		if err != nil {
+			return Now(), err
+		}
+		return t, nil
+	}
+}
+
+// Server2ClientDmy - Server2ClientDmy
+func Server2ClientDmy(r *http.Request, serverTime time.Time) string {
+	t := Server2ClientLocal(r, serverTime)
+	return Date2string(t, DMY)
+}
+
+// Server2ClientDmyTime - Server2ClientDmyTime
+func Server2ClientDmyTime(r *http.Request, serverTime time.Time) string {
+	t := Server2ClientLocal(r, serverTime)
+	return Date2string(t, DMYTime)
+}
+
+// Server2ClientLocal - converts serverTime to the time zone of the client, found by the client
+// time resolver (see SetClientTimeResolver): by default the IANA zone of the client zone sources
+// (see SetClientZoneSources), else the minutes offset of the time_zone_offset cookie
+// (wrong across the DST changes), else UTC
+func Server2ClientLocal(r *http.Request, serverTime time.Time) time.Time {
+	loc, err := GetClientTimeResolver().ClientLocation(r)
+	if err != nil || loc == nil {
+		return serverTime.UTC()
+	}
+
+	return serverTime.In(loc)
+}
+
+var (
+	rssFormatsMux sync.RWMutex
+	rssFormats    = []string{
+		RSSDateTimeTZ,
+		RSSDateTimeTZ1,
+		RSSDateTime,
+		RSSDateTime1,
+		RSSDateTime2,
+		RSSDateTime3,
+		"02 Jan 2006 15:04:05 Z0700",
+		"_2 Jan 2006 15:04:05 Z0700",
+		ISODateTime,
+		ISODateTimeZ,
+	}
+)
+
+// RegisterRSSDateFormat - adds layouts tried by ParseRSSDate after the built in ones
+func RegisterRSSDateFormat(layouts ...string) {
+	rssFormatsMux.Lock()
+	defer rssFormatsMux.Unlock()
+
+	for _, layout := range layouts {
+		found := false
+		for _, f := range rssFormats {
+			if f == layout {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			rssFormats = append(rssFormats, layout)
+		}
+	}
+}
+
+// DateParseError - returned when none of the layouts tried parses the date
+type DateParseError struct {
+	Value string
+	// Errors - the error of each layout tried, in order
+	Errors []error
+}
+
+// Error - lists the error of every layout tried
+func (e *DateParseError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("can't parse date %q: %s", e.Value, strings.Join(msgs, "; "))
+}
+
+// ParseRSSDate - try to parse RSS date in multiple formats (see RegisterRSSDateFormat).
+// If none matches, a *DateParseError lists the error of every format tried
+func ParseRSSDate(sdate string) (time.Time, error) {
+	rssFormatsMux.RLock()
+	formats := rssFormats
+	rssFormatsMux.RUnlock()
+
+	sdt := strings.TrimSpace(sdate)
+	perr := &DateParseError{Value: sdate}
+
+	for _, format := range formats {
+		dt, err := String2date(sdt, format)
+		if err == nil {
+			return dt.UTC(), nil
+		}
+
+		perr.Errors = append(perr.Errors, err)
+	}
+
+	return time.Time{}, perr
+}
+
+// StartOfDay - returns midnight of the day of t, in the location of t.
+// In the zones where a DST change skips midnight, it is the first instant of the day
+func StartOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// EndOfDay - returns the last instant (nanosecond) of the day of t, in the location of t
+func EndOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
+
+// StartOfWeek - returns midnight of the first day (weekStart) of the week of t, in the location of t
+func StartOfWeek(t time.Time, weekStart time.Weekday) time.Time {
+	days := (int(t.Weekday()) - int(weekStart) + 7) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, t.Location())
+}
+
+// EndOfWeek - returns the last instant of the week (starting on weekStart) of t, in the location of t
+func EndOfWeek(t time.Time, weekStart time.Weekday) time.Time {
+	start := StartOfWeek(t, weekStart)
+	return time.Date(start.Year(), start.Month(), start.Day()+7, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
+
+// StartOfMonth - returns midnight of the first day of the month of t, in the location of t
+func StartOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// EndOfMonth - returns the last instant of the month of t, in the location of t
+func EndOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
+
+// StartOfYear - returns midnight of January 1st of the year of t, in the location of t
+func StartOfYear(t time.Time) time.Time {
+	return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, t.Location())
+}
+
+// EndOfYear - returns the last instant of the year of t, in the location of t
+func EndOfYear(t time.Time) time.Time {
+	return time.Date(t.Year()+1, time.January, 1, 0, 0, 0, 0, t.Location()).Add(-time.Nanosecond)
+}
+
+// MonthEnd - what AddMonths does when the day does not exist in the target month
+type MonthEnd int
+
+const (
+	// MonthEndClamp - the day is clamped to the last day of the target month: Jan 31 + 1 month = Feb 28 (29)
+	MonthEndClamp MonthEnd = iota
+	// MonthEndStick - as MonthEndClamp, and a last day of a month stays the last day: Feb 28 + 1 month = Mar 31
+	MonthEndStick
+	// MonthEndOverflow - the extra days overflow into the next month, as in time.AddDate: Jan 31 + 1 month = Mar 3
+	MonthEndOverflow
+)
+
+// AddMonths - adds months to t, keeping its time of day, with the given month end behaviour
+func AddMonths(t time.Time, months int, monthEnd MonthEnd) time.Time {
+	if monthEnd == MonthEndOverflow {
+		return t.AddDate(0, months, 0)
+	}
+
+	y, m, d := t.Date()
+	first := time.Date(y, m+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := DaysInMonth(first.Year(), first.Month())
+
+	if d > last || (monthEnd == MonthEndStick && d == DaysInMonth(y, m)) {
+		d = last
+	}
+
+	return time.Date(first.Year(), first.Month(), d, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// AddMonthsClamped - adds months to t, clamping the day to the last day of the target month
+func AddMonthsClamped(t time.Time, months int) time.Time {
+	return AddMonths(t, months, MonthEndClamp)
+}
+
+// AddYearsClamped - adds years to t, clamping Feb 29 to Feb 28 in the non leap years
+func AddYearsClamped(t time.Time, years int) time.Time {
+	return AddMonths(t, 12*years, MonthEndClamp)
+}
+
+// DaysInMonth - returns the number of days of the month of year
+func DaysInMonth(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// IsLeapYear - checks if year has 366 days
+func IsLeapYear(year int) bool {
+	return year%4 == 0 && (year%100 != 0 || year%400 == 0)
+}
+
+// DayOfYear - returns the day of the year of t, from 1 to 365 (366 in the leap years)
+func DayOfYear(t time.Time) int {
+	return t.YearDay()
+}
+
+// IsLastDayOfMonth - checks if t is on the last day of its month
+func IsLastDayOfMonth(t time.Time) bool {
+	return t.Day() == DaysInMonth(t.Year(), t.Month())
+}
+
+// WeekOfMonth - returns the week of the month of t, from 1 to 6, the weeks starting on weekStart:
+// the first week is the one holding the 1st of the month, even if partial
+func WeekOfMonth(t time.Time, weekStart time.Weekday) int {
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	offset := (int(first.Weekday()) - int(weekStart) + 7) % 7
+
+	return (t.Day()+offset-1)/7 + 1
+}
+
+// ISOWeekStart - returns the Monday (midnight UTC) of the ISO 8601 week of year.
+// Week 1 is the week with the first Thursday of the year
+func ISOWeekStart(year, week int) time.Time {
+	// January 4th is always in week 1
+	jan4 := time.Date(year, time.January, 4, 0, 0, 0, 0, time.UTC)
+	monday := jan4.AddDate(0, 0, -((int(jan4.Weekday()) + 6) % 7))
+
+	return monday.AddDate(0, 0, 7*(week-1))
+}
+
+// WeeksInYear - returns the number of ISO 8601 weeks of year (52 or 53)
+func WeeksInYear(year int) int {
+	// December 28th is always in the last week
+	_, week := time.Date(year, time.December, 28, 0, 0, 0, 0, time.UTC).ISOWeek()
+	return week
+}
+
+// FormatISOWeekDate - formats t as an ISO 8601 week date: 2024-W07-3 (Wednesday of week 7)
+func FormatISOWeekDate(t time.Time) string {
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%04d-W%02d-%d", year, week, (int(t.Weekday())+6)%7+1)
+}
+
+// ParseISOWeekDate - parses an ISO 8601 week date (2024-W07-3, 2024W073, or 2024-W07 for the Monday)
+// into its midnight UTC
+func ParseISOWeekDate(s string) (time.Time, error) {
+	var year, week int
+	day := 1
+
+	str := strings.Replace(strings.TrimSpace(s), "-", "", -1)
+
+	var n int
+	var err error
+	switch len(str) {
+	case 7:
+		n, err = fmt.Sscanf(str, "%4dW%2d", &year, &week)
+	case 8:
+		n, err = fmt.Sscanf(str, "%4dW%2d%1d", &year, &week, &day)
+	default:
+		return time.Time{}, fmt.Errorf("invalid ISO week date %q", s)
+	}
+
+	if err != nil || n < 2 {
+		return time.Time{}, fmt.Errorf("invalid ISO week date %q", s)
+	}
+
+	if week < 1 || week > WeeksInYear(year) || day < 1 || day > 7 {
+		return time.Time{}, fmt.Errorf("invalid ISO week date %q: week or day out of range", s)
+	}
+
+	return ISOWeekStart(year, week).AddDate(0, 0, day-1), nil
+}
+
+// TruncateToInterval - rounds t down to a multiple of d of its wall clock, in the location of t
+// (use t.In(loc) for another zone): 10:37 is 10:30 for 15 minutes, the midnight for 24 hours.
+// time.Truncate works on the absolute time, so it is off by the zone offset for the zones
+// not a multiple of d away from UTC. The intervals are aligned to January 1st of year 1 (a Monday)
+func TruncateToInterval(t time.Time, d time.Duration) time.Time {
+	if d <= 0 {
+		return t
+	}
+
+	return wallClockIn(wallClockIn(t, time.UTC).Truncate(d), t.Location())
+}
+
+// RoundToInterval - rounds t to the nearest multiple of d of its wall clock, in the location of t
+// (halfway values round up, see TruncateToInterval)
+func RoundToInterval(t time.Time, d time.Duration) time.Time {
+	if d <= 0 {
+		return t
+	}
+
+	return wallClockIn(wallClockIn(t, time.UTC).Round(d), t.Location())
+}
+
+// DurationToMillis - returns d in milliseconds, keeping the fractions (1.5 for 1500µs),
+// for the numeric fields of logs and metrics
+func DurationToMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// MillisToDuration - returns the duration of ms milliseconds, rounded to the nanosecond
+func MillisToDuration(ms float64) time.Duration {
+	return time.Duration(math.Round(ms * float64(time.Millisecond)))
+}
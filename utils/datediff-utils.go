@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DateDifference - the calendar difference between two times (see DateDiff)
+type DateDifference struct {
+	// Negative - the second time is before the first one
+	Negative bool
+	Years    int
+	Months   int
+	Days     int
+	Hours    int
+	Minutes  int
+	Seconds  int
+}
+
+// DateDiff - returns the calendar difference from a to b, in whole years, months, days,
+// hours, minutes and seconds: the months are added to a clamped to the month end
+// (see AddMonthsClamped), so Jan 31 to Feb 28 is 1 month. b is compared in the location of a
+func DateDiff(a, b time.Time) DateDifference {
+	var d DateDifference
+
+	b = b.In(a.Location())
+	if b.Before(a) {
+		a, b = b, a
+		d.Negative = true
+	}
+
+	months := (b.Year()-a.Year())*12 + int(b.Month()-a.Month())
+	from := AddMonthsClamped(a, months)
+	if from.After(b) {
+		months--
+		from = AddMonthsClamped(a, months)
+	}
+
+	d.Years = months / 12
+	d.Months = months % 12
+
+	// calendar days, so a day across a DST change still counts as one
+	days := int(b.Sub(from) / (24 * time.Hour))
+	for days > 0 && from.AddDate(0, 0, days).After(b) {
+		days--
+	}
+	for !from.AddDate(0, 0, days+1).After(b) {
+		days++
+	}
+
+	d.Days = days
+	rest := b.Sub(from.AddDate(0, 0, days))
+
+	d.Hours = int(rest / time.Hour)
+	d.Minutes = int(rest % time.Hour / time.Minute)
+	d.Seconds = int(rest % time.Minute / time.Second)
+
+	return d
+}
+
+// IsZero - true if the difference is under a second
+func (d DateDifference) IsZero() bool {
+	return d.Years == 0 && d.Months == 0 && d.Days == 0 && d.Hours == 0 && d.Minutes == 0 && d.Seconds == 0
+}
+
+// ISODuration - returns the difference as an ISO 8601 duration
+func (d DateDifference) ISODuration() ISODuration {
+	return ISODuration{
+		Negative: d.Negative,
+		Years:    d.Years,
+		Months:   d.Months,
+		Days:     d.Days,
+		Time:     time.Duration(d.Hours)*time.Hour + time.Duration(d.Minutes)*time.Minute + time.Duration(d.Seconds)*time.Second,
+	}
+}
+
+// String - formats the difference as "1 year 2 months 3 days" (see Format)
+func (d DateDifference) String() string {
+	return d.Format(0)
+}
+
+// Format - formats the difference as "1 year 2 months 3 days 4 hours", leaving out the zero units.
+// units > 0 keeps only the first units non zero ones ("1 year 2 months" for 2).
+// A negative difference starts with "-", a zero one is "0 seconds"
+func (d DateDifference) Format(units int) string {
+	parts := []struct {
+		n    int
+		unit string
+	}{
+		{d.Years, "year"},
+		{d.Months, "month"},
+		{d.Days, "day"},
+		{d.Hours, "hour"},
+		{d.Minutes, "minute"},
+		{d.Seconds, "second"},
+	}
+
+	var words []string
+	for _, p := range parts {
+		if p.n == 0 {
+			continue
+		}
+
+		if units > 0 && len(words) == units {
+			break
+		}
+
+		w := strconv.Itoa(p.n) + " " + p.unit
+		if p.n != 1 {
+			w += "s"
+		}
+		words = append(words, w)
+	}
+
+	if len(words) == 0 {
+		return "0 seconds"
+	}
+
+	s := strings.Join(words, " ")
+	if d.Negative {
+		s = "-" + s
+	}
+
+	return s
+}
+
+// FormatDateDiff - formats the calendar difference from a to b: "1 year 2 months 3 days"
+func FormatDateDiff(a, b time.Time) string {
+	return DateDiff(a, b).String()
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// DateRange - the half open interval [Start, End). The iterations run in the location of Start
+type DateRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// NewDateRange - instantiates a DateRange
+func NewDateRange(start, end time.Time) DateRange {
+	return DateRange{Start: start, End: end}
+}
+
+// Contains - checks if t is in the range
+func (r DateRange) Contains(t time.Time) bool {
+	return !t.Before(r.Start) && t.Before(r.End)
+}
+
+// ForEachDay - calls fn with the midnight of each day overlapping the range (the first one may be
+// before Start). The days follow the calendar, so they last 23 or 25 hours over the DST changes.
+// A non nil error returned by fn stops the iteration and is returned
+func (r DateRange) ForEachDay(fn func(day time.Time) error) error {
+	return r.forEachPeriod(StartOfDay(r.Start), 0, 0, 1, fn)
+}
+
+// ForEachMonth - calls fn with the first day (at midnight) of each month overlapping the range
+func (r DateRange) ForEachMonth(fn func(month time.Time) error) error {
+	return r.forEachPeriod(StartOfMonth(r.Start), 0, 1, 0, fn)
+}
+
+// ForEachYear - calls fn with January 1st (at midnight) of each year overlapping the range
+func (r DateRange) ForEachYear(fn func(year time.Time) error) error {
+	return r.forEachPeriod(StartOfYear(r.Start), 1, 0, 0, fn)
+}
+
+// ForEachStep - calls fn with Start, then Start plus years, months and days (keeping the wall
+// clock over the DST changes), etc, while before End. The years and months are added first,
+// the day clamped to the month end (Jan 31 + 1 month is Feb 28 / 29, not Mar 3), then the days.
+// Each value is computed from Start, so the month ends don't drift
+func (r DateRange) ForEachStep(years, months, days int, fn func(t time.Time) error) error {
+	if years < 0 || months < 0 || days < 0 || years+months+days == 0 {
+		return fmt.Errorf("invalid date range step: %d years %d months %d days", years, months, days)
+	}
+
+	return r.forEachPeriod(r.Start, years, months, days, fn)
+}
+
+// ForEachDuration - calls fn with Start, then Start plus step, etc, while before End.
+// The step is elapsed time: hourly buckets are 23 or 25 per day over the DST changes
+func (r DateRange) ForEachDuration(step time.Duration, fn func(t time.Time) error) error {
+	if step <= 0 {
+		return fmt.Errorf("invalid date range step: %s", step)
+	}
+
+	for t := r.Start; t.Before(r.End); t = t.Add(step) {
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r DateRange) forEachPeriod(first time.Time, years, months, days int, fn func(t time.Time) error) error {
+	for i := 0; ; i++ {
+		t := AddMonthsClamped(first, i*(12*years+months)).AddDate(0, 0, i*days)
+		if !t.Before(r.End) {
+			return nil
+		}
+
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+}
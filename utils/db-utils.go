@@ -4,8 +4,10 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"reflect"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
@@ -23,11 +25,34 @@ const (
 	SQLServer string = "mssql"
 	// Sqlite3 - defines sqlite3 driver name
 	Sqlite3 string = "sqlite3"
+
+	// SQLServerParamPrefix - default parameter prefix for SQL Server (@p1, @p2, etc)
+	SQLServerParamPrefix string = "@p"
+)
+
+// ColumnCase - column name normalization applied by SQLScan
+type ColumnCase int
+
+const (
+	// ColumnCaseDefault - lowercases unquoted column names in Oracle, leaves them unchanged elsewhere
+	ColumnCaseDefault ColumnCase = iota
+	// ColumnCasePreserve - column names are matched exactly as returned by the driver
+	ColumnCasePreserve
+	// ColumnCaseLower - column names and sql tags are lowercased before matching
+	ColumnCaseLower
+	// ColumnCaseUpper - column names and sql tags are uppercased before matching
+	ColumnCaseUpper
+	// ColumnCaseInsensitive - column names and sql tags are matched ignoring case, in all databases.
+	// Unlike ColumnCaseLower, the column names are kept as returned by the driver (errors, reports)
+	ColumnCaseInsensitive
 )
 
 // DbUtils can be used to prepare queries by changing the sql param notations
 // as defined by each supported database
 type DbUtils struct {
+	// stmtStats - first, so its counters are 64 bit aligned for sync/atomic
+	stmtStats cacheStats
+
 	mux       *sync.RWMutex
 	db        *sql.DB
 	tx        *sql.Tx
@@ -35,6 +60,31 @@ type DbUtils struct {
 	txActive  bool
 	dbType    string
 	prefix    string
+
+	mssqlPrefix    string
+	mssqlPrefixSet bool
+
+	stmtMux sync.RWMutex
+	stmts   map[string]*sql.Stmt
+
+	columnCase     ColumnCase
+	strictScan     bool
+	scanLocation   *time.Location
+	positionalScan bool
+
+	idMux  sync.RWMutex
+	idGens map[string]tableIDGenerator
+
+	identMux      sync.RWMutex
+	allowedIdents map[string]string
+
+	hookMux sync.RWMutex
+	hooks   []QueryHook
+
+	utcMux    sync.RWMutex
+	utcReport func(v UTCViolation)
+
+	tempListMin int
 }
 
 func (u *DbUtils) setDbType(dbType string) {
@@ -61,40 +111,113 @@ func (u *DbUtils) setDbType(dbType string) {
 		u.prefix = "$"
 	case Oci8, Oracle, Oracle11g:
 		u.prefix = ":"
+	case SQLServer:
+		if u.mssqlPrefixSet {
+			u.prefix = u.mssqlPrefix
+		} else {
+			u.prefix = SQLServerParamPrefix
+		}
 	default:
 		u.prefix = ""
 	}
 }
 
+// SetSQLServerParamPrefix - sets the parameter prefix used for SQL Server.
+// Defaults to "@p". Set it to "" to pass the ? placeholders through to the driver
+func (u *DbUtils) SetSQLServerParamPrefix(prefix string) {
+	u.mssqlPrefix = prefix
+	u.mssqlPrefixSet = true
+
+	if u.dbType == SQLServer {
+		u.prefix = prefix
+	}
+}
+
+// SetColumnCase - sets the column name normalization used when scanning rows into structs
+func (u *DbUtils) SetColumnCase(c ColumnCase) {
+	u.columnCase = c
+}
+
+// SetStrictScan - in strict mode SQLScan returns a ScanMappingError when a column has no
+// matching struct field or a sql tagged field has no matching column. Otherwise the
+// columns without a field are discarded and the fields without a column are left unchanged
+func (u *DbUtils) SetStrictScan(strict bool) {
+	u.strictScan = strict
+}
+
+// SetScanLocation - sets the location of the times read without a time zone by SQLScan
+// (Oracle, SQLite). Defaults to UTC, as the dates are expected to be saved as UTC
+func (u *DbUtils) SetScanLocation(loc *time.Location) {
+	u.scanLocation = loc
+}
+
+// SetPositionalScan - in positional mode SQLScan fills the exported struct fields in
+// declaration order from the select list position, without needing sql tags.
+// Fields tagged `sql:"-"` are skipped
+func (u *DbUtils) SetPositionalScan(positional bool) {
+	u.positionalScan = positional
+}
+
 // PQuery prepares query for running.
 // Query parameter placeholders will be written as ? in all suported databses.
 //   Ex: select col1 from table1 where col2 = ?
 // Some alterations to the query will be made:
 //   - get dates as UTC
+//   - translates "expr +/- INTERVAL ? DAY" (SECOND, MINUTE, HOUR, DAY, WEEK, MONTH, YEAR) into the date arithmetic of each database
+//   - expands slice args bound to "IN (?)" into one placeholder per item (in Oracle, lists over 1000 items are split into OR-ed groups)
+//   - binds slice args of "expr = ANY (?)" and "expr <> ALL (?)" as arrays in Postgres and expands them as IN / NOT IN lists elsewhere
+//   - translates JSON_VALUE(expr, '$.path') into expr #>> '{path}' (Postgres), JSON_UNQUOTE(JSON_EXTRACT(...)) (MySQL) and json_extract (SQLite); map and struct args are bound as JSON text
+//   - translates REGEXP_LIKE(expr, pattern [, 'i']) into expr ~ pattern (Postgres) and expr REGEXP pattern (MySQL, SQLite); SQL Server only gets LIKE for plain text patterns anchored with ^ / $
+//   - rewrites ISNULL(a, b), IFNULL(a, b) and NVL(a, b) as COALESCE(a, b) (as NVL(a, b) in Oracle 11g)
+//   - binds :name placeholders to sql.Named args, a name used more than once being bound once
+//     (the parameter number is reused in Postgres and Oracle, the value is repeated elsewhere)
+//   - translates a trailing "RETURNING col1, col2" of INSERT, UPDATE and DELETE (see ReturningResult)
+//   - writes MINUS as EXCEPT (EXCEPT as MINUS in Oracle); "EXCEPT / INTERSECT DISTINCT" loses the
+//     DISTINCT where it is not accepted and "ALL" is refused where it is not supported
 //   - in Postgresql
 //       - changes params written as ? to $1, $2, etc
 //   - in MySQL
 //       - replaces quote identifiers with backticks
+//       - removes RETURNING, the value of a single column is taken from LastInsertId
 //   - in SQL Server
 //       - replaces "LIMIT ? OFFSET ?" with "OFFSET ? ROWS FETCH NEXT ? ROWS ONLY"
 //       - switches parameters set for OFFSET and LIMIT to reflect the changed query
+//       - replaces "FOR UPDATE [SKIP LOCKED|NOWAIT]" with "WITH (UPDLOCK, ROWLOCK[, READPAST|NOWAIT])" table hints
+//       - replaces "RETURNING col" with "OUTPUT INSERTED.col" (DELETED.col for DELETE)
 //       - Limitations:
 //           - LIMIT ? OFFSET ? must be the last 2 parameters in the query
+//       - changes params written as ? to @p1, @p2, etc (see SetSQLServerParamPrefix)
 //   - in Oracle
 //       - changes params written as ? to :1, :2, etc
+//       - binds the RETURNING columns with "RETURNING col INTO ?" out parameters
+//       - in Oracle 11g, pages "LIMIT ? OFFSET ?" with ROW_NUMBER() OVER (ORDER BY ...), the ORDER BY of the query (whose columns must be selected)
+//       - refuses LIMIT / OFFSET with FOR UPDATE (Oracle can't lock the rows of a FETCH NEXT / rownum query, ORA-02014)
+// QueryOption args disable some of the rewrites (WithoutUTCTranslation, WithoutLimitRewrite, WithoutIdentifierRewrite)
+// or enable an optional one (WithDurationBinding, WithTempTableInLists).
+// A query with args, no ? placeholder and parameters in the database style (ex: $1 in Postgres)
+// is taken as already prepared: it is sent as written, none of the rewrites above is applied
 func (u *DbUtils) PQuery(query string, args ...interface{}) *PreparedQuery {
 	pq := PreparedQuery{
 		DbType:      u.dbType,
 		ParamPrefix: u.prefix,
 		Query:       query,
-		Args:        args,
+		tempListMin: u.tempListMin,
+	}
+	pq.Args = pq.applyOptions(args)
+
+	// already rewritten queries are not rewritten again
+	if pq.looksPrepared() {
+		pq.markPrepared()
+	} else {
+		pq.Prepare()
 	}
-	pq.Prepare()
 
 	return &pq
 }
 
-// PQueryNoRewrite - useable when the query was already prepared before
+// PQueryNoRewrite - useable when the query was already prepared before.
+// If the query parameters don't match the database type style (ex: ? instead of $1 in Postgres),
+// the error is returned by Exec, RunQuery, etc
 func (u *DbUtils) PQueryNoRewrite(query string, args ...interface{}) *PreparedQuery {
 	pq := PreparedQuery{
 		DbType:      u.dbType,
@@ -103,6 +226,9 @@ func (u *DbUtils) PQueryNoRewrite(query string, args ...interface{}) *PreparedQu
 		Args:        args,
 	}
 
+	pq.markPrepared()
+	pq.err = pq.validateRewritten()
+
 	return &pq
 }
 
@@ -168,16 +294,18 @@ func (u *DbUtils) BeginTransaction() (*sql.Tx, error) {
 }
 
 // Commit - commits the transaction
-func (u *DbUtils) Commit(tx *sql.Tx) {
+func (u *DbUtils) Commit(tx *sql.Tx) error {
 	if u.isSqlite3 {
 		if u.txActive {
 			defer u.mux.Unlock()
-			u.tx.Commit()
 			u.txActive = false
+			return u.tx.Commit()
 		}
 	} else if tx != nil {
-		tx.Commit()
+		return tx.Commit()
 	}
+
+	return nil
 }
 
 // Rollback - rollsback the transaction
@@ -195,7 +323,7 @@ func (u *DbUtils) Rollback(tx *sql.Tx) {
 
 // Exec - exec query without result
 func (u *DbUtils) Exec(pq *PreparedQuery) (sql.Result, error) {
-	res, err := u.db.Exec(pq.Query, pq.Args...)
+	res, err := u.exec(nil, pq)
 	if err != nil {
 		return res, err
 	}
@@ -205,7 +333,7 @@ func (u *DbUtils) Exec(pq *PreparedQuery) (sql.Result, error) {
 
 // ExecTx - exec query without result
 func (u *DbUtils) ExecTx(tx *sql.Tx, pq *PreparedQuery) (sql.Result, error) {
-	res, err := tx.Exec(pq.Query, pq.Args...)
+	res, err := u.exec(tx, pq)
 	if err != nil {
 		return res, err
 	}
@@ -215,11 +343,30 @@ func (u *DbUtils) ExecTx(tx *sql.Tx, pq *PreparedQuery) (sql.Result, error) {
 
 // RunQuery - reads sql into a struct
 func (u *DbUtils) RunQuery(pq *PreparedQuery, dest interface{}) error {
+	return u.runQuery(nil, pq, dest)
+}
+
+// RunQueryTx - reads sql into a struct (from a transaction)
+func (u *DbUtils) RunQueryTx(tx *sql.Tx, pq *PreparedQuery, dest interface{}) error {
+	return u.runQuery(tx, pq, dest)
+}
+
+func (u *DbUtils) runQuery(tx *sql.Tx, pq *PreparedQuery, dest interface{}) error {
+	if len(pq.tempLists) > 0 {
+		return u.withTempLists(tx, pq, func(tx *sql.Tx, pq *PreparedQuery) error {
+			return u.runQuery(tx, pq, dest)
+		})
+	}
+
 	scanHelper := SQLScan{}
 	found := false
 
-	rows, err := u.db.Query(pq.Query, pq.Args...)
+	start := time.Now()
+	rows, err := u.query(tx, pq)
 	if err != nil {
+		if pq.Err() == nil {
+			u.afterQuery(pq, start, -1, err)
+		}
 		return err
 	}
 	defer rows.Close()
@@ -230,7 +377,17 @@ func (u *DbUtils) RunQuery(pq *PreparedQuery, dest interface{}) error {
 		break
 	}
 
-	err = rows.Err()
+	// the scan error (ex: a column that can't be converted) is not overwritten by rows.Err
+	if err == nil {
+		err = rows.Err()
+	}
+
+	var n int64
+	if found {
+		n = 1
+	}
+	u.afterQuery(pq, start, n, err)
+
 	if err != nil {
 		return err
 	}
@@ -242,86 +399,261 @@ func (u *DbUtils) RunQuery(pq *PreparedQuery, dest interface{}) error {
 	return nil
 }
 
-// RunQueryTx - reads sql into a struct (from a transaction)
-func (u *DbUtils) RunQueryTx(tx *sql.Tx, pq *PreparedQuery, dest interface{}) error {
-	scanHelper := SQLScan{}
-	found := false
+// RunQueryIntoSlice - reads a one column result set into the slice pointed by dest
+// (*[]int64, *[]string, *[]time.Time, *[]*string for nullable columns, etc).
+// The elements are converted as the struct fields of the same type are by SQLScan (bool, UUID, etc).
+// The rows are appended to the slice; no rows leave it as it is
+func (u *DbUtils) RunQueryIntoSlice(pq *PreparedQuery, dest interface{}) error {
+	return u.runQueryIntoSlice(nil, pq, dest)
+}
 
-	rows, err := tx.Query(pq.Query, pq.Args...)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
+// RunQueryIntoSliceTx - reads a one column result set into the slice pointed by dest (from a transaction)
+func (u *DbUtils) RunQueryIntoSliceTx(tx *sql.Tx, pq *PreparedQuery, dest interface{}) error {
+	return u.runQueryIntoSlice(tx, pq, dest)
+}
 
-	for rows.Next() {
-		found = true
-		err = scanHelper.Scan(u, rows, dest)
-		break
+func (u *DbUtils) runQueryIntoSlice(tx *sql.Tx, pq *PreparedQuery, dest interface{}) error {
+	if len(pq.tempLists) > 0 {
+		return u.withTempLists(tx, pq, func(tx *sql.Tx, pq *PreparedQuery) error {
+			return u.runQueryIntoSlice(tx, pq, dest)
+		})
 	}
 
-	err = rows.Err()
-	if err != nil {
-		return err
+	slice := reflect.ValueOf(dest)
+	if slice.Kind() != reflect.Ptr || slice.IsNil() || slice.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("dest must be a pointer to a slice, not %T", dest)
 	}
+	slice = slice.Elem()
+	elemType := slice.Type().Elem()
 
-	if !found {
-		return sql.ErrNoRows
-	}
+	isTime := elemType == dtType || elemType == reflect.PtrTo(dtType)
+	isOracle := u.dbType == Oci8 || u.dbType == Oracle || u.dbType == Oracle11g
 
-	return nil
-}
+	// the elements are converted as the struct fields of the same type (see SQLScan)
+	var conv ConverterFunc
+	var c scanColumn
+	planColumn(u, &c, reflect.StructField{Type: elemType}, 0)
+	if c.kind == scanConvert {
+		conv = c.convert
+	}
 
-// DBRowCallback - callback type
-type DBRowCallback func(row *sql.Rows, sc *SQLScan) error
+	loc := u.scanLocation
+	if loc == nil {
+		loc = time.UTC
+	}
 
-// ForEachRow - reads sql and runs a function fo every row
-func (u *DbUtils) ForEachRow(pq *PreparedQuery, callback DBRowCallback) error {
 	sc := new(SQLScan)
 
-	rows, err := u.db.Query(pq.Query, pq.Args...)
+	start := time.Now()
+	rows, err := u.query(tx, pq)
 	if err != nil {
+		if pq.Err() == nil {
+			u.afterQuery(pq, start, -1, err)
+		}
 		return err
 	}
 	defer rows.Close()
 
-	for rows.Next() {
-		err = callback(rows, sc)
-		if err != nil {
-			return err
+	cols, err := rows.Columns()
+
+	// the row number added by the Oracle 11g pagination is skipped
+	var rnum int64
+	extra := []interface{}{}
+	if err == nil && isOracle && len(cols) == 2 && strings.EqualFold(cols[1], "rnumignore") {
+		extra = append(extra, &rnum)
+		cols = cols[:1]
+	}
+
+	if err == nil && len(cols) != 1 {
+		err = fmt.Errorf("expected a single column, the query returns %d", len(cols))
+	}
+
+	var n int64
+	for err == nil && rows.Next() {
+		n++
+		elem := reflect.New(elemType)
+
+		switch {
+		case conv != nil:
+			var src interface{}
+			if err = rows.Scan(append([]interface{}{&src}, extra...)...); err == nil {
+				err = setConverted(elem.Elem(), conv, src)
+			}
+		case isTime && u.dbType == Sqlite3:
+			var sdt sql.NullString
+			if err = rows.Scan(&sdt); err != nil || !sdt.Valid || sdt.String == "" {
+				break
+			}
+
+			var dt time.Time
+			dt, err = sc.parseSDate(strings.Replace(strings.Replace(sdt.String, "T", " ", 1), "Z", "", 1), loc)
+			if err != nil {
+				break
+			}
+
+			if elemType == dtType {
+				elem.Elem().Set(reflect.ValueOf(dt))
+			} else {
+				elem.Elem().Set(reflect.ValueOf(&dt))
+			}
+		default:
+			if err = rows.Scan(append([]interface{}{elem.Interface()}, extra...)...); err != nil || !isTime || !isOracle {
+				break
+			}
+
+			// the oracle timestamps keep their wall clock, in loc (see SQLScan)
+			switch dt := elem.Interface().(type) {
+			case *time.Time:
+				*dt = wallClockIn(*dt, loc)
+			case **time.Time:
+				if *dt != nil {
+					**dt = wallClockIn(**dt, loc)
+				}
+			}
+		}
+
+		if err == nil {
+			slice.Set(reflect.Append(slice, elem.Elem()))
 		}
 	}
 
-	err = rows.Err()
-	if err != nil {
-		return err
+	if err == nil {
+		err = rows.Err()
 	}
 
-	return nil
+	u.afterQuery(pq, start, n, err)
+
+	return err
+}
+
+// exec - runs pq on tx (if not nil) or on the database, using the warmed up statement if any.
+// The values of a RETURNING clause are kept in the result (see ReturningResult)
+func (u *DbUtils) exec(tx *sql.Tx, pq *PreparedQuery) (sql.Result, error) {
+	if err := pq.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(pq.tempLists) > 0 {
+		var res sql.Result
+		err := u.withTempLists(tx, pq, func(tx *sql.Tx, pq *PreparedQuery) error {
+			var err error
+			res, err = u.exec(tx, pq)
+			return err
+		})
+
+		return res, err
+	}
+
+	u.checkArgsUTC(pq)
+
+	var res sql.Result
+	var err error
+	start := time.Now()
+
+	if len(pq.returning) > 0 {
+		res, err = u.execReturning(tx, pq, nil)
+	} else {
+		res, err = u.execStmt(tx, pq, pq.Args)
+	}
+
+	u.afterExec(pq, start, res, err)
+
+	return res, err
+}
+
+// execStmt - runs the query of pq with args
+func (u *DbUtils) execStmt(tx *sql.Tx, pq *PreparedQuery, args []interface{}) (sql.Result, error) {
+	stmt := u.preparedStmt(pq.Query)
+	u.stmtStats.lookup(stmt != nil)
+
+	switch {
+	case stmt != nil && tx != nil:
+		return tx.Stmt(stmt).Exec(args...)
+	case stmt != nil:
+		return stmt.Exec(args...)
+	case tx != nil:
+		return tx.Exec(pq.Query, args...)
+	default:
+		return u.db.Exec(pq.Query, args...)
+	}
+}
+
+// query - runs pq on tx (if not nil) or on the database, using the warmed up statement if any
+func (u *DbUtils) query(tx *sql.Tx, pq *PreparedQuery) (*sql.Rows, error) {
+	if err := pq.Err(); err != nil {
+		return nil, err
+	}
+
+	u.checkArgsUTC(pq)
+
+	return u.queryStmt(tx, pq)
+}
+
+// queryStmt - runs the query of pq, without the checks of query
+func (u *DbUtils) queryStmt(tx *sql.Tx, pq *PreparedQuery) (*sql.Rows, error) {
+	stmt := u.preparedStmt(pq.Query)
+	u.stmtStats.lookup(stmt != nil)
+
+	switch {
+	case stmt != nil && tx != nil:
+		return tx.Stmt(stmt).Query(pq.Args...)
+	case stmt != nil:
+		return stmt.Query(pq.Args...)
+	case tx != nil:
+		return tx.Query(pq.Query, pq.Args...)
+	default:
+		return u.db.Query(pq.Query, pq.Args...)
+	}
+}
+
+// DBRowCallback - callback type
+type DBRowCallback func(row *sql.Rows, sc *SQLScan) error
+
+// ForEachRow - reads sql and runs a function fo every row
+func (u *DbUtils) ForEachRow(pq *PreparedQuery, callback DBRowCallback) error {
+	return u.forEachRow(nil, pq, callback)
 }
 
 // ForEachRowTx - reads sql and runs a function fo every row
 func (u *DbUtils) ForEachRowTx(tx *sql.Tx, pq *PreparedQuery, callback DBRowCallback) error {
+	return u.forEachRow(tx, pq, callback)
+}
+
+func (u *DbUtils) forEachRow(tx *sql.Tx, pq *PreparedQuery, callback DBRowCallback) error {
+	if len(pq.tempLists) > 0 {
+		return u.withTempLists(tx, pq, func(tx *sql.Tx, pq *PreparedQuery) error {
+			return u.forEachRow(tx, pq, callback)
+		})
+	}
+
 	sc := new(SQLScan)
 
-	rows, err := tx.Query(pq.Query, pq.Args...)
+	start := time.Now()
+	rows, err := u.query(tx, pq)
 	if err != nil {
+		if pq.Err() == nil {
+			u.afterQuery(pq, start, -1, err)
+		}
 		return err
 	}
 	defer rows.Close()
 
+	var n int64
 	for rows.Next() {
+		n++
 		err = callback(rows, sc)
 		if err != nil {
-			return err
+			break
 		}
 	}
 
-	err = rows.Err()
-	if err != nil {
-		return err
+	if err == nil {
+		err = rows.Err()
 	}
 
-	return nil
+	u.afterQuery(pq, start, n, err)
+
+	return err
 }
 
 // GetAllRows - Get all rows
@@ -397,3 +729,18 @@ func (u *DbUtils) SetAsyncCommit(tx *sql.Tx) error {
 
 	return err
 }
+
+// QuoteIdent - quotes an identifier (table, column) as required by the database type.
+// Quote characters inside name are escaped. For qualified names, quote each part
+func (u *DbUtils) QuoteIdent(name string) string {
+	name = strings.Replace(name, "\x00", "", -1)
+
+	switch u.dbType {
+	case MySQL:
+		return "`" + strings.Replace(name, "`", "``", -1) + "`"
+	case SQLServer:
+		return "[" + strings.Replace(name, "]", "]]", -1) + "]"
+	default:
+		return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+	}
+}
@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// LockTable - table holding the leases of DbLocker:
+//
+//	create table job_locks (
+//	    lock_name  varchar(128) not null primary key,
+//	    owner      varchar(255) not null,
+//	    expires_at timestamp    not null
+//	);
+const LockTable string = "job_locks"
+
+// DbLocker - Locker electing a leader through a lease row of the LockTable table, so it works
+// the same in all the supported databases and through the connection pool.
+// A lease is renewed every ttl/3 while held; the lease of a process which died without
+// unlocking expires after ttl and can be taken by another instance.
+// The expiry times are written with the clock of each instance, which must be in sync
+type DbLocker struct {
+	mux      sync.Mutex
+	dbutl    *DbUtils
+	owner    string
+	ttl      time.Duration
+	renewals map[string]context.CancelFunc
+	err      error
+	wg       sync.WaitGroup
+}
+
+// NewDbLocker - instantiates a DbLocker whose leases last ttl
+func NewDbLocker(dbutl *DbUtils, ttl time.Duration) *DbLocker {
+	host, _ := os.Hostname()
+
+	id, err := newExportID()
+	if err != nil {
+		id = fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return &DbLocker{
+		dbutl:    dbutl,
+		owner:    fmt.Sprintf("%s:%d:%s", host, os.Getpid(), id[:8]),
+		ttl:      ttl,
+		renewals: make(map[string]context.CancelFunc),
+	}
+}
+
+// Owner - the owner written in the lease rows of this locker (host:pid:random)
+func (l *DbLocker) Owner() string {
+	return l.owner
+}
+
+// TryLock implements the Locker interface. Takes the lease name if it is free or expired,
+// extends it if already held by this locker. Returns false if another owner holds it
+func (l *DbLocker) TryLock(ctx context.Context, name string) (bool, error) {
+	if err := checkInterval(l.ttl); err != nil {
+		return false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	now := time.Now().UTC()
+
+	// an expired lease is free
+	pq := l.dbutl.PQuery("DELETE FROM "+LockTable+" WHERE lock_name = ? AND expires_at < ?", name, now)
+	if _, err := l.dbutl.Exec(pq); err != nil {
+		return false, err
+	}
+
+	held, err := l.renew(name, now)
+	if err != nil || held {
+		if held {
+			l.startRenewal(name)
+		}
+		return held, err
+	}
+
+	pq = l.dbutl.PQuery(`
+		INSERT INTO `+LockTable+` (lock_name, owner, expires_at)
+		VALUES (?, ?, ?)
+	`, name, l.owner, now.Add(l.ttl))
+
+	_, err = l.dbutl.Exec(pq)
+	if err != nil {
+		// another instance inserted it first: the primary key was violated
+		var owner sql.NullString
+		pq = l.dbutl.PQuery("SELECT owner FROM "+LockTable+" WHERE lock_name = ?", name)
+		if qerr := l.dbutl.RunQuery(pq, &owner); qerr == nil && owner.Valid {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	l.startRenewal(name)
+
+	return true, nil
+}
+
+// Unlock implements the Locker interface. Stops the renewal and removes the lease name,
+// if held by this locker
+func (l *DbLocker) Unlock(ctx context.Context, name string) error {
+	l.mux.Lock()
+	cancel := l.renewals[name]
+	delete(l.renewals, name)
+	l.mux.Unlock()
+
+	if cancel != nil {
+		cancel()
+	}
+
+	pq := l.dbutl.PQuery("DELETE FROM "+LockTable+" WHERE lock_name = ? AND owner = ?", name, l.owner)
+	_, err := l.dbutl.Exec(pq)
+
+	return err
+}
+
+// Close - stops the renewals of the held leases, without removing them (they expire)
+func (l *DbLocker) Close() {
+	l.mux.Lock()
+	for name, cancel := range l.renewals {
+		cancel()
+		delete(l.renewals, name)
+	}
+	l.mux.Unlock()
+
+	l.wg.Wait()
+}
+
+// Err - returns the error of the last lease renewal, if any. A lease found taken by
+// another owner at renewal is reported here: the work it guarded is no longer exclusive
+func (l *DbLocker) Err() error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	return l.err
+}
+
+// renew - extends the lease name if held by this locker
+func (l *DbLocker) renew(name string, now time.Time) (bool, error) {
+	pq := l.dbutl.PQuery(`
+		UPDATE `+LockTable+` SET expires_at = ? WHERE lock_name = ? AND owner = ?
+	`, now.Add(l.ttl), name, l.owner)
+
+	res, err := l.dbutl.Exec(pq)
+	if err != nil {
+		return false, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
+
+// startRenewal - renews the lease name every ttl/3 until Unlock
+func (l *DbLocker) startRenewal(name string) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if _, ok := l.renewals[name]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	l.renewals[name] = cancel
+
+	interval := l.ttl / 3
+	if interval <= 0 {
+		interval = l.ttl
+	}
+
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-ticker.C:
+				held, err := l.renew(name, t.UTC())
+				lost := err == nil && !held
+				if lost {
+					err = fmt.Errorf("lease %s lost: taken by another owner", name)
+				}
+
+				l.mux.Lock()
+				l.err = err
+				if lost {
+					delete(l.renewals, name)
+				}
+				l.mux.Unlock()
+
+				if lost {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+}
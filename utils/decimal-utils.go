@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+)
+
+// decimalMaxScale - digits kept when binding a *big.Rat without an exact decimal representation (1/3)
+const decimalMaxScale = 38
+
+func init() {
+	RegisterConverter(reflect.TypeOf(big.Rat{}), func(src interface{}) (interface{}, error) {
+		r, err := ratFromDriver(src)
+		if err != nil || r == nil {
+			return nil, err
+		}
+		return *r, nil
+	})
+
+	RegisterConverter(reflect.TypeOf(&big.Rat{}), func(src interface{}) (interface{}, error) {
+		r, err := ratFromDriver(src)
+		if err != nil || r == nil {
+			return nil, err
+		}
+		return r, nil
+	})
+}
+
+// ratFromDriver - reads a NUMERIC / DECIMAL driver value as an exact big.Rat (nil for NULL)
+func ratFromDriver(src interface{}) (*big.Rat, error) {
+	r := new(big.Rat)
+
+	switch v := src.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		if _, ok := r.SetString(string(v)); !ok {
+			return nil, fmt.Errorf("%q is not a decimal number", v)
+		}
+	case string:
+		if _, ok := r.SetString(v); !ok {
+			return nil, fmt.Errorf("%q is not a decimal number", v)
+		}
+	case int64:
+		r.SetInt64(v)
+	case float64:
+		// the driver already returned a float, only its decimal form is exact
+		if _, ok := r.SetString(fmt.Sprint(v)); !ok {
+			return nil, fmt.Errorf("%v is not a decimal number", v)
+		}
+	default:
+		return nil, fmt.Errorf("can't read %T as a decimal number", src)
+	}
+
+	return r, nil
+}
+
+// bindDecimals - binds the *big.Rat and big.Rat args as decimal strings (exact when possible),
+// which all the databases convert to NUMERIC / DECIMAL without going through float64
+func (pq *PreparedQuery) bindDecimals() {
+	for i, arg := range pq.Args {
+		switch r := arg.(type) {
+		case *big.Rat:
+			if r != nil {
+				pq.Args[i] = decimalString(r)
+			}
+		case big.Rat:
+			pq.Args[i] = decimalString(&r)
+		}
+	}
+}
+
+// decimalString - formats r with the digits needed for an exact value (decimalMaxScale digits at most)
+func decimalString(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+
+	// a fraction has an exact decimal form if its denominator is 2^a * 5^b, using max(a, b) digits
+	d := new(big.Int).Set(r.Denom())
+	m := new(big.Int)
+	twos, fives := 0, 0
+
+	for _, f := range []struct {
+		factor int64
+		count  *int
+	}{{2, &twos}, {5, &fives}} {
+		div := big.NewInt(f.factor)
+		for {
+			q, rem := new(big.Int).QuoRem(d, div, m)
+			if rem.Sign() != 0 {
+				break
+			}
+			d = q
+			*f.count++
+		}
+	}
+
+	scale := decimalMaxScale
+	if d.Cmp(big.NewInt(1)) == 0 {
+		scale = twos
+		if fives > scale {
+			scale = fives
+		}
+	}
+
+	return r.FloatString(scale)
+}
@@ -0,0 +1,223 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+var (
+	durationType    = reflect.TypeOf(time.Duration(0))
+	durationPtrType = reflect.TypeOf(new(time.Duration))
+)
+
+// durationConverter - returns the scan converter of time.Duration and *time.Duration fields, nil for other fields.
+// Postgres intervals are read from their text form ("1 day 02:03:04.5"), Oracle INTERVAL DAY TO SECOND
+// from "+01 02:03:04.500000", TIME columns from "02:03:04" and numbers as seconds
+func durationConverter(fieldType reflect.Type) ConverterFunc {
+	if fieldType != durationType && fieldType != durationPtrType {
+		return nil
+	}
+
+	return func(src interface{}) (interface{}, error) {
+		var d time.Duration
+		var err error
+
+		switch v := src.(type) {
+		case nil:
+			return nil, nil
+		case int64:
+			d = time.Duration(v) * time.Second
+		case float64:
+			d = time.Duration(v * float64(time.Second))
+		case []byte:
+			d, err = ParseSQLDuration(string(v))
+		case string:
+			d, err = ParseSQLDuration(v)
+		default:
+			return nil, fmt.Errorf("can't read %T as a duration", src)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if fieldType == durationPtrType {
+			return &d, nil
+		}
+
+		return d, nil
+	}
+}
+
+// ParseSQLDuration - parses the text of an interval / duration column:
+// Postgres intervals ("1 year 2 mons 3 days 04:05:06.789", a year being 365.25 days and a month 30 days,
+// as in EXTRACT(EPOCH FROM ...)), Oracle INTERVAL DAY TO SECOND ("+03 04:05:06.789000"),
+// TIME values ("-838:59:59") and seconds ("3723.5")
+func ParseSQLDuration(s string) (time.Duration, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	var total time.Duration
+
+	for i := 0; i < len(fields); i++ {
+		f := fields[i]
+
+		if strings.Contains(f, ":") {
+			d, err := parseClockDuration(f)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+			}
+			total += d
+			continue
+		}
+
+		if i+1 < len(fields) && !strings.Contains(fields[i+1], ":") {
+			unit, ok := intervalUnit(fields[i+1])
+			if !ok {
+				return 0, fmt.Errorf("invalid duration %q: unknown unit %s", s, fields[i+1])
+			}
+
+			d, err := scaledDuration(f, unit)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+			}
+
+			total += d
+			i++
+			continue
+		}
+
+		// a number without unit: days before a time of day (Oracle), seconds otherwise
+		unit := time.Second
+		if i+1 < len(fields) {
+			unit = 24 * time.Hour
+
+			// the sign of an Oracle interval applies to the time too
+			if strings.HasPrefix(f, "-") && !strings.HasPrefix(fields[i+1], "-") {
+				fields[i+1] = "-" + strings.TrimPrefix(fields[i+1], "+")
+			}
+		}
+
+		d, err := scaledDuration(f, unit)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+
+		total += d
+	}
+
+	return total, nil
+}
+
+// parseClockDuration - parses [-]HH:MM[:SS[.fraction]], the hours may exceed 24
+func parseClockDuration(s string) (time.Duration, error) {
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimLeft(s, "+-")
+
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	units := []string{"h", "m", "s"}
+	var spec string
+	for i, p := range parts {
+		spec += p + units[i]
+	}
+
+	d, err := time.ParseDuration(spec)
+	if err != nil {
+		return 0, err
+	}
+
+	if neg {
+		d = -d
+	}
+
+	return d, nil
+}
+
+// scaledDuration - returns num (a decimal number) units, exactly
+func scaledDuration(num string, unit time.Duration) (time.Duration, error) {
+	num = strings.TrimPrefix(num, "+")
+
+	switch unit {
+	case time.Microsecond:
+		return time.ParseDuration(num + "us")
+	case time.Millisecond:
+		return time.ParseDuration(num + "ms")
+	case time.Second:
+		return time.ParseDuration(num + "s")
+	case time.Minute:
+		return time.ParseDuration(num + "m")
+	}
+
+	d, err := time.ParseDuration(num + "h")
+	if err != nil {
+		return 0, err
+	}
+
+	return d * (unit / time.Hour), nil
+}
+
+// intervalUnits - the interval units, with their abbreviations
+var intervalUnits = map[string]time.Duration{
+	"microsecond": time.Microsecond, "usec": time.Microsecond, "us": time.Microsecond,
+	"millisecond": time.Millisecond, "msec": time.Millisecond, "ms": time.Millisecond,
+	"second": time.Second, "sec": time.Second,
+	"minute": time.Minute, "min": time.Minute,
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"mon":   30 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"year":  8766 * time.Hour,
+}
+
+// intervalUnit - the duration of the unit u, singular or plural. The exact names are
+// matched first, so "ms" and "us" are not taken for the plural of "m" and "u"
+func intervalUnit(u string) (time.Duration, bool) {
+	u = strings.ToLower(u)
+
+	if d, ok := intervalUnits[u]; ok {
+		return d, true
+	}
+
+	d, ok := intervalUnits[strings.TrimSuffix(u, "s")]
+
+	return d, ok
+}
+
+// bindDurations - with WithDurationBinding, binds the time.Duration args as intervals
+// in Postgres ("N microseconds") and as seconds (float) in the other databases
+func (pq *PreparedQuery) bindDurations() {
+	if !pq.bindDurs {
+		return
+	}
+
+	for i, arg := range pq.Args {
+		var d time.Duration
+
+		switch v := arg.(type) {
+		case time.Duration:
+			d = v
+		case *time.Duration:
+			if v == nil {
+				continue
+			}
+			d = *v
+		default:
+			continue
+		}
+
+		if pq.DbType == Postgres {
+			pq.Args[i] = fmt.Sprintf("%d microseconds", d.Microseconds())
+		} else {
+			pq.Args[i] = d.Seconds()
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package utils
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// enumMapping - Go value <-> database value of an enum
+type enumMapping struct {
+	toDB   map[string]interface{}
+	fromDB map[string]string
+}
+
+var (
+	enumMux sync.RWMutex
+	enums   = make(map[reflect.Type]*enumMapping)
+)
+
+// parseEnumMapping - parses "goValue:dbValue;..." (ex: "active:1;disabled:0").
+// Integer database values are bound as int64, the others as strings
+func parseEnumMapping(mapping string) (*enumMapping, error) {
+	em := &enumMapping{
+		toDB:   make(map[string]interface{}),
+		fromDB: make(map[string]string),
+	}
+
+	for _, pair := range strings.Split(mapping, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid enum mapping %q: expected goValue:dbValue", pair)
+		}
+
+		goVal, dbVal := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+
+		if n, err := strconv.ParseInt(dbVal, 10, 64); err == nil {
+			em.toDB[goVal] = n
+		} else {
+			em.toDB[goVal] = dbVal
+		}
+		em.fromDB[dbVal] = goVal
+	}
+
+	if len(em.toDB) == 0 {
+		return nil, fmt.Errorf("empty enum mapping")
+	}
+
+	return em, nil
+}
+
+// RegisterEnum - registers the mapping of a string based enum type (ex: type Status string)
+// to its database values, with the syntax of the enum tag option: "active:1;disabled:0".
+// Fields of enumType are converted on Scan and args of enumType are converted when bound
+func RegisterEnum(enumType reflect.Type, mapping string) error {
+	if enumType.Kind() != reflect.String {
+		return fmt.Errorf("enum type %s is not string based", enumType)
+	}
+
+	em, err := parseEnumMapping(mapping)
+	if err != nil {
+		return err
+	}
+
+	enumMux.Lock()
+	enums[enumType] = em
+	enumMux.Unlock()
+
+	RegisterConverter(enumType, em.converter)
+
+	return nil
+}
+
+// enumConverter - returns the scan converter of the fields tagged with the enum option
+// (`sql:"status,enum=active:1;disabled:0"`), nil if the field has no enum option.
+// An invalid mapping is reported when the column is scanned
+func enumConverter(fieldType reflect.Type, tagOpts []string) ConverterFunc {
+	var mapping string
+	found := false
+
+	for _, o := range tagOpts {
+		o = strings.TrimSpace(o)
+		if strings.HasPrefix(o, "enum=") {
+			mapping = strings.TrimPrefix(o, "enum=")
+			found = true
+		}
+	}
+
+	if !found {
+		return nil
+	}
+
+	em, err := parseEnumMapping(mapping)
+	if err == nil && fieldType.Kind() != reflect.String {
+		err = fmt.Errorf("enum field of type %s is not string based", fieldType)
+	}
+
+	if err != nil {
+		return func(src interface{}) (interface{}, error) {
+			return nil, err
+		}
+	}
+
+	return em.converter
+}
+
+// converter - maps the database value to the Go value. NULL leaves the field zero
+func (em *enumMapping) converter(src interface{}) (interface{}, error) {
+	var key string
+
+	switch v := src.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		key = string(v)
+	default:
+		key = fmt.Sprint(v)
+	}
+
+	goVal, ok := em.fromDB[strings.TrimSpace(key)]
+	if !ok {
+		return nil, fmt.Errorf("unknown enum value %q", key)
+	}
+
+	return goVal, nil
+}
+
+// bindEnums - replaces the args of the registered enum types with their database values
+func (pq *PreparedQuery) bindEnums() {
+	if pq.err != nil {
+		return
+	}
+
+	enumMux.RLock()
+	defer enumMux.RUnlock()
+
+	if len(enums) == 0 {
+		return
+	}
+
+	for i, arg := range pq.Args {
+		if arg == nil {
+			continue
+		}
+
+		em, ok := enums[reflect.TypeOf(arg)]
+		if !ok {
+			continue
+		}
+
+		s := reflect.ValueOf(arg).String()
+		dbVal, ok := em.toDB[s]
+		if !ok {
+			pq.err = fmt.Errorf("arg %d: unknown %T value %q", i+1, arg, s)
+			return
+		}
+
+		pq.Args[i] = dbVal
+	}
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// QueryPreview - what Prepare did to a query
+type QueryPreview struct {
+	DbType      string        `json:"db_type"`
+	SourceQuery string        `json:"source_query"`
+	SourceArgs  []interface{} `json:"source_args"`
+	Query       string        `json:"query"`
+	Args        []interface{} `json:"args"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// Preview - returns the query and args as written and as they will be sent to the database, without running it
+func (pq *PreparedQuery) Preview() QueryPreview {
+	p := QueryPreview{
+		DbType:      pq.DbType,
+		SourceQuery: pq.SourceQuery(),
+		SourceArgs:  pq.SourceArgs(),
+		Query:       pq.Query,
+		Args:        pq.Args,
+	}
+
+	if err := pq.Err(); err != nil {
+		p.Error = err.Error()
+	}
+
+	return p
+}
+
+// String - formats the preview, one numbered argument per line
+func (p QueryPreview) String() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "-- %s\n%s\n", p.DbType, strings.TrimSpace(p.Query))
+
+	for i, arg := range p.Args {
+		fmt.Fprintf(&buf, "-- %d: %#v\n", i+1, arg)
+	}
+
+	if p.Error != "" {
+		fmt.Fprintf(&buf, "-- error: %s\n", p.Error)
+	}
+
+	return buf.String()
+}
+
+// ExplainQuery - returns the execution plan of pq, one line per row
+// (EXPLAIN, EXPLAIN QUERY PLAN, EXPLAIN PLAN FOR + DBMS_XPLAN or SET SHOWPLAN_TEXT, as
+// supported by the database). Columns of multi column plans are separated by " | "
+func (u *DbUtils) ExplainQuery(pq *PreparedQuery) ([]string, error) {
+	if err := pq.Err(); err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	// SHOWPLAN and the Oracle plan table are session settings
+	conn, err := u.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	switch u.dbType {
+	case Oracle, Oracle11g, Oci8:
+		_, err = conn.ExecContext(ctx, "EXPLAIN PLAN FOR "+pq.Query, pq.Args...)
+		if err != nil {
+			return nil, err
+		}
+
+		return explainRows(conn.QueryContext(ctx, "SELECT plan_table_output FROM TABLE(DBMS_XPLAN.DISPLAY())"))
+
+	case SQLServer:
+		_, err = conn.ExecContext(ctx, "SET SHOWPLAN_TEXT ON")
+		if err != nil {
+			return nil, err
+		}
+		defer conn.ExecContext(ctx, "SET SHOWPLAN_TEXT OFF")
+
+		return explainRows(conn.QueryContext(ctx, pq.Query, pq.Args...))
+
+	case Sqlite3:
+		return explainRows(conn.QueryContext(ctx, "EXPLAIN QUERY PLAN "+pq.Query, pq.Args...))
+	}
+
+	return explainRows(conn.QueryContext(ctx, "EXPLAIN "+pq.Query, pq.Args...))
+}
+
+// explainRows - reads all rows, joining the columns of each row
+func explainRows(rows *sql.Rows, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lines []string
+
+	// SHOWPLAN_TEXT returns a result set for each statement
+	for {
+		cols, err := rows.Columns()
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]sql.NullString, len(cols))
+		pointers := make([]interface{}, len(cols))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+
+		for rows.Next() {
+			if err := rows.Scan(pointers...); err != nil {
+				return nil, err
+			}
+
+			parts := make([]string, len(values))
+			for i, v := range values {
+				parts[i] = v.String
+			}
+			lines = append(lines, strings.Join(parts, " | "))
+		}
+
+		if !rows.NextResultSet() {
+			break
+		}
+	}
+
+	return lines, rows.Err()
+}
@@ -0,0 +1,581 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExportFormat - format of the exported rows
+type ExportFormat string
+
+const (
+	// ExportCSV - comma separated values, with a header line
+	ExportCSV ExportFormat = "csv"
+	// ExportJSONLines - one JSON object per row
+	ExportJSONLines ExportFormat = "jsonl"
+)
+
+// ExportState - state of an export job
+type ExportState string
+
+const (
+	// ExportQueued - waiting for a free worker
+	ExportQueued ExportState = "queued"
+	// ExportRunning - the query is running
+	ExportRunning ExportState = "running"
+	// ExportDone - the result can be downloaded
+	ExportDone ExportState = "done"
+	// ExportFailed - the export failed, see Error
+	ExportFailed ExportState = "failed"
+	// ExportCancelled - the export was cancelled
+	ExportCancelled ExportState = "cancelled"
+)
+
+// ErrExportNotFound - unknown (or expired) export job
+var ErrExportNotFound = errors.New("export job not found")
+
+// ErrExportNotReady - the export job has not finished successfully
+var ErrExportNotReady = errors.New("export job is not done")
+
+// ExportStorage - where export artifacts are stored (local disk, S3, etc)
+type ExportStorage interface {
+	Create(name string) (io.WriteCloser, error)
+	Open(name string) (io.ReadCloser, error)
+	Remove(name string) error
+}
+
+// LocalExportStorage - stores export artifacts in a local directory
+type LocalExportStorage struct {
+	Dir string
+}
+
+// Create - creates an artifact
+func (s LocalExportStorage) Create(name string) (io.WriteCloser, error) {
+	err := os.MkdirAll(s.Dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	return os.Create(filepath.Join(s.Dir, filepath.Base(name)))
+}
+
+// Open - opens an artifact
+func (s LocalExportStorage) Open(name string) (io.ReadCloser, error) {
+	return os.Open(filepath.Join(s.Dir, filepath.Base(name)))
+}
+
+// Remove - removes an artifact
+func (s LocalExportStorage) Remove(name string) error {
+	err := os.Remove(filepath.Join(s.Dir, filepath.Base(name)))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// ExportJobStatus - status and progress of an export job
+type ExportJobStatus struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"name"`
+	Format   ExportFormat `json:"format"`
+	State    ExportState  `json:"state"`
+	Rows     int64        `json:"rows"`
+	Error    string       `json:"error,omitempty"`
+	Created  time.Time    `json:"created"`
+	Finished time.Time    `json:"finished,omitempty"`
+}
+
+type exportJob struct {
+	status   ExportJobStatus
+	pq       *PreparedQuery
+	artifact string
+	cancel   context.CancelFunc
+	// heartbeat - the status row of the running job, if enabled (see SetHeartbeat)
+	heartbeat *Heartbeat
+}
+
+// ExportManager - runs query exports in the background. Each result is
+// stored as a zip archive and removed after its time to live
+type ExportManager struct {
+	sync.RWMutex
+	schedule
+	healthGate
+	dbutl   *DbUtils
+	storage ExportStorage
+	ttl     time.Duration
+	sem     chan struct{}
+	jobs    map[string]*exportJob
+	meter   *UsageMeter
+	beat    time.Duration
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewExportManager - instantiates an ExportManager running at most maxConcurrent exports at a time.
+// Finished exports are kept for ttl
+func NewExportManager(dbutl *DbUtils, storage ExportStorage, maxConcurrent int, ttl time.Duration) *ExportManager {
+	if maxConcurrent < 1 {
+		maxConcurrent = 1
+	}
+
+	return &ExportManager{
+		dbutl:   dbutl,
+		storage: storage,
+		ttl:     ttl,
+		sem:     make(chan struct{}, maxConcurrent),
+		jobs:    make(map[string]*exportJob),
+	}
+}
+
+// SetUsageMeter - accounts the bytes of the export archives to the consumer of their query
+func (m *ExportManager) SetUsageMeter(meter *UsageMeter) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.meter = meter
+}
+
+// SetHeartbeat - writes a Heartbeat row ("export <job id>") for each running export, updated
+// every interval with the number of rows written. 0 disables it
+func (m *ExportManager) SetHeartbeat(interval time.Duration) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.beat = interval
+}
+
+// Submit - queues the export of the rows returned by pq. Returns the job ID.
+// Expired jobs are cleaned up on each submit. New jobs are refused with ErrUnhealthy
+// while the system is unhealthy (see SetHealthChecker)
+func (m *ExportManager) Submit(name string, pq *PreparedQuery, format ExportFormat) (string, error) {
+	m.Cleanup()
+
+	if !m.healthy() {
+		return "", ErrUnhealthy
+	}
+
+	if format != ExportCSV && format != ExportJSONLines {
+		return "", fmt.Errorf("unknown export format: %s", format)
+	}
+
+	id, err := newExportID()
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	job := &exportJob{
+		status: ExportJobStatus{
+			ID:      id,
+			Name:    name,
+			Format:  format,
+			State:   ExportQueued,
+			Created: time.Now().UTC(),
+		},
+		pq:       pq,
+		artifact: id + ".zip",
+		cancel:   cancel,
+	}
+
+	m.Lock()
+	m.jobs[id] = job
+	m.Unlock()
+
+	go m.run(ctx, job)
+
+	return id, nil
+}
+
+// Status - returns the status of a job
+func (m *ExportManager) Status(id string) (ExportJobStatus, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	job, ok := m.jobs[id]
+	if !ok {
+		return ExportJobStatus{}, ErrExportNotFound
+	}
+
+	return job.status, nil
+}
+
+// Jobs - returns the status of all known jobs, newest first
+func (m *ExportManager) Jobs() []ExportJobStatus {
+	m.RLock()
+	defer m.RUnlock()
+
+	res := make([]ExportJobStatus, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		res = append(res, job.status)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Created.After(res[j].Created)
+	})
+
+	return res
+}
+
+// Cancel - cancels a queued or running job
+func (m *ExportManager) Cancel(id string) error {
+	m.RLock()
+	job, ok := m.jobs[id]
+	m.RUnlock()
+
+	if !ok {
+		return ErrExportNotFound
+	}
+
+	job.cancel()
+
+	return nil
+}
+
+// Open - opens the zip archive of a finished job
+func (m *ExportManager) Open(id string) (io.ReadCloser, error) {
+	m.RLock()
+	job, ok := m.jobs[id]
+	var state ExportState
+	if ok {
+		state = job.status.State
+	}
+	m.RUnlock()
+
+	if !ok {
+		return nil, ErrExportNotFound
+	}
+
+	if state != ExportDone {
+		return nil, ErrExportNotReady
+	}
+
+	return m.storage.Open(job.artifact)
+}
+
+// Cleanup - removes the jobs (and their artifacts) finished more than ttl ago.
+// Returns the number of removed jobs
+func (m *ExportManager) Cleanup() int {
+	limit := time.Now().UTC().Add(-m.ttl)
+	var expired []*exportJob
+
+	m.Lock()
+	for id, job := range m.jobs {
+		if !job.status.Finished.IsZero() && job.status.Finished.Before(limit) {
+			expired = append(expired, job)
+			delete(m.jobs, id)
+		}
+	}
+	m.Unlock()
+
+	for _, job := range expired {
+		m.storage.Remove(job.artifact)
+	}
+
+	return len(expired)
+}
+
+// Start - runs Cleanup every interval in the background, so the expired artifacts are
+// removed even when no job is submitted. Stop must be called to end it.
+// The cleanups are skipped while the system is unhealthy (see SetHealthChecker).
+// The artifacts left by a previous process are not known to the manager: register the
+// directory of a LocalExportStorage with RetentionRegistry.AddDir to remove them too
+func (m *ExportManager) Start(interval time.Duration) error {
+	if err := checkInterval(interval); err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if m.cancel != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.setNextRun(time.Now().Add(interval))
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-ticker.C:
+				m.setNextRun(t.Add(interval))
+				if m.healthy() {
+					m.Cleanup()
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop - stops the background cleanup
+func (m *ExportManager) Stop() {
+	m.Lock()
+	cancel := m.cancel
+	m.cancel = nil
+	m.Unlock()
+
+	if cancel != nil {
+		cancel()
+		m.wg.Wait()
+		m.setNextRun(time.Time{})
+	}
+}
+
+func (m *ExportManager) run(ctx context.Context, job *exportJob) {
+	defer job.cancel()
+
+	select {
+	case m.sem <- struct{}{}:
+		defer func() { <-m.sem }()
+	case <-ctx.Done():
+		m.finish(job, ctx.Err())
+		return
+	}
+
+	m.Lock()
+	job.status.State = ExportRunning
+	beat := m.beat
+	m.Unlock()
+
+	if beat > 0 {
+		job.heartbeat = NewHeartbeat(m.dbutl, "export "+job.status.ID, beat)
+		if err := job.heartbeat.Start(); err != nil {
+			m.finish(job, fmt.Errorf("export heartbeat: %w", err))
+			return
+		}
+	}
+
+	err := m.export(ctx, job)
+	if err != nil {
+		m.storage.Remove(job.artifact)
+	}
+
+	if job.heartbeat != nil {
+		if herr := job.heartbeat.Stop(); err == nil && herr != nil {
+			err = fmt.Errorf("export heartbeat: %w", herr)
+		}
+	}
+
+	m.finish(job, err)
+}
+
+func (m *ExportManager) finish(job *exportJob, err error) {
+	m.Lock()
+	defer m.Unlock()
+
+	job.status.Finished = time.Now().UTC()
+
+	switch {
+	case err == context.Canceled:
+		job.status.State = ExportCancelled
+	case err != nil:
+		job.status.State = ExportFailed
+		job.status.Error = err.Error()
+	default:
+		job.status.State = ExportDone
+	}
+}
+
+func (m *ExportManager) export(ctx context.Context, job *exportJob) error {
+	out, err := m.storage.Create(job.artifact)
+	if err != nil {
+		return err
+	}
+
+	n, err := m.writeArchive(ctx, job, out)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	m.RLock()
+	meter := m.meter
+	m.RUnlock()
+
+	if meter != nil {
+		meter.AddExportBytes(job.pq.consumer, n)
+	}
+
+	return nil
+}
+
+// writeArchive - writes the zip archive of job in out. Returns the number of bytes written
+func (m *ExportManager) writeArchive(ctx context.Context, job *exportJob, out io.Writer) (int64, error) {
+	cw := &countingWriter{w: out}
+	zw := NewZipWriter(cw)
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(m.writeRows(ctx, job, pw))
+	}()
+
+	err := zw.AddFromReaderContext(ctx, exportEntryName(job.status.Name, job.status.Format), pr)
+	pr.CloseWithError(err)
+	if err != nil {
+		return cw.n, err
+	}
+
+	err = zw.Close()
+
+	return cw.n, err
+}
+
+// exportEntryName - name of the archive entry of an export: the last element of name
+// (so it can't point outside the extraction folder) with the extension of format
+func exportEntryName(name string, format ExportFormat) string {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if base == "." || base == ".." || base == "/" {
+		base = "export"
+	}
+
+	return base + "." + string(format)
+}
+
+func (m *ExportManager) writeRows(ctx context.Context, job *exportJob, w io.Writer) error {
+	return writeExportRows(ctx, m.dbutl, job.pq, job.status.Format, w, func() {
+		m.Lock()
+		job.status.Rows++
+		rows := job.status.Rows
+		m.Unlock()
+
+		if job.heartbeat != nil && rows%1000 == 0 {
+			job.heartbeat.SetProgress(fmt.Sprintf("%d rows", rows))
+		}
+	})
+}
+
+// writeExportRows - writes the rows of pq in w, in format, calling onRow (if not nil) after each row
+func writeExportRows(ctx context.Context, dbutl *DbUtils, pq *PreparedQuery, format ExportFormat, w io.Writer, onRow func()) error {
+	var cw *csv.Writer
+	var enc *json.Encoder
+	var cols []string
+	var values []interface{}
+	var pointers []interface{}
+
+	if format == ExportCSV {
+		cw = csv.NewWriter(w)
+	} else {
+		enc = json.NewEncoder(w)
+	}
+
+	err := dbutl.ForEachRow(pq, func(row *sql.Rows, sc *SQLScan) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if cols == nil {
+			var err error
+			cols, err = row.Columns()
+			if err != nil {
+				return err
+			}
+
+			values = make([]interface{}, len(cols))
+			pointers = make([]interface{}, len(cols))
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+
+			if cw != nil {
+				if err = cw.Write(cols); err != nil {
+					return err
+				}
+			}
+		}
+
+		err := row.Scan(pointers...)
+		if err != nil {
+			return err
+		}
+
+		if cw != nil {
+			record := make([]string, len(cols))
+			for i, v := range values {
+				record[i] = exportValueString(v)
+			}
+			err = cw.Write(record)
+		} else {
+			obj := make(map[string]interface{}, len(cols))
+			for i, v := range values {
+				if b, ok := v.([]byte); ok {
+					v = string(b)
+				}
+				obj[cols[i]] = v
+			}
+			err = enc.Encode(obj)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if onRow != nil {
+			onRow()
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if cw != nil {
+		cw.Flush()
+		return cw.Error()
+	}
+
+	return nil
+}
+
+func exportValueString(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(val)
+	case time.Time:
+		return Date2string(val, UTCDateTimestamp)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+func newExportID() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+)
+
+// Fingerprint - returns a stable hash of the normalized source query
+// (see NormalizedQuery), usable as cache key, metrics label or slow query group
+func (pq *PreparedQuery) Fingerprint() string {
+	sum := sha1.Sum([]byte(pq.NormalizedQuery()))
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizedQuery - returns the source query with comments removed, whitespace collapsed,
+// string and numeric literals replaced by ? and keywords/identifiers lowercased.
+// The parameters are written as ? whatever their style ($1, :1, :name, @p1), so a query
+// gets the same fingerprint from PQuery, PQueryNoRewrite or with named parameters.
+// Quoted identifiers are kept as written
+func (pq *PreparedQuery) NormalizedQuery() string {
+	return normalizeQuery(pq.SourceQuery())
+}
+
+// normalizeQuery - the normalization behind NormalizedQuery and Fingerprint
+func normalizeQuery(q string) string {
+	var buf bytes.Buffer
+	space := false
+
+	writeSpace := func() {
+		if space && buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		space = false
+	}
+
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+
+		switch {
+		case IsWhiteSpace(q[i : i+1]):
+			space = true
+
+		case c == '-' && i+1 < len(q) && q[i+1] == '-':
+			for i < len(q) && q[i] != '\n' {
+				i++
+			}
+			space = true
+
+		case c == '/' && i+1 < len(q) && q[i+1] == '*':
+			i += 2
+			for i+1 < len(q) && !(q[i] == '*' && q[i+1] == '/') {
+				i++
+			}
+			i++
+			space = true
+
+		case (c == 'N' || c == 'n' || c == 'E' || c == 'e' || c == 'X' || c == 'x' || c == 'B' || c == 'b') &&
+			i+1 < len(q) && q[i+1] == '\'' && (i == 0 || !isIdentChar(q[i-1])):
+			// N'...', E'...', X'...', B'...' are literals as '...' is
+			continue
+
+		case isParamMarker(q, i):
+			i++
+			for i+1 < len(q) && isIdentChar(q[i+1]) {
+				i++
+			}
+			writeSpace()
+			buf.WriteByte('?')
+
+		case c == '\'':
+			i++
+			for i < len(q) {
+				if q[i] == '\'' {
+					if i+1 < len(q) && q[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			writeSpace()
+			buf.WriteByte('?')
+
+		case c == '"' || c == '`' || c == '[':
+			end := c
+			if c == '[' {
+				end = ']'
+			}
+
+			writeSpace()
+			start := i
+			i++
+			for i < len(q) && q[i] != end {
+				i++
+			}
+
+			if i < len(q) {
+				buf.WriteString(q[start : i+1])
+			} else {
+				buf.WriteString(q[start:])
+			}
+
+		case c >= '0' && c <= '9' && (i == 0 || !isIdentChar(q[i-1])):
+			for i+1 < len(q) && (isIdentChar(q[i+1]) || q[i+1] == '.') {
+				i++
+			}
+			writeSpace()
+			buf.WriteByte('?')
+
+		case c == ',':
+			// "a,b" and "a , b" are written as "a, b"
+			space = false
+			buf.WriteByte(c)
+			space = true
+
+		case c == ')':
+			space = false
+			buf.WriteByte(c)
+
+		case c == '(':
+			writeSpace()
+			buf.WriteByte(c)
+			for i+1 < len(q) && IsWhiteSpace(q[i+1:i+2]) {
+				i++
+			}
+
+		default:
+			writeSpace()
+			if c >= 'A' && c <= 'Z' {
+				c += 'a' - 'A'
+			}
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String()
+}
+
+// isParamMarker - q[i] starts a parameter in the $1, :1, :name or @p1 style
+func isParamMarker(q string, i int) bool {
+	c := q[i]
+	if (c != '$' && c != ':' && c != '@') || i+1 >= len(q) || (i > 0 && (isIdentChar(q[i-1]) || q[i-1] == ':')) {
+		return false
+	}
+
+	next := q[i+1]
+	if c == '$' {
+		return next >= '0' && next <= '9'
+	}
+
+	// not the :: cast of Postgres
+	return next != ':' && next != '$' && isIdentChar(next)
+}
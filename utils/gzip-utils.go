@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+)
+
+// GzipBytes - gzip compresses data, with the default level
+func GzipBytes(data []byte) ([]byte, error) {
+	return GzipBytesLevel(data, gzip.DefaultCompression)
+}
+
+// GzipBytesLevel - gzip compresses data with level: gzip.BestSpeed to gzip.BestCompression,
+// gzip.DefaultCompression, gzip.HuffmanOnly or gzip.NoCompression
+func GzipBytesLevel(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// GunzipBytes - uncompresses gzip data (the concatenated gzip members are read as one stream)
+func GunzipBytes(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return ioutil.ReadAll(r)
+}
+
+// NewGzipWriter - returns a writer gzip compressing into dest with level (see GzipBytesLevel).
+// Close must be called to flush the stream, it does not close dest
+func NewGzipWriter(dest io.Writer, level int) (*gzip.Writer, error) {
+	return gzip.NewWriterLevel(dest, level)
+}
+
+// NewGzipReader - returns a reader uncompressing src if it is gzip compressed (detected from
+// its first bytes), else reading it as it is: request bodies or log files sent either way.
+// Close does not close src
+func NewGzipReader(src io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(src)
+
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if len(magic) < 2 || magic[0] != 0x1f || magic[1] != 0x8b {
+		return ioutil.NopCloser(br), nil
+	}
+
+	return gzip.NewReader(br)
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!dragonfly,!windows
+
+package utils
+
+import (
+	"errors"
+)
+
+func diskFreeBytes(path string) (uint64, error) {
+	return 0, errors.New("disk space probe is not supported on this platform")
+}
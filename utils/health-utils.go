@@ -0,0 +1,464 @@
+package utils
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrProbeNotRun - the probe has not run yet
+var ErrProbeNotRun = errors.New("probe has not run yet")
+
+// Probe - health check of an external dependency
+type Probe interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// ProbeResult - last known state of a probe
+type ProbeResult struct {
+	Name             string    `json:"name"`
+	Healthy          bool      `json:"healthy"`
+	Error            string    `json:"error,omitempty"`
+	LastCheck        time.Time `json:"last_check"`
+	DurationMs       int64     `json:"duration_ms"`
+	ConsecutiveFails int       `json:"consecutive_fails"`
+}
+
+type registeredProbe struct {
+	probe     Probe
+	interval  time.Duration
+	timeout   time.Duration
+	threshold int
+	result    ProbeResult
+}
+
+// HealthChecker - runs probes at their own intervals and keeps their results.
+// A probe is considered unhealthy after threshold consecutive failures
+type HealthChecker struct {
+	sync.RWMutex
+	probes []*registeredProbe
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewHealthChecker - instantiates a HealthChecker
+func NewHealthChecker() *HealthChecker {
+	return &HealthChecker{}
+}
+
+// checkInterval - checks the interval of a background task, time.NewTicker panics if not positive
+func checkInterval(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid interval: %s", interval)
+	}
+	return nil
+}
+
+// AddProbe - registers a probe run every interval. Each check is given at most timeout to finish.
+// threshold is the number of consecutive failures after which the probe is unhealthy (min 1)
+func (h *HealthChecker) AddProbe(p Probe, interval time.Duration, timeout time.Duration, threshold int) error {
+	if err := checkInterval(interval); err != nil {
+		return err
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	if threshold < 1 {
+		threshold = 1
+	}
+
+	h.probes = append(h.probes, &registeredProbe{
+		probe:     p,
+		interval:  interval,
+		timeout:   timeout,
+		threshold: threshold,
+		result: ProbeResult{
+			Name:  p.Name(),
+			Error: ErrProbeNotRun.Error(),
+		},
+	})
+
+	return nil
+}
+
+// Start - starts running the probes in the background. Stop must be called to end them
+func (h *HealthChecker) Start() {
+	h.Lock()
+	defer h.Unlock()
+
+	if h.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+
+	for _, rp := range h.probes {
+		h.wg.Add(1)
+		go h.run(ctx, rp)
+	}
+}
+
+// Stop - stops the background probes
+func (h *HealthChecker) Stop() {
+	h.Lock()
+	cancel := h.cancel
+	h.cancel = nil
+	h.Unlock()
+
+	if cancel != nil {
+		cancel()
+		h.wg.Wait()
+	}
+}
+
+// CheckNow - runs all probes once, synchronously
+func (h *HealthChecker) CheckNow(ctx context.Context) {
+	h.RLock()
+	probes := h.probes
+	h.RUnlock()
+
+	for _, rp := range probes {
+		h.check(ctx, rp)
+	}
+}
+
+func (h *HealthChecker) run(ctx context.Context, rp *registeredProbe) {
+	defer h.wg.Done()
+
+	ticker := time.NewTicker(rp.interval)
+	defer ticker.Stop()
+
+	for {
+		h.check(ctx, rp)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *HealthChecker) check(ctx context.Context, rp *registeredProbe) {
+	cctx := ctx
+	if rp.timeout > 0 {
+		var cancel context.CancelFunc
+		cctx, cancel = context.WithTimeout(ctx, rp.timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := rp.probe.Check(cctx)
+	elapsed := time.Since(start)
+
+	h.Lock()
+	defer h.Unlock()
+
+	r := &rp.result
+	r.LastCheck = start.UTC()
+	r.DurationMs = int64(elapsed / time.Millisecond)
+
+	if err != nil {
+		r.Error = err.Error()
+		r.ConsecutiveFails++
+		if r.ConsecutiveFails >= rp.threshold {
+			r.Healthy = false
+		}
+	} else {
+		r.Error = ""
+		r.ConsecutiveFails = 0
+		r.Healthy = true
+	}
+}
+
+// Results - returns the last results of all probes
+func (h *HealthChecker) Results() []ProbeResult {
+	h.RLock()
+	defer h.RUnlock()
+
+	res := make([]ProbeResult, len(h.probes))
+	for i, rp := range h.probes {
+		res[i] = rp.result
+	}
+
+	return res
+}
+
+// Healthy - true if all probes are healthy
+func (h *HealthChecker) Healthy() bool {
+	h.RLock()
+	defer h.RUnlock()
+
+	for _, rp := range h.probes {
+		if !rp.result.Healthy {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ErrUnhealthy - the work was refused because the HealthChecker reports the system unhealthy
+var ErrUnhealthy = errors.New("system unhealthy")
+
+// healthGate - lets the background runners skip their scheduled work while the system is
+// unhealthy. Embedded by RetentionRegistry, Heartbeat, UsageMeter and ExportManager
+type healthGate struct {
+	gateMux sync.RWMutex
+	health  *HealthChecker
+}
+
+// SetHealthChecker - skips the scheduled runs while h reports the system unhealthy
+// (see HealthChecker.Healthy). nil runs them whatever the health
+func (g *healthGate) SetHealthChecker(h *HealthChecker) {
+	g.gateMux.Lock()
+	defer g.gateMux.Unlock()
+
+	g.health = h
+}
+
+// healthy - true if there is no HealthChecker or all its probes are healthy
+func (g *healthGate) healthy() bool {
+	g.gateMux.RLock()
+	h := g.health
+	g.gateMux.RUnlock()
+
+	return h == nil || h.Healthy()
+}
+
+// ServeHTTP - readiness endpoint. Writes the probe results as JSON,
+// with status 200 if all probes are healthy and 503 otherwise
+func (h *HealthChecker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := http.StatusOK
+	if !h.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(h.Results())
+}
+
+// ProbeFunc - adapts a function to the Probe interface
+type ProbeFunc struct {
+	ProbeName string
+	Func      func(ctx context.Context) error
+}
+
+// Name - probe name
+func (p ProbeFunc) Name() string {
+	return p.ProbeName
+}
+
+// Check - runs the function
+func (p ProbeFunc) Check(ctx context.Context) error {
+	return p.Func(ctx)
+}
+
+// DbProbe - checks the database connection
+type DbProbe struct {
+	dbutl *DbUtils
+}
+
+// NewDbProbe - instantiates a database probe
+func NewDbProbe(dbutl *DbUtils) *DbProbe {
+	return &DbProbe{dbutl: dbutl}
+}
+
+// Name - probe name
+func (p *DbProbe) Name() string {
+	return "database"
+}
+
+// Check - pings the database
+func (p *DbProbe) Check(ctx context.Context) error {
+	if p.dbutl.db == nil {
+		return errors.New("database not connected")
+	}
+
+	return p.dbutl.db.PingContext(ctx)
+}
+
+// HTTPProbe - checks that an HTTP dependency answers with a 2xx status
+type HTTPProbe struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// NewHTTPProbe - instantiates an HTTP dependency probe
+func NewHTTPProbe(name string, url string) *HTTPProbe {
+	return &HTTPProbe{
+		name:   name,
+		url:    url,
+		client: &http.Client{},
+	}
+}
+
+// Name - probe name
+func (p *HTTPProbe) Name() string {
+	return p.name
+}
+
+// Check - requests the url
+func (p *HTTPProbe) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// SMTPProbe - checks that an SMTP server accepts connections and greets
+type SMTPProbe struct {
+	addr string
+}
+
+// NewSMTPProbe - instantiates an SMTP probe. addr is host:port
+func NewSMTPProbe(addr string) *SMTPProbe {
+	return &SMTPProbe{addr: addr}
+}
+
+// Name - probe name
+func (p *SMTPProbe) Name() string {
+	return "smtp " + p.addr
+}
+
+// Check - connects and reads the 220 greeting
+func (p *SMTPProbe) Check(ctx context.Context) error {
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", p.addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return err
+	}
+
+	if !strings.HasPrefix(line, "220") {
+		return fmt.Errorf("unexpected greeting: %s", strings.TrimSpace(line))
+	}
+
+	conn.Write([]byte("QUIT\r\n"))
+
+	return nil
+}
+
+// DiskSpaceProbe - checks that a path has a minimum of free disk space
+type DiskSpaceProbe struct {
+	path     string
+	minBytes uint64
+}
+
+// NewDiskSpaceProbe - instantiates a disk space probe
+func NewDiskSpaceProbe(path string, minBytes uint64) *DiskSpaceProbe {
+	return &DiskSpaceProbe{
+		path:     path,
+		minBytes: minBytes,
+	}
+}
+
+// Name - probe name
+func (p *DiskSpaceProbe) Name() string {
+	return "disk " + p.path
+}
+
+// Check - reads the free space
+func (p *DiskSpaceProbe) Check(ctx context.Context) error {
+	free, err := diskFreeBytes(p.path)
+	if err != nil {
+		return err
+	}
+
+	if free < p.minBytes {
+		return fmt.Errorf("free space %d bytes is below %d bytes", free, p.minBytes)
+	}
+
+	return nil
+}
+
+// ClockSkewProbe - compares the local clock with the Date header of an HTTP server
+type ClockSkewProbe struct {
+	url     string
+	maxSkew time.Duration
+	client  *http.Client
+}
+
+// NewClockSkewProbe - instantiates a clock skew probe
+func NewClockSkewProbe(url string, maxSkew time.Duration) *ClockSkewProbe {
+	return &ClockSkewProbe{
+		url:     url,
+		maxSkew: maxSkew,
+		client:  &http.Client{},
+	}
+}
+
+// Name - probe name
+func (p *ClockSkewProbe) Name() string {
+	return "clock skew"
+}
+
+// Check - reads the remote time and compares it with the local time
+func (p *ClockSkewProbe) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, p.url, nil)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	end := time.Now()
+
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return err
+	}
+
+	// the Date header has a one second resolution
+	local := start.Add(end.Sub(start) / 2).Truncate(time.Second)
+	skew := local.Sub(remote)
+	if skew < 0 {
+		skew = -skew
+	}
+
+	if skew > p.maxSkew {
+		return fmt.Errorf("clock skew %v exceeds %v", skew, p.maxSkew)
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// HeartbeatTable - table holding the status rows of running jobs:
+//
+//	create table job_heartbeat (
+//	    job_name   varchar(128) not null primary key,
+//	    host       varchar(255) not null,
+//	    started_at timestamp    not null,
+//	    last_seen  timestamp    not null,
+//	    progress   varchar(255) not null
+//	);
+const HeartbeatTable string = "job_heartbeat"
+
+// HeartbeatStatus - status row of a running job
+type HeartbeatStatus struct {
+	JobName   string    `sql:"job_name" json:"job_name"`
+	Host      string    `sql:"host" json:"host"`
+	StartedAt time.Time `sql:"started_at" json:"started_at"`
+	LastSeen  time.Time `sql:"last_seen" json:"last_seen"`
+	Progress  string    `sql:"progress" json:"progress"`
+}
+
+// Heartbeat - while a long running job is in progress, periodically updates its status row
+// (last_seen, progress, host) so operators can see stuck jobs. The row is removed by Stop
+type Heartbeat struct {
+	sync.RWMutex
+	schedule
+	healthGate
+	dbutl    *DbUtils
+	name     string
+	host     string
+	interval time.Duration
+	progress string
+	err      error
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewHeartbeat - instantiates a Heartbeat for the job name, updating its row every interval
+func NewHeartbeat(dbutl *DbUtils, name string, interval time.Duration) *Heartbeat {
+	host, _ := os.Hostname()
+
+	return &Heartbeat{
+		dbutl:    dbutl,
+		name:     name,
+		host:     host,
+		interval: interval,
+		progress: "started",
+	}
+}
+
+// Start - writes the status row and starts the periodic updates.
+// The updates are skipped while the system is unhealthy (see SetHealthChecker)
+func (h *Heartbeat) Start() error {
+	if err := checkInterval(h.interval); err != nil {
+		return err
+	}
+
+	h.Lock()
+	defer h.Unlock()
+
+	if h.cancel != nil {
+		return nil
+	}
+
+	now := time.Now().UTC()
+
+	tx, err := h.dbutl.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer h.dbutl.Rollback(tx)
+
+	pq := h.dbutl.PQuery("DELETE FROM "+HeartbeatTable+" WHERE job_name = ?", h.name)
+	_, err = h.dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return err
+	}
+
+	pq = h.dbutl.PQuery(`
+		INSERT INTO `+HeartbeatTable+` (job_name, host, started_at, last_seen, progress)
+		VALUES (?, ?, ?, ?, ?)
+	`, h.name, h.host, now, now, h.progress)
+
+	_, err = h.dbutl.ExecTx(tx, pq)
+	if err != nil {
+		return err
+	}
+
+	// without the row the beats would update nothing
+	if err := h.dbutl.Commit(tx); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h.cancel = cancel
+	h.setNextRun(time.Now().Add(h.interval))
+
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+
+		ticker := time.NewTicker(h.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-ticker.C:
+				h.setNextRun(t.Add(h.interval))
+				if h.healthy() {
+					h.beat()
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// SetProgress - sets the progress written with the next beat
+func (h *Heartbeat) SetProgress(progress string) {
+	h.Lock()
+	defer h.Unlock()
+
+	h.progress = progress
+}
+
+// Progress - sets the progress as "done/total". Usable as BatchProgress
+// (ex: dbutl.DeleteByKeys(table, keyCol, keys, 0, hb.Progress))
+func (h *Heartbeat) Progress(done, total int) {
+	h.SetProgress(fmt.Sprintf("%d/%d", done, total))
+}
+
+// Err - returns the error of the last update, if any
+func (h *Heartbeat) Err() error {
+	h.RLock()
+	defer h.RUnlock()
+
+	return h.err
+}
+
+// Stop - stops the periodic updates and removes the status row
+func (h *Heartbeat) Stop() error {
+	h.Lock()
+	cancel := h.cancel
+	h.cancel = nil
+	h.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	h.wg.Wait()
+	h.setNextRun(time.Time{})
+
+	pq := h.dbutl.PQuery("DELETE FROM "+HeartbeatTable+" WHERE job_name = ?", h.name)
+	_, err := h.dbutl.Exec(pq)
+
+	return err
+}
+
+func (h *Heartbeat) beat() {
+	h.RLock()
+	progress := h.progress
+	h.RUnlock()
+
+	pq := h.dbutl.PQuery(`
+		UPDATE `+HeartbeatTable+` SET last_seen = ?, progress = ? WHERE job_name = ?
+	`, time.Now().UTC(), progress, h.name)
+
+	_, err := h.dbutl.Exec(pq)
+
+	h.Lock()
+	h.err = err
+	h.Unlock()
+}
+
+// Heartbeats - returns the status rows of the running jobs. Jobs whose LastSeen is older
+// than a few intervals are probably stuck (or their process died)
+func Heartbeats(dbutl *DbUtils) ([]HeartbeatStatus, error) {
+	var res []HeartbeatStatus
+
+	pq := dbutl.PQuery(`
+		SELECT job_name, host, started_at, last_seen, progress
+		  FROM ` + HeartbeatTable + `
+		 ORDER BY job_name
+	`)
+
+	err := dbutl.ForEachRow(pq, func(row *sql.Rows, sc *SQLScan) error {
+		var s HeartbeatStatus
+		if err := sc.Scan(dbutl, row, &s); err != nil {
+			return err
+		}
+
+		res = append(res, s)
+		return nil
+	})
+
+	return res, err
+}
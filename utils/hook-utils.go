@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"database/sql"
+	"time"
+)
+
+// QueryEvent - a query run by DbUtils (Exec, RunQuery, ForEachRow and their Tx variants)
+type QueryEvent struct {
+	Query    *PreparedQuery
+	Start    time.Time
+	Duration time.Duration
+	// Exec - true for Exec (Rows are written rows), false for queries (Rows are read rows)
+	Exec bool
+	// Rows - rows affected by Exec, rows read by RunQuery and ForEachRow, -1 if unknown
+	Rows int64
+	Err  error
+}
+
+// QueryHook - called after each query run by DbUtils.
+// Hooks are called synchronously, so they should be fast
+type QueryHook func(ev *QueryEvent)
+
+// AddQueryHook - adds a hook called after each query
+func (u *DbUtils) AddQueryHook(h QueryHook) {
+	u.hookMux.Lock()
+	defer u.hookMux.Unlock()
+
+	u.hooks = append(u.hooks, h)
+}
+
+// afterQuery - runs the query hooks
+func (u *DbUtils) afterQuery(pq *PreparedQuery, start time.Time, rows int64, err error) {
+	u.runHooks(pq, start, false, rows, err)
+}
+
+func (u *DbUtils) runHooks(pq *PreparedQuery, start time.Time, exec bool, rows int64, err error) {
+	u.hookMux.RLock()
+	hooks := u.hooks
+	u.hookMux.RUnlock()
+
+	if len(hooks) == 0 {
+		return
+	}
+
+	ev := &QueryEvent{
+		Query:    pq,
+		Start:    start,
+		Duration: time.Since(start),
+		Exec:     exec,
+		Rows:     rows,
+		Err:      err,
+	}
+
+	for _, h := range hooks {
+		h(ev)
+	}
+}
+
+// afterExec - runs the query hooks for an Exec
+func (u *DbUtils) afterExec(pq *PreparedQuery, start time.Time, res sql.Result, err error) {
+	rows := int64(-1)
+	if err == nil && res != nil {
+		if n, err2 := res.RowsAffected(); err2 == nil {
+			rows = n
+		}
+	}
+
+	u.runHooks(pq, start, true, rows, err)
+}
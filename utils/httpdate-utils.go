@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"net/http"
+	"time"
+)
+
+// FormatHTTPDate - formats t as an IMF-fixdate (RFC 7231), in UTC: "Sun, 06 Nov 1994 08:49:37 GMT",
+// for the Last-Modified, Expires and If-Modified-Since headers
+func FormatHTTPDate(t time.Time) string {
+	return t.UTC().Format(HTTPDate)
+}
+
+// ParseHTTPDate - parses an HTTP date: an IMF-fixdate, or the obsolete RFC 850 and asctime formats
+// the servers must still accept
+func ParseHTTPDate(s string) (time.Time, error) {
+	return http.ParseTime(s)
+}
+
+// SetCacheHeaders - sets Last-Modified to modTime (the HTTP dates have no fractions of seconds)
+// and, unless already set, Cache-Control to "private, no-cache": the client keeps the response
+// (ex: a zip export) but revalidates it with If-Modified-Since (see NotModified)
+func SetCacheHeaders(w http.ResponseWriter, modTime time.Time) {
+	h := w.Header()
+
+	if !modTime.IsZero() {
+		h.Set("Last-Modified", FormatHTTPDate(modTime))
+	}
+
+	if h.Get("Cache-Control") == "" {
+		h.Set("Cache-Control", "private, no-cache")
+	}
+}
+
+// SetExpires - sets the Expires header to t
+func SetExpires(w http.ResponseWriter, t time.Time) {
+	w.Header().Set("Expires", FormatHTTPDate(t))
+}
+
+// NotModified - checks the If-Modified-Since header of a GET or HEAD request against modTime and,
+// if the client copy is current, replies 304 Not Modified and returns true: the handler is done.
+// The header is ignored when the request has If-None-Match (RFC 7232), or modTime is zero
+func NotModified(w http.ResponseWriter, r *http.Request, modTime time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	ims := r.Header.Get("If-Modified-Since")
+	if ims == "" || r.Header.Get("If-None-Match") != "" || modTime.IsZero() {
+		return false
+	}
+
+	since, err := ParseHTTPDate(ims)
+	if err != nil {
+		return false
+	}
+
+	// the header has a second precision
+	if modTime.Truncate(time.Second).After(since) {
+		return false
+	}
+
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	if h.Get("Last-Modified") == "" {
+		h.Set("Last-Modified", FormatHTTPDate(modTime))
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+
+	return true
+}
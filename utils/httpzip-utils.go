@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// ZipResponse - a zip archive sent in an http response as its entries are added,
+// with no Content-Length: the archive is never buffered whole in memory
+type ZipResponse struct {
+	*ZipWriter
+	w  http.ResponseWriter
+	cw *countingWriter
+}
+
+// NewZipResponse - instantiates a ZipResponse writing in w, downloaded as filename
+// (sets Content-Type and Content-Disposition). Close must be called to send the central directory
+func NewZipResponse(w http.ResponseWriter, filename string) *ZipResponse {
+	h := w.Header()
+	h.Set("Content-Type", "application/zip")
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+
+	cw := &countingWriter{w: w}
+
+	return &ZipResponse{ZipWriter: NewZipWriter(cw), w: w, cw: cw}
+}
+
+// Sent - reports if a part of the archive was sent: the response status can no longer change
+func (z *ZipResponse) Sent() bool {
+	z.RLock()
+	defer z.RUnlock()
+
+	return z.cw.n > 0
+}
+
+// ServeZip - replies with the zip archive filename, whose entries are added by fn.
+// The entries are sent as they are added. If fn fails before anything was sent, the reply is
+// a 500 Internal Server Error, after it the archive is left truncated (with no central directory),
+// so the client sees it as corrupt. The error is returned, for logging
+func ServeZip(w http.ResponseWriter, r *http.Request, filename string, fn func(ctx context.Context, z *ZipResponse) error) error {
+	z := NewZipResponse(w, filename)
+
+	err := fn(r.Context(), z)
+	if err == nil {
+		err = z.Close()
+	}
+
+	if err != nil && !z.Sent() {
+		h := w.Header()
+		h.Del("Content-Type")
+		h.Del("Content-Disposition")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+
+	return err
+}
+
+// AddExport - adds the entry name with the rows returned by pq, in format (as the ExportManager
+// exports), streamed from the query
+func (z *ZipWriter) AddExport(name string, dbutl *DbUtils, pq *PreparedQuery, format ExportFormat) error {
+	return z.AddExportContext(context.Background(), name, dbutl, pq, format)
+}
+
+// AddExportContext - adds the entry name with the rows returned by pq, stops if ctx is done
+func (z *ZipWriter) AddExportContext(ctx context.Context, name string, dbutl *DbUtils, pq *PreparedQuery, format ExportFormat) error {
+	if format != ExportCSV && format != ExportJSONLines {
+		return fmt.Errorf("unknown export format: %s", format)
+	}
+
+	pr, pw := io.Pipe()
+
+	go func() {
+		pw.CloseWithError(writeExportRows(ctx, dbutl, pq, format, pw, nil))
+	}()
+
+	err := z.AddFromReaderContext(ctx, name, pr)
+	pr.CloseWithError(err)
+
+	return err
+}
@@ -0,0 +1,177 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var identPlaceholderRegexp = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// Identifiers - values of the {{name}} placeholders of a query template, placeholder name -> table name
+type Identifiers map[string]string
+
+// ErrIdentifierNotAllowed - the identifier is not in the whitelist
+var ErrIdentifierNotAllowed = errors.New("identifier not allowed")
+
+// AllowIdentifiers - adds table names (optionally qualified by the schema) to the
+// whitelist used by PQueryTemplate. Names are folded as the database folds unquoted
+// identifiers (uppercase in Oracle, lowercase in Postgres)
+func (u *DbUtils) AllowIdentifiers(names ...string) error {
+	for _, name := range names {
+		if !identRegexp.MatchString(name) {
+			return fmt.Errorf("invalid identifier: %s", name)
+		}
+	}
+
+	u.identMux.Lock()
+	defer u.identMux.Unlock()
+
+	if u.allowedIdents == nil {
+		u.allowedIdents = make(map[string]string)
+	}
+
+	for _, name := range names {
+		switch u.dbType {
+		case Oracle, Oracle11g, Oci8:
+			name = strings.ToUpper(name)
+		case Postgres:
+			name = strings.ToLower(name)
+		}
+
+		u.allowedIdents[strings.ToLower(name)] = name
+	}
+
+	return nil
+}
+
+// AllowSchemaTables - adds the tables and views of the current database (schema) to the
+// whitelist used by PQueryTemplate, both as "table" and as "schema.table"
+func (u *DbUtils) AllowSchemaTables() error {
+	var query string
+
+	switch u.dbType {
+	case Postgres:
+		query = `
+			SELECT table_schema, table_name FROM information_schema.tables
+			 WHERE table_schema NOT IN ('pg_catalog', 'information_schema')
+		`
+	case MySQL:
+		query = `
+			SELECT table_schema, table_name FROM information_schema.tables
+			 WHERE table_schema = DATABASE()
+		`
+	case SQLServer:
+		query = "SELECT table_schema, table_name FROM information_schema.tables"
+	case Oracle, Oracle11g, Oci8:
+		query = `
+			SELECT USER, table_name FROM user_tables
+			UNION ALL
+			SELECT USER, view_name FROM user_views
+		`
+	case Sqlite3:
+		query = "SELECT 'main', name FROM sqlite_master WHERE type IN ('table', 'view')"
+	}
+
+	tables := make(map[string]string)
+
+	err := u.ForEachRow(u.PQuery(query), func(row *sql.Rows, sc *SQLScan) error {
+		var schema, table string
+		if err := row.Scan(&schema, &table); err != nil {
+			return err
+		}
+
+		// names needing quotes can't be used in templates
+		if !identRegexp.MatchString(schema) || !identRegexp.MatchString(table) {
+			return nil
+		}
+
+		tables[strings.ToLower(table)] = table
+		tables[strings.ToLower(schema+"."+table)] = schema + "." + table
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	u.identMux.Lock()
+	defer u.identMux.Unlock()
+
+	if u.allowedIdents == nil {
+		u.allowedIdents = make(map[string]string)
+	}
+
+	for k, v := range tables {
+		u.allowedIdents[k] = v
+	}
+
+	return nil
+}
+
+// PQueryTemplate - replaces the {{name}} placeholders of query with the quoted identifiers
+// from idents, then prepares it as PQuery does. Each identifier must be in the whitelist
+// (see AllowIdentifiers and AllowSchemaTables); any error is returned by Exec, RunQuery, etc.
+//
+//	Ex: dbutl.PQueryTemplate("DELETE FROM {{table}} WHERE log_time < ?", utils.Identifiers{"table": archive}, limit)
+func (u *DbUtils) PQueryTemplate(query string, idents Identifiers, args ...interface{}) *PreparedQuery {
+	q, err := u.substituteIdentifiers(query, idents)
+	if err != nil {
+		return &PreparedQuery{
+			DbType:      u.dbType,
+			ParamPrefix: u.prefix,
+			Query:       query,
+			Args:        args,
+			prepared:    true,
+			srcQuery:    query,
+			srcArgs:     args,
+			err:         err,
+		}
+	}
+
+	return u.PQuery(q, args...)
+}
+
+func (u *DbUtils) substituteIdentifiers(query string, idents Identifiers) (string, error) {
+	var err error
+
+	q := identPlaceholderRegexp.ReplaceAllStringFunc(query, func(m string) string {
+		if err != nil {
+			return m
+		}
+
+		key := identPlaceholderRegexp.FindStringSubmatch(m)[1]
+		name, ok := idents[key]
+		if !ok {
+			err = fmt.Errorf("no identifier for placeholder {{%s}}", key)
+			return m
+		}
+
+		var quoted string
+		quoted, err = u.quoteAllowedIdent(name)
+
+		return quoted
+	})
+
+	return q, err
+}
+
+// quoteAllowedIdent - quotes name, as stored in the whitelist, each part separately
+func (u *DbUtils) quoteAllowedIdent(name string) (string, error) {
+	u.identMux.RLock()
+	canonical, ok := u.allowedIdents[strings.ToLower(name)]
+	u.identMux.RUnlock()
+
+	if !ok || !identRegexp.MatchString(name) {
+		return "", fmt.Errorf("%w: %s", ErrIdentifierNotAllowed, name)
+	}
+
+	parts := strings.Split(canonical, ".")
+	for i, p := range parts {
+		parts[i] = u.QuoteIdent(p)
+	}
+
+	return strings.Join(parts, "."), nil
+}
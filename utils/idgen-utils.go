@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IDGenerator - generates the primary key values of inserted rows
+type IDGenerator interface {
+	NextID(tx *sql.Tx) (interface{}, error)
+}
+
+type tableIDGenerator struct {
+	column string
+	gen    IDGenerator
+}
+
+// SetIDGenerator - sets the generator used by the insert helpers for the column of table
+func (u *DbUtils) SetIDGenerator(table string, column string, gen IDGenerator) {
+	u.idMux.Lock()
+	defer u.idMux.Unlock()
+
+	if u.idGens == nil {
+		u.idGens = make(map[string]tableIDGenerator)
+	}
+
+	u.idGens[strings.ToLower(table)] = tableIDGenerator{
+		column: column,
+		gen:    gen,
+	}
+}
+
+// InsertTx - inserts row (column name -> value) in table. If an IDGenerator is set for the table
+// and row has no value for its column, a new ID is generated. Returns the generated ID, if any
+func (u *DbUtils) InsertTx(tx *sql.Tx, table string, row map[string]interface{}) (interface{}, error) {
+	if !identRegexp.MatchString(table) {
+		return nil, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	id, row, err := u.assignID(tx, table, row)
+	if err != nil {
+		return nil, err
+	}
+
+	cols := make([]string, 0, len(row))
+	for col := range row {
+		if !identRegexp.MatchString(col) {
+			return nil, fmt.Errorf("invalid column name: %s", col)
+		}
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+
+	params := make([]string, len(cols))
+	args := make([]interface{}, len(cols))
+	for i, col := range cols {
+		params[i] = "?"
+		args[i] = row[col]
+	}
+
+	pq := u.PQuery(fmt.Sprintf(
+		"INSERT INTO %s (%s) VALUES (%s)",
+		table,
+		strings.Join(cols, ", "),
+		strings.Join(params, ", "),
+	), args...)
+
+	_, err = u.ExecTx(tx, pq)
+	if err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+// assignID - returns a copy of row with a generated ID, if needed
+func (u *DbUtils) assignID(tx *sql.Tx, table string, row map[string]interface{}) (interface{}, map[string]interface{}, error) {
+	u.idMux.RLock()
+	g, ok := u.idGens[strings.ToLower(table)]
+	u.idMux.RUnlock()
+
+	if !ok {
+		return nil, row, nil
+	}
+
+	if val, ok := row[g.column]; ok && val != nil {
+		return nil, row, nil
+	}
+
+	id, err := g.gen.NextID(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nrow := make(map[string]interface{}, len(row)+1)
+	for col, val := range row {
+		nrow[col] = val
+	}
+	nrow[g.column] = id
+
+	return id, nrow, nil
+}
+
+// SequenceIDGenerator - takes IDs from a database sequence (emulated in MySQL and SQLite)
+type SequenceIDGenerator struct {
+	dbutl    *DbUtils
+	sequence string
+}
+
+// NewSequenceIDGenerator - instantiates a SequenceIDGenerator
+func NewSequenceIDGenerator(dbutl *DbUtils, sequence string) *SequenceIDGenerator {
+	return &SequenceIDGenerator{
+		dbutl:    dbutl,
+		sequence: sequence,
+	}
+}
+
+// NextID - returns the next sequence value (see DbUtils.NextSequenceValueTx).
+// In SQLite tx must not be nil
+func (g *SequenceIDGenerator) NextID(tx *sql.Tx) (interface{}, error) {
+	id, err := g.dbutl.NextSequenceValueTx(tx, g.sequence)
+	if err != nil {
+		return nil, err
+	}
+
+	return id, nil
+}
+
+// UUIDv7Generator - generates time ordered UUIDs (RFC 9562 version 7) as strings
+type UUIDv7Generator struct{}
+
+// NextID - returns a new UUIDv7
+func (g UUIDv7Generator) NextID(tx *sql.Tx) (interface{}, error) {
+	return NewUUIDv7()
+}
+
+// NewUUIDv7 - returns a new version 7 UUID in its canonical string form
+func NewUUIDv7() (string, error) {
+	var b [16]byte
+
+	_, err := rand.Read(b[6:])
+	if err != nil {
+		return "", err
+	}
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = (b[6] & 0x0f) | 0x70
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	h := hex.EncodeToString(b[:])
+
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:], nil
+}
+
+// ULIDGenerator - generates ULIDs (lexicographically sortable, 26 characters)
+type ULIDGenerator struct{}
+
+// NextID - returns a new ULID
+func (g ULIDGenerator) NextID(tx *sql.Tx) (interface{}, error) {
+	return NewULID()
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID - returns a new ULID
+func NewULID() (string, error) {
+	var b [16]byte
+
+	_, err := rand.Read(b[6:])
+	if err != nil {
+		return "", err
+	}
+
+	ms := uint64(time.Now().UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint16(b[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(b[2:6], uint32(ms))
+
+	// 128 bits encoded as 26 characters of 5 bits, the first one holding 3 bits
+	hi := binary.BigEndian.Uint64(b[0:8])
+	lo := binary.BigEndian.Uint64(b[8:16])
+
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = crockfordAlphabet[lo&0x1f]
+		lo = (lo >> 5) | (hi << 59)
+		hi >>= 5
+	}
+
+	return string(out), nil
+}
+
+// SnowflakeEpoch - epoch of the Snowflake IDs (2020-01-01 UTC)
+var SnowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SnowflakeGenerator - generates 63 bit IDs made of 41 bits of milliseconds since SnowflakeEpoch,
+// 10 bits of node ID and a 12 bit sequence
+type SnowflakeGenerator struct {
+	mux    sync.Mutex
+	node   int64
+	lastMs int64
+	seq    int64
+}
+
+// NewSnowflakeGenerator - instantiates a SnowflakeGenerator for node (0 - 1023)
+func NewSnowflakeGenerator(node int64) (*SnowflakeGenerator, error) {
+	if node < 0 || node > 1023 {
+		return nil, errors.New("node must be between 0 and 1023")
+	}
+
+	return &SnowflakeGenerator{node: node}, nil
+}
+
+// NextID - returns a new Snowflake ID
+func (g *SnowflakeGenerator) NextID(tx *sql.Tx) (interface{}, error) {
+	return g.Next(), nil
+}
+
+// Next - returns a new Snowflake ID
+func (g *SnowflakeGenerator) Next() int64 {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	ms := int64(time.Since(SnowflakeEpoch) / time.Millisecond)
+	if ms < g.lastMs {
+		// the clock went backwards, keep using the last timestamp
+		ms = g.lastMs
+	}
+
+	if ms == g.lastMs {
+		g.seq = (g.seq + 1) & 0xfff
+		if g.seq == 0 {
+			// sequence exhausted for this millisecond
+			for ms <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				ms = int64(time.Since(SnowflakeEpoch) / time.Millisecond)
+			}
+		}
+	} else {
+		g.seq = 0
+	}
+
+	g.lastMs = ms
+
+	return (ms << 22) | (g.node << 12) | g.seq
+}
@@ -0,0 +1,388 @@
+package utils
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// inPredicate - location of an "expr [NOT] IN (?)" predicate in a query
+type inPredicate struct {
+	start int
+	end   int
+	expr  string
+	not   bool
+	// array - "expr = ANY (?)" or "expr <> ALL (?)" instead of IN
+	array bool
+}
+
+// expandInLists - expands slice arguments bound to "IN (?)" into one placeholder per item.
+// An empty list makes "expr IN (?)" false and "expr NOT IN (?)" true.
+// "expr = ANY (?)" and "expr <> ALL (?)" bind the slice as an array in Postgres and are
+// rewritten as "expr IN (...)" and "expr NOT IN (...)" in the other databases.
+// In Oracle, lists longer than OracleMaxInListSize are split into OR-ed (AND-ed for NOT IN) groups,
+// each repeating the expression (and its args).
+// Lists longer than the threshold of DbUtils.SetInListTempTableThreshold (or all of them, with
+// WithTempTableInLists) are written as "expr IN (SELECT v FROM temp table)" instead; DbUtils
+// fills the temp table in the session running the query (see withTempLists).
+func (pq *PreparedQuery) expandInLists() {
+	hasList := false
+	for _, arg := range pq.Args {
+		if isListArg(arg) {
+			hasList = true
+			break
+		}
+	}
+
+	if !hasList {
+		return
+	}
+
+	maxItems := 0
+	switch pq.DbType {
+	case Oracle, Oracle11g, Oci8:
+		maxItems = OracleMaxInListSize
+	}
+
+	// Oracle 11g has no private temporary tables
+	if pq.forceTempLists && pq.DbType == Oracle11g {
+		pq.err = fmt.Errorf("temp table IN lists are not supported in %s", pq.DbType)
+		return
+	}
+
+	var qbuf bytes.Buffer
+	q := pq.Query
+	args := make([]interface{}, 0, len(pq.Args))
+	argIdx := 0
+	last := 0
+
+	for i := 0; i < len(q); i++ {
+		if q[i] != '?' {
+			continue
+		}
+
+		if i+1 < len(q) && q[i+1] == '?' {
+			i++
+			continue
+		}
+
+		if argIdx >= len(pq.Args) {
+			break
+		}
+
+		arg := pq.Args[argIdx]
+		argIdx++
+
+		if !isListArg(arg) {
+			args = append(args, arg)
+			continue
+		}
+
+		items, err := sliceToArgs(listItems(arg))
+		if err != nil {
+			pq.err = err
+			return
+		}
+
+		pred, ok := findInPredicate(q, i)
+
+		// Postgres binds the slice as an array
+		if ok && pred.array && pq.DbType == Postgres {
+			args = append(args, postgresArray(items))
+			continue
+		}
+
+		if !ok || pred.start < last {
+			qbuf.WriteString(q[last:i])
+			qbuf.WriteString(listPlaceholders(len(items)))
+			last = i + 1
+			args = append(args, items...)
+			continue
+		}
+
+		qbuf.WriteString(q[last:pred.start])
+		last = pred.end
+		i = pred.end - 1
+
+		// the args of the placeholders in the expression were already added;
+		// they are dropped with an empty list and repeated for each Oracle group
+		exprArgs := make([]interface{}, countPlaceholders(pred.expr))
+		copy(exprArgs, args[len(args)-len(exprArgs):])
+		args = args[:len(args)-len(exprArgs)]
+
+		switch {
+		case len(items) == 0 && pred.not:
+			qbuf.WriteString("1 = 1")
+		case len(items) == 0:
+			qbuf.WriteString("1 = 0")
+		case pq.useTempList(len(items)):
+			name, err := tempListName(pq.DbType)
+			if err != nil {
+				pq.err = err
+				return
+			}
+
+			qbuf.WriteString(tempListPredicate(pred, name))
+			args = append(args, exprArgs...)
+			pq.tempLists = append(pq.tempLists, tempList{name: name, items: items})
+		case maxItems == 0 || len(items) <= maxItems:
+			qbuf.WriteString(inListPredicate(pred, len(items)))
+			args = append(args, exprArgs...)
+			args = append(args, items...)
+		default:
+			groups := make([]string, 0, len(items)/maxItems+1)
+			for k := 0; k < len(items); k += maxItems {
+				n := maxItems
+				if k+n > len(items) {
+					n = len(items) - k
+				}
+				groups = append(groups, inListPredicate(pred, n))
+				args = append(args, exprArgs...)
+				args = append(args, items[k:k+n]...)
+			}
+
+			sep := " OR "
+			if pred.not {
+				sep = " AND "
+			}
+
+			qbuf.WriteString("(" + strings.Join(groups, sep) + ")")
+		}
+	}
+
+	qbuf.WriteString(q[last:])
+	args = append(args, pq.Args[argIdx:]...)
+
+	pq.Query = qbuf.String()
+	pq.Args = args
+}
+
+func inListPredicate(pred inPredicate, n int) string {
+	op := " IN ("
+	if pred.not {
+		op = " NOT IN ("
+	}
+
+	return pred.expr + op + listPlaceholders(n) + ")"
+}
+
+// tempListPredicate - "expr [NOT] IN (SELECT v FROM name)"
+func tempListPredicate(pred inPredicate, name string) string {
+	op := " IN ("
+	if pred.not {
+		op = " NOT IN ("
+	}
+
+	return pred.expr + op + "SELECT v FROM " + name + ")"
+}
+
+func listPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// ListArg - array or byte slice to be expanded as a list, see InList
+type ListArg struct {
+	Items interface{}
+}
+
+// InList - marks items to be expanded in "IN (?)" like a slice. Needed for arrays
+// and byte slices, which are otherwise bound as a single value
+// (ex: a [16]byte UUID, net.IP, json.RawMessage)
+func InList(items interface{}) ListArg {
+	return ListArg{Items: items}
+}
+
+// isListArg - checks if arg is a slice to be expanded (or an InList).
+// driver.Valuer, arrays and slices / arrays of bytes are bound as a single value
+func isListArg(arg interface{}) bool {
+	if arg == nil {
+		return false
+	}
+
+	if _, ok := arg.(ListArg); ok {
+		return true
+	}
+
+	if _, ok := arg.(driver.Valuer); ok {
+		return false
+	}
+
+	t := reflect.TypeOf(arg)
+
+	return t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8
+}
+
+// listItems - the slice or array of a list arg
+func listItems(arg interface{}) interface{} {
+	if l, ok := arg.(ListArg); ok {
+		return l.Items
+	}
+
+	return arg
+}
+
+// findInPredicate - finds the "expr [NOT] IN (?)", "expr = ANY (?)" or "expr <> ALL (?)" predicate around the placeholder at pos
+func findInPredicate(q string, pos int) (inPredicate, bool) {
+	pred := inPredicate{}
+
+	end := skipSpacesForward(q, pos+1)
+	if end >= len(q) || q[end] != ')' {
+		return pred, false
+	}
+	pred.end = end + 1
+
+	j := skipSpacesBackward(q, pos-1)
+	if j < 0 || q[j] != '(' {
+		return pred, false
+	}
+
+	j = skipSpacesBackward(q, j-1)
+	switch {
+	case endsWithWord(q, j, "IN"):
+		j = skipSpacesBackward(q, j-len("IN"))
+		if endsWithWord(q, j, "NOT") {
+			pred.not = true
+			j = skipSpacesBackward(q, j-len("NOT"))
+		}
+	case endsWithWord(q, j, "ANY"):
+		j = skipSpacesBackward(q, j-len("ANY"))
+		if j < 1 || q[j] != '=' || strings.IndexByte("<>!", q[j-1]) >= 0 {
+			return pred, false
+		}
+		pred.array = true
+		j = skipSpacesBackward(q, j-1)
+	case endsWithWord(q, j, "ALL"):
+		j = skipSpacesBackward(q, j-len("ALL"))
+		if j < 1 || (q[j-1:j+1] != "<>" && q[j-1:j+1] != "!=") {
+			return pred, false
+		}
+		pred.array = true
+		pred.not = true
+		j = skipSpacesBackward(q, j-2)
+	default:
+		return pred, false
+	}
+
+	exprEnd := j + 1
+	exprStart := exprStartBackward(q, j)
+	if exprStart >= exprEnd {
+		return pred, false
+	}
+
+	pred.start = exprStart
+	pred.expr = q[exprStart:exprEnd]
+
+	return pred, true
+}
+
+// exprStartBackward - returns the start of the simple expression (column, qualified column
+// or function call) ending at q[j]. Returns j+1 if there is none
+func exprStartBackward(q string, j int) int {
+	if j >= 0 && q[j] == ')' {
+		depth := 0
+		for ; j >= 0; j-- {
+			if q[j] == ')' {
+				depth++
+			} else if q[j] == '(' {
+				depth--
+				if depth == 0 {
+					j--
+					break
+				}
+			}
+		}
+	}
+
+	for j >= 0 && (isIdentChar(q[j]) || q[j] == '.' || q[j] == '"' || q[j] == '`') {
+		j--
+	}
+
+	return j + 1
+}
+
+func skipSpacesForward(q string, i int) int {
+	for i < len(q) && IsWhiteSpace(q[i:i+1]) {
+		i++
+	}
+	return i
+}
+
+func skipSpacesBackward(q string, i int) int {
+	for i >= 0 && IsWhiteSpace(q[i:i+1]) {
+		i--
+	}
+	return i
+}
+
+// endsWithWord - checks if q[:i+1] ends with the keyword word (case insensitive)
+func endsWithWord(q string, i int, word string) bool {
+	start := i - len(word) + 1
+	if start < 0 || !strings.EqualFold(q[start:i+1], word) {
+		return false
+	}
+
+	return start == 0 || !isIdentChar(q[start-1])
+}
+
+// postgresArray - slice bound as a Postgres array, in its text form: {1,2,"a b"}
+type postgresArray []interface{}
+
+// Value - implements driver.Valuer
+func (a postgresArray) Value() (driver.Value, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+
+	for i, item := range a {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		switch v := item.(type) {
+		case nil:
+			buf.WriteString("NULL")
+		case bool:
+			if v {
+				buf.WriteString("t")
+			} else {
+				buf.WriteString("f")
+			}
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			fmt.Fprint(&buf, v)
+		case time.Time:
+			writeArrayString(&buf, v.Format(time.RFC3339Nano))
+		case []byte:
+			writeArrayString(&buf, `\x`+hex.EncodeToString(v))
+		case driver.Valuer:
+			dv, err := v.Value()
+			if err != nil {
+				return nil, err
+			}
+			if dv == nil {
+				buf.WriteString("NULL")
+			} else {
+				writeArrayString(&buf, fmt.Sprint(dv))
+			}
+		default:
+			writeArrayString(&buf, fmt.Sprint(v))
+		}
+	}
+
+	buf.WriteString("}")
+
+	return buf.String(), nil
+}
+
+func writeArrayString(buf *bytes.Buffer, s string) {
+	buf.WriteString(`"`)
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	buf.WriteString(`"`)
+}
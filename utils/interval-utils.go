@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+var intervalRegexp = regexp.MustCompile(`(?i)([+-])\s*INTERVAL\s+\?\s+(SECOND|MINUTE|HOUR|DAY|WEEK|MONTH|YEAR)S?\b`)
+
+// translateIntervals - translates "expr +/- INTERVAL ? UNIT" (UNIT one of SECOND, MINUTE,
+// HOUR, DAY, WEEK, MONTH, YEAR) into the date arithmetic of the database type.
+// In SQL Server and SQLite expr is limited to a column, a qualified column or a function call
+// and, in SQL Server, must not contain parameters
+func (pq *PreparedQuery) translateIntervals() {
+	q := pq.Query
+	matches := intervalRegexp.FindAllStringSubmatchIndex(q, -1)
+	if matches == nil {
+		return
+	}
+
+	var qbuf bytes.Buffer
+	last := 0
+
+	for _, m := range matches {
+		op := q[m[2]:m[3]]
+		unit := strings.ToUpper(q[m[4]:m[5]])
+
+		switch pq.DbType {
+		case Postgres:
+			qbuf.WriteString(q[last:m[0]])
+			qbuf.WriteString(op + " (? * INTERVAL '1 " + unit + "')")
+
+		case Oracle, Oracle11g, Oci8:
+			qbuf.WriteString(q[last:m[0]])
+			qbuf.WriteString(op + " " + oracleInterval(unit))
+
+		case SQLServer, Sqlite3:
+			exprEnd := skipSpacesBackward(q, m[0]-1) + 1
+			exprStart := exprStartBackward(q, exprEnd-1)
+			if exprStart >= exprEnd || exprStart < last {
+				continue
+			}
+
+			expr := q[exprStart:exprEnd]
+			qbuf.WriteString(q[last:exprStart])
+
+			if pq.DbType == SQLServer {
+				sign := ""
+				if op == "-" {
+					sign = "-"
+				}
+				qbuf.WriteString("DATEADD(" + unit + ", " + sign + "?, " + expr + ")")
+			} else {
+				qbuf.WriteString(sqliteInterval(expr, op, unit))
+			}
+
+		default:
+			// MySQL supports the canonical form, only the unit is normalized
+			qbuf.WriteString(q[last:m[0]])
+			qbuf.WriteString(op + " INTERVAL ? " + unit)
+		}
+
+		last = m[1]
+	}
+
+	qbuf.WriteString(q[last:])
+	pq.Query = qbuf.String()
+}
+
+func oracleInterval(unit string) string {
+	switch unit {
+	case "WEEK":
+		return "NUMTODSINTERVAL(? * 7, 'DAY')"
+	case "MONTH", "YEAR":
+		return "NUMTOYMINTERVAL(?, '" + unit + "')"
+	default:
+		return "NUMTODSINTERVAL(?, '" + unit + "')"
+	}
+}
+
+func sqliteInterval(expr string, op string, unit string) string {
+	amount := "?"
+	if unit == "WEEK" {
+		amount = "(? * 7)"
+		unit = "DAY"
+	}
+
+	modifier := amount + " || ' " + strings.ToLower(unit) + "s'"
+	if op == "-" {
+		modifier = "'-' || " + modifier
+	}
+
+	return "strftime('%Y-%m-%d %H:%M:%f', " + expr + ", " + modifier + ")"
+}
@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var isoDurationRegexp = regexp.MustCompile(`^([+-])?P(?:(\d+)Y)?(?:(\d+)M)?(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+(?:[.,]\d+)?)H)?(?:(\d+(?:[.,]\d+)?)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+
+// ISODuration - an ISO 8601 duration (P1Y2M3DT4H5M6.5S). The years, months, weeks and days are
+// calendar units, whose length depends on the date they are added to (see AddTo)
+type ISODuration struct {
+	Negative bool
+	Years    int
+	Months   int
+	Weeks    int
+	Days     int
+	// Time - the hours, minutes and seconds (the part after T)
+	Time time.Duration
+}
+
+// ParseISODuration - parses an ISO 8601 duration: P1DT2H30M, PT0.5S, P2W, -P1M.
+// Fractions are accepted for the hours, minutes and seconds
+func ParseISODuration(s string) (ISODuration, error) {
+	var d ISODuration
+
+	str := strings.TrimSpace(s)
+
+	m := isoDurationRegexp.FindStringSubmatch(str)
+	if m == nil || strings.HasSuffix(str, "T") {
+		return d, fmt.Errorf("invalid ISO 8601 duration %q", s)
+	}
+
+	d.Negative = m[1] == "-"
+
+	dateParts := []*int{&d.Years, &d.Months, &d.Weeks, &d.Days}
+	for i, p := range dateParts {
+		if m[i+2] == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return d, fmt.Errorf("invalid ISO 8601 duration %q: %w", s, err)
+		}
+		*p = n
+	}
+
+	timeUnits := []time.Duration{time.Hour, time.Minute, time.Second}
+	found := false
+	for i, unit := range timeUnits {
+		num := m[i+6]
+		if num == "" {
+			continue
+		}
+		found = true
+
+		v, err := scaledDuration(strings.Replace(num, ",", ".", 1), unit)
+		if err != nil {
+			return d, fmt.Errorf("invalid ISO 8601 duration %q: %w", s, err)
+		}
+		d.Time += v
+	}
+
+	if !found && m[2] == "" && m[3] == "" && m[4] == "" && m[5] == "" {
+		return d, fmt.Errorf("invalid ISO 8601 duration %q", s)
+	}
+
+	return d, nil
+}
+
+// AddTo - adds the duration to t: the calendar units as in time.AddDate, then the time
+func (d ISODuration) AddTo(t time.Time) time.Time {
+	sign := 1
+	if d.Negative {
+		sign = -1
+	}
+
+	t = t.AddDate(sign*d.Years, sign*d.Months, sign*(7*d.Weeks+d.Days))
+	return t.Add(time.Duration(sign) * d.Time)
+}
+
+// Duration - returns the duration as elapsed time, a day being 24 hours.
+// Durations with years or months have no fixed length and return an error
+func (d ISODuration) Duration() (time.Duration, error) {
+	if d.Years != 0 || d.Months != 0 {
+		return 0, fmt.Errorf("ISO 8601 duration %s has years or months, its length depends on the date", d)
+	}
+
+	total := time.Duration(7*d.Weeks+d.Days)*24*time.Hour + d.Time
+	if d.Negative {
+		total = -total
+	}
+
+	return total, nil
+}
+
+// String - formats the duration as ISO 8601 (P0D when empty)
+func (d ISODuration) String() string {
+	var b strings.Builder
+
+	if d.Negative {
+		b.WriteString("-")
+	}
+	b.WriteString("P")
+
+	units := []struct {
+		n    int
+		unit string
+	}{{d.Years, "Y"}, {d.Months, "M"}, {d.Weeks, "W"}, {d.Days, "D"}}
+
+	for _, u := range units {
+		if u.n != 0 {
+			b.WriteString(strconv.Itoa(u.n) + u.unit)
+		}
+	}
+
+	if d.Time != 0 {
+		b.WriteString("T" + formatISOTime(d.Time))
+	} else if b.Len() <= 2 {
+		b.WriteString("0D")
+	}
+
+	return b.String()
+}
+
+// FormatISODuration - formats d as an ISO 8601 duration of hours, minutes and seconds
+// (26h30m -> PT26H30M, as days are not always 24 hours long)
+func FormatISODuration(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "PT0S"
+	case d < 0:
+		return "-PT" + formatISOTime(-d)
+	default:
+		return "PT" + formatISOTime(d)
+	}
+}
+
+func formatISOTime(d time.Duration) string {
+	var b strings.Builder
+
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+
+	if h > 0 {
+		b.WriteString(strconv.FormatInt(int64(h), 10) + "H")
+	}
+	if m > 0 {
+		b.WriteString(strconv.FormatInt(int64(m), 10) + "M")
+	}
+	if d > 0 {
+		// seconds, with the fraction without trailing zeros
+		secs := strconv.FormatFloat(d.Seconds(), 'f', 9, 64)
+		secs = strings.TrimRight(strings.TrimRight(secs, "0"), ".")
+		b.WriteString(secs + "S")
+	}
+
+	return b.String()
+}
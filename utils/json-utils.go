@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// translateJSON - translates JSON_VALUE(expr, '$.path') into the JSON extraction of the database type:
+// expr #>> '{path}' in Postgres (jsonb_path_query_first when the path is a parameter),
+// JSON_UNQUOTE(JSON_EXTRACT(...)) in MySQL and json_extract in SQLite.
+// SQL Server and Oracle 12c+ support JSON_VALUE, Oracle 11g has no JSON support
+func (pq *PreparedQuery) translateJSON() {
+	pq.rewriteCalls("JSON_VALUE", func(pos int, args []string) (string, error) {
+		if len(args) != 2 {
+			return "", fmt.Errorf("JSON_VALUE expects 2 arguments (expr, path), got %d", len(args))
+		}
+
+		expr, path := args[0], args[1]
+
+		switch pq.DbType {
+		case Postgres:
+			if keys, ok := jsonPathKeys(path); ok {
+				return "(" + expr + " #>> '{" + strings.Join(keys, ",") + "}')", nil
+			}
+			return "(jsonb_path_query_first(" + expr + "::jsonb, " + path + "::jsonpath) #>> '{}')", nil
+		case MySQL:
+			return "JSON_UNQUOTE(JSON_EXTRACT(" + expr + ", " + path + "))", nil
+		case Sqlite3:
+			return "json_extract(" + expr + ", " + path + ")", nil
+		case Oracle11g:
+			return "", fmt.Errorf("JSON_VALUE is not supported in Oracle 11g")
+		default:
+			return "JSON_VALUE(" + expr + ", " + path + ")", nil
+		}
+	})
+}
+
+// jsonPathKeys - splits the literal path '$.a.b[0]' into the keys of a Postgres text array (a, b, 0).
+// Returns false for parameters and paths using filters or wildcards
+func jsonPathKeys(path string) ([]string, bool) {
+	if len(path) < 3 || path[0] != '\'' || path[len(path)-1] != '\'' {
+		return nil, false
+	}
+
+	p := path[1 : len(path)-1]
+	if !strings.HasPrefix(p, "$") {
+		return nil, false
+	}
+	p = p[1:]
+
+	var keys []string
+
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			if strings.HasPrefix(p, `"`) {
+				end := strings.IndexByte(p[1:], '"')
+				if end < 0 {
+					return nil, false
+				}
+				keys = append(keys, `"`+p[1:end+1]+`"`)
+				p = p[end+2:]
+				continue
+			}
+
+			end := 0
+			for end < len(p) && isIdentChar(p[end]) {
+				end++
+			}
+			if end == 0 {
+				return nil, false
+			}
+			keys = append(keys, p[:end])
+			p = p[end:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, false
+			}
+
+			idx := p[1:end]
+			if idx == "" || strings.Trim(idx, "0123456789") != "" {
+				return nil, false
+			}
+			keys = append(keys, idx)
+			p = p[end+1:]
+		default:
+			return nil, false
+		}
+	}
+
+	return keys, len(keys) > 0
+}
+
+// bindJSONArgs - binds the map and struct args (and pointers to them) as JSON text.
+// time.Time, driver.Valuer, sql.Out and sql.NamedArg args are left as they are
+func (pq *PreparedQuery) bindJSONArgs() {
+	if pq.err != nil {
+		return
+	}
+
+	for i, arg := range pq.Args {
+		if !isJSONArg(arg) {
+			continue
+		}
+
+		b, err := json.Marshal(arg)
+		if err != nil {
+			pq.err = fmt.Errorf("arg %d can't be bound as JSON: %w", i+1, err)
+			return
+		}
+
+		pq.Args[i] = string(b)
+	}
+}
+
+func isJSONArg(arg interface{}) bool {
+	switch arg.(type) {
+	case nil, time.Time, *time.Time, driver.Valuer, sql.Out, sql.NamedArg, ListArg:
+		return false
+	}
+
+	v := reflect.ValueOf(arg)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return false
+		}
+		v = v.Elem()
+	}
+
+	return v.Kind() == reflect.Map || v.Kind() == reflect.Struct
+}
+
+// jsonConverter - returns the scan converter of the fields tagged with the json option:
+// the text or binary (jsonb) column is unmarshaled into a new value of the field type.
+// NULL leaves the field zero
+func jsonConverter(fieldType reflect.Type) ConverterFunc {
+	return func(src interface{}) (interface{}, error) {
+		var b []byte
+
+		switch v := src.(type) {
+		case nil:
+			return nil, nil
+		case []byte:
+			b = v
+		case string:
+			b = []byte(v)
+		default:
+			return nil, fmt.Errorf("can't read %T as JSON", src)
+		}
+
+		dest := reflect.New(fieldType)
+		if err := json.Unmarshal(b, dest.Interface()); err != nil {
+			return nil, err
+		}
+
+		return dest.Elem().Interface(), nil
+	}
+}
+
+// JSON - wraps an arg so it is bound as its JSON text.
+// Map and struct args are bound as JSON anyway; JSON is needed for slices
+// (which would otherwise be expanded by IN (?)) and for values implementing driver.Valuer
+func JSON(v interface{}) driver.Valuer {
+	return jsonArg{v: v}
+}
+
+type jsonArg struct {
+	v interface{}
+}
+
+// Value implements the driver Valuer interface.
+func (a jsonArg) Value() (driver.Value, error) {
+	if a.v == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(a.v)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,293 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+var strftimeLayouts = map[byte]string{
+	'Y': "2006",
+	'y': "06",
+	'm': "01",
+	'd': "02",
+	'e': "_2",
+	'H': "15",
+	'I': "03",
+	'l': "3",
+	'M': "04",
+	'S': "05",
+	'p': "PM",
+	'b': "Jan",
+	'h': "Jan",
+	'B': "January",
+	'a': "Mon",
+	'A': "Monday",
+	'Z': "MST",
+	'z': "-0700",
+	'f': "000000",
+	'L': "000",
+	'F': "2006-01-02",
+	'T': "15:04:05",
+	'R': "15:04",
+	'D': "01/02/06",
+	'n': "\n",
+	't': "\t",
+}
+
+// strftime flags removing the padding (%-d, GNU)
+var strftimeUnpadded = map[byte]string{
+	'm': "1",
+	'd': "2",
+	'I': "3",
+	'M': "4",
+	'S': "5",
+}
+
+var javaLayouts = map[string]string{
+	"yyyy": "2006",
+	"yy":   "06",
+	"y":    "2006",
+	"MMMM": "January",
+	"MMM":  "Jan",
+	"MM":   "01",
+	"M":    "1",
+	"dd":   "02",
+	"d":    "2",
+	"EEEE": "Monday",
+	"EEE":  "Mon",
+	"E":    "Mon",
+	"HH":   "15",
+	"H":    "15",
+	"hh":   "03",
+	"h":    "3",
+	"mm":   "04",
+	"m":    "4",
+	"ss":   "05",
+	"s":    "5",
+	"a":    "PM",
+	"z":    "MST",
+	"zzzz": "MST",
+	"Z":    "-0700",
+	"X":    "Z07",
+	"XX":   "Z0700",
+	"XXX":  "Z07:00",
+	"x":    "-07",
+	"xx":   "-0700",
+	"xxx":  "-07:00",
+}
+
+var dotNetLayouts = map[string]string{
+	"yyyy": "2006",
+	"yy":   "06",
+	"MMMM": "January",
+	"MMM":  "Jan",
+	"MM":   "01",
+	"M":    "1",
+	"dddd": "Monday",
+	"ddd":  "Mon",
+	"dd":   "02",
+	"d":    "2",
+	"HH":   "15",
+	"H":    "15",
+	"hh":   "03",
+	"h":    "3",
+	"mm":   "04",
+	"m":    "4",
+	"ss":   "05",
+	"s":    "5",
+	"tt":   "PM",
+	"zzz":  "-07:00",
+	"zz":   "-07",
+	"K":    "Z07:00",
+}
+
+// StrftimeToLayout - translates a strftime pattern ("%Y-%m-%d %H:%M") into a Go layout
+// usable with Date2string and String2date. %-d style unpadded flags are accepted
+func StrftimeToLayout(pattern string) (string, error) {
+	var layout, literal strings.Builder
+
+	flush := func() error {
+		if err := checkLayoutLiteral(literal.String(), pattern); err != nil {
+			return err
+		}
+		layout.WriteString(literal.String())
+		literal.Reset()
+		return nil
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] != '%' {
+			literal.WriteByte(pattern[i])
+			continue
+		}
+
+		i++
+		if i >= len(pattern) {
+			return "", fmt.Errorf("pattern %q ends with %%", pattern)
+		}
+
+		if pattern[i] == '%' {
+			literal.WriteByte('%')
+			continue
+		}
+
+		if err := flush(); err != nil {
+			return "", err
+		}
+
+		table := strftimeLayouts
+		if pattern[i] == '-' && i+1 < len(pattern) {
+			i++
+			table = strftimeUnpadded
+		}
+
+		l, ok := table[pattern[i]]
+		if !ok {
+			return "", fmt.Errorf("pattern %q: unsupported directive %%%c", pattern, pattern[i])
+		}
+
+		if (pattern[i] == 'f' || pattern[i] == 'L') && !endsWithFractionSeparator(layout.String()) {
+			return "", fmt.Errorf("pattern %q: the fractional seconds must follow a . or a ,", pattern)
+		}
+
+		layout.WriteString(l)
+	}
+
+	if err := flush(); err != nil {
+		return "", err
+	}
+
+	return layout.String(), nil
+}
+
+// JavaToLayout - translates a Java (DateTimeFormatter / SimpleDateFormat) pattern ("yyyy-MM-dd HH:mm")
+// into a Go layout. Text between single quotes is literal, a doubled single quote is a literal quote
+func JavaToLayout(pattern string) (string, error) {
+	return letterPatternToLayout(pattern, javaLayouts, 'S', false)
+}
+
+// DotNetToLayout - translates a .NET custom format ("dd.MM.yyyy HH:mm:ss.fff") into a Go layout.
+// Text between single or double quotes, characters escaped with \ and the other letters are literal
+func DotNetToLayout(pattern string) (string, error) {
+	return letterPatternToLayout(pattern, dotNetLayouts, 'f', true)
+}
+
+// letterPatternToLayout - translates the patterns made of runs of letters (Java, .NET).
+// fraction is the letter of the fractional seconds
+func letterPatternToLayout(pattern string, table map[string]string, fraction byte, dotNet bool) (string, error) {
+	var layout, literal strings.Builder
+
+	flush := func() error {
+		if err := checkLayoutLiteral(literal.String(), pattern); err != nil {
+			return err
+		}
+		layout.WriteString(literal.String())
+		literal.Reset()
+		return nil
+	}
+
+	isLetter := func(c byte) bool {
+		return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+
+		switch {
+		case !dotNet && c == '\'' && i+1 < len(pattern) && pattern[i+1] == '\'':
+			// '' is a quote
+			literal.WriteByte('\'')
+			i++
+		case c == '\'' || (dotNet && c == '"'):
+			j := i + 1
+			for ; j < len(pattern); j++ {
+				if pattern[j] != c {
+					literal.WriteByte(pattern[j])
+					continue
+				}
+
+				if !dotNet && j+1 < len(pattern) && pattern[j+1] == c {
+					literal.WriteByte(c)
+					j++
+					continue
+				}
+
+				break
+			}
+
+			if j >= len(pattern) {
+				return "", fmt.Errorf("pattern %q: unterminated quote", pattern)
+			}
+			i = j
+		case dotNet && c == '\\' && i+1 < len(pattern):
+			i++
+			literal.WriteByte(pattern[i])
+		case isLetter(c):
+			j := i
+			for j < len(pattern) && pattern[j] == c {
+				j++
+			}
+			run := pattern[i:j]
+
+			if err := flush(); err != nil {
+				return "", err
+			}
+
+			l, ok := table[run]
+			switch {
+			case ok:
+			case c == fraction || (dotNet && c == 'F'):
+				// fractional seconds: 0 keeps the trailing zeros, 9 trims them
+				digit := "0"
+				if c == 'F' {
+					digit = "9"
+				}
+				l = strings.Repeat(digit, len(run))
+
+				if !endsWithFractionSeparator(layout.String()) {
+					return "", fmt.Errorf("pattern %q: the fractional seconds must follow a . or a ,", pattern)
+				}
+			case dotNet:
+				// .NET copies the other letters as they are
+				literal.WriteString(run)
+				i = j - 1
+				continue
+			default:
+				return "", fmt.Errorf("pattern %q: unsupported field %s", pattern, run)
+			}
+
+			layout.WriteString(l)
+			i = j - 1
+		default:
+			literal.WriteByte(c)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return "", err
+	}
+
+	return layout.String(), nil
+}
+
+// the literal text that would be read as a layout element by the time package
+var layoutWords = []string{"January", "Jan", "Monday", "Mon", "MST", "PM", "pm"}
+
+func checkLayoutLiteral(literal string, pattern string) error {
+	if strings.ContainsAny(literal, "0123456789") {
+		return fmt.Errorf("pattern %q: literal %q contains digits, they would be read as a layout element", pattern, literal)
+	}
+
+	for _, w := range layoutWords {
+		if strings.Contains(literal, w) {
+			return fmt.Errorf("pattern %q: literal %q would be read as the layout element %s", pattern, literal, w)
+		}
+	}
+
+	return nil
+}
+
+// endsWithFractionSeparator - the time package only reads fractional seconds after a . or a ,
+func endsWithFractionSeparator(layout string) bool {
+	return strings.HasSuffix(layout, ".") || strings.HasSuffix(layout, ",")
+}
@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// DateLocale - the month and day names of a language, used by Date2string and String2date
+// in place of the English names of the layout elements January, Jan, Monday and Mon
+type DateLocale struct {
+	Months      [12]string
+	ShortMonths [12]string
+	// Days - the names of the days, starting with Sunday (as time.Weekday)
+	Days      [7]string
+	ShortDays [7]string
+}
+
+var (
+	// LocaleEN - English
+	LocaleEN = &DateLocale{
+		Months:      [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		ShortMonths: [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		Days:        [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		ShortDays:   [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	}
+	// LocaleRO - Romanian
+	LocaleRO = &DateLocale{
+		Months:      [12]string{"ianuarie", "februarie", "martie", "aprilie", "mai", "iunie", "iulie", "august", "septembrie", "octombrie", "noiembrie", "decembrie"},
+		ShortMonths: [12]string{"ian", "feb", "mar", "apr", "mai", "iun", "iul", "aug", "sep", "oct", "noi", "dec"},
+		Days:        [7]string{"duminică", "luni", "marți", "miercuri", "joi", "vineri", "sâmbătă"},
+		ShortDays:   [7]string{"dum", "lun", "mar", "mie", "joi", "vin", "sâm"},
+	}
+	// LocaleIT - Italian
+	LocaleIT = &DateLocale{
+		Months:      [12]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio", "agosto", "settembre", "ottobre", "novembre", "dicembre"},
+		ShortMonths: [12]string{"gen", "feb", "mar", "apr", "mag", "giu", "lug", "ago", "set", "ott", "nov", "dic"},
+		Days:        [7]string{"domenica", "lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato"},
+		ShortDays:   [7]string{"dom", "lun", "mar", "mer", "gio", "ven", "sab"},
+	}
+)
+
+var (
+	dateLocalesMux sync.RWMutex
+	dateLocales    = map[string]*DateLocale{
+		"en": LocaleEN,
+		"ro": LocaleRO,
+		"it": LocaleIT,
+	}
+)
+
+// RegisterDateLocale - registers (or replaces) the locale name ("fr", "de-CH"), usable with
+// Date2string and String2date
+func RegisterDateLocale(name string, locale *DateLocale) {
+	dateLocalesMux.Lock()
+	defer dateLocalesMux.Unlock()
+
+	dateLocales[strings.ToLower(name)] = locale
+}
+
+// GetDateLocale - returns the locale registered as name. A missing region falls back
+// to the language: "it-CH" is "it" unless registered
+func GetDateLocale(name string) (*DateLocale, bool) {
+	dateLocalesMux.RLock()
+	defer dateLocalesMux.RUnlock()
+
+	name = strings.ToLower(strings.Replace(name, "_", "-", -1))
+
+	if l, ok := dateLocales[name]; ok {
+		return l, true
+	}
+
+	if i := strings.Index(name, "-"); i > 0 {
+		l, ok := dateLocales[name[:i]]
+		return l, ok
+	}
+
+	return nil, false
+}
+
+// layout elements holding names
+const (
+	nameLongMonth = iota
+	nameShortMonth
+	nameLongDay
+	nameShortDay
+)
+
+type layoutChunk struct {
+	text string
+	name int
+	// isName - the chunk is a name element, else it is formatted by time.Format
+	isName bool
+}
+
+// splitLayoutNames - splits layout around its name elements, recognized as the time package does
+// (Jan and Mon followed by a lowercase letter are not elements)
+func splitLayoutNames(layout string) []layoutChunk {
+	var chunks []layoutChunk
+
+	startsWithLower := func(s string) bool {
+		return len(s) > 0 && s[0] >= 'a' && s[0] <= 'z'
+	}
+
+	last := 0
+	for i := 0; i < len(layout); i++ {
+		rest := layout[i:]
+		name := -1
+		n := 0
+
+		switch {
+		case strings.HasPrefix(rest, "January"):
+			name, n = nameLongMonth, 7
+		case strings.HasPrefix(rest, "Jan") && !startsWithLower(rest[3:]):
+			name, n = nameShortMonth, 3
+		case strings.HasPrefix(rest, "Monday"):
+			name, n = nameLongDay, 6
+		case strings.HasPrefix(rest, "Mon") && !startsWithLower(rest[3:]):
+			name, n = nameShortDay, 3
+		}
+
+		if name < 0 {
+			continue
+		}
+
+		if i > last {
+			chunks = append(chunks, layoutChunk{text: layout[last:i]})
+		}
+		chunks = append(chunks, layoutChunk{text: rest[:n], name: name, isName: true})
+
+		i += n - 1
+		last = i + 1
+	}
+
+	if last < len(layout) {
+		chunks = append(chunks, layoutChunk{text: layout[last:]})
+	}
+
+	return chunks
+}
+
+// names - returns the names of the name element kind, indexed as LocaleEN
+func (l *DateLocale) names(kind int) []string {
+	switch kind {
+	case nameLongMonth:
+		return l.Months[:]
+	case nameShortMonth:
+		return l.ShortMonths[:]
+	case nameLongDay:
+		return l.Days[:]
+	default:
+		return l.ShortDays[:]
+	}
+}
+
+// formatInLocale - formats t with layout, writing the names of locale
+func formatInLocale(t time.Time, layout string, locale *DateLocale) string {
+	var sb strings.Builder
+
+	for _, c := range splitLayoutNames(layout) {
+		switch {
+		case !c.isName:
+			sb.WriteString(t.Format(c.text))
+		case c.name == nameLongMonth || c.name == nameShortMonth:
+			sb.WriteString(locale.names(c.name)[t.Month()-1])
+		default:
+			sb.WriteString(locale.names(c.name)[t.Weekday()])
+		}
+	}
+
+	return sb.String()
+}
+
+// translateDateNames - replaces the names of locale found in sval with the English ones expected
+// by layout: the n-th word matching a name is read as the n-th name element of layout.
+// The names are compared ignoring the case and the diacritics ("marti" is "marți")
+func translateDateNames(sval, layout string, locale *DateLocale) string {
+	var kinds []int
+	for _, c := range splitLayoutNames(layout) {
+		if c.isName {
+			kinds = append(kinds, c.name)
+		}
+	}
+
+	if len(kinds) == 0 {
+		return sval
+	}
+
+	var sb strings.Builder
+	runes := []rune(sval)
+
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) {
+			sb.WriteRune(runes[i])
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(runes) && unicode.IsLetter(runes[j]) {
+			j++
+		}
+		word := string(runes[i:j])
+		i = j
+
+		if len(kinds) > 0 {
+			if k := nameIndex(locale.names(kinds[0]), word); k >= 0 {
+				word = LocaleEN.names(kinds[0])[k]
+				kinds = kinds[1:]
+			}
+		}
+
+		sb.WriteString(word)
+	}
+
+	return sb.String()
+}
+
+func nameIndex(names []string, word string) int {
+	w := foldName(word)
+
+	for i, n := range names {
+		if foldName(n) == w {
+			return i
+		}
+	}
+
+	return -1
+}
+
+var nameFolds = strings.NewReplacer(
+	"ă", "a", "â", "a", "à", "a", "á", "a",
+	"î", "i", "ì", "i", "í", "i", "ï", "i",
+	"ș", "s", "ş", "s", "ț", "t", "ţ", "t",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"ò", "o", "ó", "o", "ô", "o", "ö", "o",
+	"ù", "u", "ú", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+)
+
+// foldName - lowercases a name and removes its diacritics
+func foldName(s string) string {
+	return nameFolds.Replace(strings.ToLower(s))
+}
+
+func dateLocale(locale []string) (*DateLocale, error) {
+	if len(locale) == 0 || locale[0] == "" {
+		return nil, nil
+	}
+
+	l, ok := GetDateLocale(locale[0])
+	if !ok {
+		return nil, fmt.Errorf("unknown date locale %q", locale[0])
+	}
+
+	return l, nil
+}
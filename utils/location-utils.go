@@ -0,0 +1,46 @@
+package utils
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	locationsMux sync.RWMutex
+	locations    = make(map[string]*time.Location)
+)
+
+// LoadLocation - returns the location of the IANA zone name (see time.LoadLocation), loading it once:
+// the loaded locations are cached. "" and "UTC" are UTC, "Local" is the local zone.
+// Images without the zoneinfo files (FROM scratch) can embed the zone database
+// by building with -tags tzdata (see tzdata-utils.go)
+func LoadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+
+	switch name {
+	case "", "UTC":
+		return time.UTC, nil
+	case "Local":
+		return time.Local, nil
+	}
+
+	locationsMux.RLock()
+	loc, ok := locations[name]
+	locationsMux.RUnlock()
+
+	if ok {
+		return loc, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+
+	locationsMux.Lock()
+	locations[name] = loc
+	locationsMux.Unlock()
+
+	return loc, nil
+}
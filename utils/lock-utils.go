@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+var forUpdateRegexp = regexp.MustCompile(`(?is)\s+FOR\s+UPDATE(\s+(SKIP\s+LOCKED|NOWAIT))?\s*$`)
+
+var fromTableRegexp = regexp.MustCompile(`(?is)\bFROM\s+([A-Za-z_][A-Za-z0-9_$#.]*|"[^"]+"|\[[^\]]+\])(\s+(AS\s+)?([A-Za-z_][A-Za-z0-9_$#]*))?`)
+
+// keywords which can follow a table name and are not aliases
+var notAliasKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"CROSS": true, "ORDER": true, "GROUP": true, "HAVING": true, "UNION": true, "EXCEPT": true,
+	"INTERSECT": true, "LIMIT": true, "OFFSET": true, "ON": true, "WITH": true,
+}
+
+// errOracleLimitForUpdate - Oracle refuses FOR UPDATE on the FETCH NEXT / rownum queries LIMIT
+// and OFFSET are written as (ORA-02014)
+var errOracleLimitForUpdate = errors.New("LIMIT / OFFSET can't be used with FOR UPDATE in Oracle: lock the rows selected by key in a subquery")
+
+// splitForUpdate - removes the trailing FOR UPDATE [SKIP LOCKED|NOWAIT] clause.
+// Returns the query without it and the lock option ("", "SKIP LOCKED" or "NOWAIT")
+func splitForUpdate(q string) (string, string, bool) {
+	loc := forUpdateRegexp.FindStringSubmatchIndex(q)
+	if loc == nil {
+		return q, "", false
+	}
+
+	option := ""
+	if loc[4] >= 0 {
+		option = strings.Join(strings.Fields(strings.ToUpper(q[loc[4]:loc[5]])), " ")
+	}
+
+	return q[:loc[0]], option, true
+}
+
+// mssqlLockingHints - translates FOR UPDATE [SKIP LOCKED|NOWAIT] into
+// WITH (UPDLOCK, ROWLOCK [, READPAST|NOWAIT]) on the first table of the FROM clause
+func (pq *PreparedQuery) mssqlLockingHints() {
+	q, option, ok := splitForUpdate(pq.Query)
+	if !ok {
+		return
+	}
+
+	hints := "UPDLOCK, ROWLOCK"
+	switch option {
+	case "SKIP LOCKED":
+		hints += ", READPAST"
+	case "NOWAIT":
+		hints += ", NOWAIT"
+	}
+
+	loc := fromTableRegexp.FindStringSubmatchIndex(q)
+	if loc == nil {
+		pq.Query = q
+		return
+	}
+
+	// table end, or alias end if the word after the table is an alias
+	end := loc[3]
+	if loc[8] >= 0 && !notAliasKeywords[strings.ToUpper(q[loc[8]:loc[9]])] {
+		end = loc[9]
+	}
+
+	pq.Query = q[:end] + " WITH (" + hints + ")" + q[end:]
+}
+
+// removeForUpdate - removes the FOR UPDATE clause for databases without row locking
+func (pq *PreparedQuery) removeForUpdate() {
+	q, _, ok := splitForUpdate(pq.Query)
+	if ok {
+		pq.Query = q
+	}
+}
+
+// oracleLimitForUpdate - for the Oracle LIMIT / OFFSET rewrites: sets the error of pq and
+// returns true if the query ends with a FOR UPDATE clause
+func (pq *PreparedQuery) oracleLimitForUpdate() bool {
+	if _, _, ok := splitForUpdate(pq.Query); !ok {
+		return false
+	}
+
+	pq.err = errOracleLimitForUpdate
+
+	return true
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"reflect"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -14,6 +15,19 @@ type logItem struct {
 	msg string
 }
 
+type auditStats struct {
+	written uint64
+	failed  uint64
+}
+
+// AuditStatus - audit log queue statistics
+type AuditStatus struct {
+	Queued   int    `json:"queued"`
+	Capacity int    `json:"capacity"`
+	Written  uint64 `json:"written"`
+	Failed   uint64 `json:"failed"`
+}
+
 // AuditLog - Audit log helper
 type AuditLog struct {
 	mux           *sync.RWMutex
@@ -24,6 +38,10 @@ type AuditLog struct {
 	queue         chan logItem
 	wg            *sync.WaitGroup
 	query         string
+	stats         *auditStats
+	traceQueries  bool
+	traceHooked   bool
+	spans         map[spanKey]*traceSpan
 }
 
 // SetWaitGroup - SetWaitGroup
@@ -39,6 +57,7 @@ func (a *AuditLog) SetLogger(source string, sourceVersion string, log *logrus.Lo
 	a.sourceVersion = sourceVersion
 	a.dbutl = dbutl
 	a.queue = make(chan logItem, 10*1024)
+	a.stats = new(auditStats)
 
 	pq := a.dbutl.PQuery(`
 		INSERT INTO audit_log (
@@ -66,6 +85,20 @@ func (a *AuditLog) Close() {
 	close(a.queue)
 }
 
+// Stats - returns the audit queue statistics
+func (a *AuditLog) Stats() AuditStatus {
+	if a.stats == nil {
+		return AuditStatus{}
+	}
+
+	return AuditStatus{
+		Queued:   len(a.queue),
+		Capacity: cap(a.queue),
+		Written:  atomic.LoadUint64(&a.stats.written),
+		Failed:   atomic.LoadUint64(&a.stats.failed),
+	}
+}
+
 func (a *AuditLog) processQueue() {
 	for {
 		li, ok := <-a.queue
@@ -76,6 +109,7 @@ func (a *AuditLog) processQueue() {
 		tx, err := a.dbutl.BeginTransaction()
 		if err != nil {
 			fmt.Println("log error: ", err)
+			atomic.AddUint64(&a.stats.failed, 1)
 			a.dbutl.Rollback(tx)
 			continue
 		}
@@ -91,6 +125,9 @@ func (a *AuditLog) processQueue() {
 		_, err = a.dbutl.ExecTx(tx, pq)
 		if err != nil {
 			fmt.Println("log error: ", err)
+			atomic.AddUint64(&a.stats.failed, 1)
+		} else {
+			atomic.AddUint64(&a.stats.written, 1)
 		}
 		a.dbutl.Commit(tx)
 
@@ -108,7 +145,7 @@ func (a AuditLog) Write(p []byte) (n int, err error) {
 	}
 
 	li := logItem{
-		dt:  time.Now().UTC(),
+		dt:  Now().UTC(),
 		msg: string(p),
 	}
 
@@ -191,12 +228,34 @@ func (a *AuditLog) Log(err error, msgType string, msg string, details ...interfa
 	}
 }
 
+// Trace - logs the start of the event s and returns the arguments of Un: defer audit.Un(audit.Trace("import"))
 func (a *AuditLog) Trace(s string) (string, time.Time) {
 	a.Log(nil, "trace", "start", "event", s)
-	return s, time.Now()
+	startTime := Now()
+	return s, startTime
 }
 
+// Un - logs the end of the event s started by Trace, with the elapsed time both as a
+// duration ("elapsed": "1.5023s") and in milliseconds ("elapsed_ms": 1502.3)
 func (a *AuditLog) Un(s string, startTime time.Time) {
-	endTime := time.Now()
-	a.Log(nil, "trace", "end", "event", s, "elapsed_ms", endTime.Sub(startTime)/1E6)
+	a.un(s, startTime, Now())
+}
+
+// un - logs the trace end of s, with details (key, value pairs) added to the entry
+func (a *AuditLog) un(s string, startTime time.Time, endTime time.Time, details ...interface{}) {
+	span := a.endSpan(s, startTime)
+
+	elapsed := endTime.Sub(startTime)
+	fields := []interface{}{"event", s, "elapsed", elapsed.String(), "elapsed_ms", DurationToMillis(elapsed)}
+
+	if span != nil {
+		queries, count := span.breakdown()
+		fields = append(fields,
+			"queries", count,
+			"query_elapsed", span.elapsed.String(),
+			"query_ms", DurationToMillis(span.elapsed),
+			"query_breakdown", queries)
+	}
+
+	a.Log(nil, "trace", "end", append(fields, details...)...)
 }
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// bindNamedParams - replaces the :name placeholders by ? when all args are sql.NamedArg.
+// A name used more than once is bound once: Postgres and Oracle reuse the parameter
+// number ($1, :1), the other databases get the value repeated for each placeholder.
+// Queries without :name placeholders keep their named args (ex: @name in SQL Server)
+func (pq *PreparedQuery) bindNamedParams() {
+	named := 0
+	for _, arg := range pq.Args {
+		if _, ok := arg.(sql.NamedArg); ok {
+			named++
+		}
+	}
+
+	if named == 0 {
+		return
+	}
+
+	values := make(map[string]interface{}, len(pq.Args))
+	for _, arg := range pq.Args {
+		if na, ok := arg.(sql.NamedArg); ok {
+			values[na.Name] = na.Value
+		}
+	}
+
+	var qbuf bytes.Buffer
+	q := pq.Query
+	last := 0
+	index := make(map[string]int)
+	var unique []interface{}
+	var slots []int
+
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+
+		if c == '\'' || c == '"' {
+			end := strings.IndexByte(q[i+1:], c)
+			if end < 0 {
+				break
+			}
+			i += end + 1
+			continue
+		}
+
+		if c != ':' {
+			continue
+		}
+
+		// Postgres casts (::type)
+		if i+1 < len(q) && q[i+1] == ':' {
+			i++
+			continue
+		}
+
+		if (i > 0 && isIdentChar(q[i-1])) || i+1 >= len(q) || !isNameStart(q[i+1]) {
+			continue
+		}
+
+		end := i + 1
+		for end < len(q) && (isNameStart(q[end]) || (q[end] >= '0' && q[end] <= '9')) {
+			end++
+		}
+
+		name := q[i+1 : end]
+		val, ok := values[name]
+		if !ok {
+			pq.err = fmt.Errorf("no value for the named parameter :%s", name)
+			return
+		}
+
+		k, seen := index[name]
+		if !seen {
+			k = len(unique)
+			index[name] = k
+			unique = append(unique, val)
+		}
+		slots = append(slots, k)
+
+		qbuf.WriteString(q[last:i])
+		qbuf.WriteString("?")
+		last = end
+		i = end - 1
+	}
+
+	if len(slots) == 0 {
+		return
+	}
+
+	if named != len(pq.Args) {
+		pq.err = fmt.Errorf("named and positional parameters can't be mixed")
+		return
+	}
+
+	if countPlaceholders(q) > 0 {
+		pq.err = fmt.Errorf("? and :name placeholders can't be mixed")
+		return
+	}
+
+	for name := range values {
+		if _, ok := index[name]; !ok {
+			pq.err = fmt.Errorf("named parameter :%s is not used in the query", name)
+			return
+		}
+	}
+
+	qbuf.WriteString(q[last:])
+	pq.Query = qbuf.String()
+
+	if pq.canReuseParams(unique) {
+		pq.Args = unique
+		pq.slots = slots
+		return
+	}
+
+	args := make([]interface{}, len(slots))
+	for i, k := range slots {
+		args[i] = unique[k]
+	}
+	pq.Args = args
+}
+
+// canReuseParams - Postgres and Oracle can reference a parameter more than once, unless
+// a later rewrite changes the args (IN list expansion, Oracle LIMIT / OFFSET)
+func (pq *PreparedQuery) canReuseParams(args []interface{}) bool {
+	switch pq.DbType {
+	case Postgres, Oracle, Oracle11g, Oci8:
+	default:
+		return false
+	}
+
+	for _, arg := range args {
+		if isListArg(arg) {
+			return false
+		}
+	}
+
+	if pq.DbType != Postgres {
+		uq := strings.ToUpper(pq.Query)
+		if strings.Contains(uq, "LIMIT ?") || strings.Contains(uq, "OFFSET ?") {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
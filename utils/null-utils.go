@@ -0,0 +1,210 @@
+package utils
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+)
+
+var jsonNull = []byte("null")
+
+// NullString represents a string that may be null. It implements sql.Scanner,
+// driver.Valuer and json.Marshaler / json.Unmarshaler (null when not Valid)
+type NullString struct {
+	String string
+	Valid  bool // Valid is true if String is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (n *NullString) Scan(value interface{}) error {
+	var ns sql.NullString
+	err := ns.Scan(value)
+	n.String, n.Valid = ns.String, ns.Valid
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (n NullString) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.String, nil
+}
+
+// SetValue - sets the value for the String and Valid members
+func (n *NullString) SetValue(s string) {
+	n.String = s
+	n.Valid = true
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (n NullString) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(n.String)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (n *NullString) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, jsonNull) {
+		n.String, n.Valid = "", false
+		return nil
+	}
+
+	err := json.Unmarshal(b, &n.String)
+	n.Valid = err == nil
+	return err
+}
+
+// NullInt64 represents an int64 that may be null. It implements sql.Scanner,
+// driver.Valuer and json.Marshaler / json.Unmarshaler (null when not Valid)
+type NullInt64 struct {
+	Int64 int64
+	Valid bool // Valid is true if Int64 is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (n *NullInt64) Scan(value interface{}) error {
+	var ni sql.NullInt64
+	err := ni.Scan(value)
+	n.Int64, n.Valid = ni.Int64, ni.Valid
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (n NullInt64) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Int64, nil
+}
+
+// SetValue - sets the value for the Int64 and Valid members
+func (n *NullInt64) SetValue(i int64) {
+	n.Int64 = i
+	n.Valid = true
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (n NullInt64) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(n.Int64)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (n *NullInt64) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, jsonNull) {
+		n.Int64, n.Valid = 0, false
+		return nil
+	}
+
+	err := json.Unmarshal(b, &n.Int64)
+	n.Valid = err == nil
+	return err
+}
+
+// NullFloat64 represents a float64 that may be null. It implements sql.Scanner,
+// driver.Valuer and json.Marshaler / json.Unmarshaler (null when not Valid)
+type NullFloat64 struct {
+	Float64 float64
+	Valid   bool // Valid is true if Float64 is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (n *NullFloat64) Scan(value interface{}) error {
+	var nf sql.NullFloat64
+	err := nf.Scan(value)
+	n.Float64, n.Valid = nf.Float64, nf.Valid
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (n NullFloat64) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Float64, nil
+}
+
+// SetValue - sets the value for the Float64 and Valid members
+func (n *NullFloat64) SetValue(f float64) {
+	n.Float64 = f
+	n.Valid = true
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (n NullFloat64) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(n.Float64)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (n *NullFloat64) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, jsonNull) {
+		n.Float64, n.Valid = 0, false
+		return nil
+	}
+
+	err := json.Unmarshal(b, &n.Float64)
+	n.Valid = err == nil
+	return err
+}
+
+// NullBool represents a bool that may be null. It implements sql.Scanner,
+// driver.Valuer and json.Marshaler / json.Unmarshaler (null when not Valid)
+type NullBool struct {
+	Bool  bool
+	Valid bool // Valid is true if Bool is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (n *NullBool) Scan(value interface{}) error {
+	if value == nil {
+		n.Bool, n.Valid = false, false
+		return nil
+	}
+
+	b, err := boolFromDriver(value)
+	n.Bool, n.Valid = b, err == nil
+	return err
+}
+
+// Value implements the driver Valuer interface.
+func (n NullBool) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Bool, nil
+}
+
+// SetValue - sets the value for the Bool and Valid members
+func (n *NullBool) SetValue(b bool) {
+	n.Bool = b
+	n.Valid = true
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (n NullBool) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return jsonNull, nil
+	}
+	return json.Marshal(n.Bool)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (n *NullBool) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, jsonNull) {
+		n.Bool, n.Valid = false, false
+		return nil
+	}
+
+	err := json.Unmarshal(b, &n.Bool)
+	n.Valid = err == nil
+	return err
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"bytes"
 	"database/sql/driver"
 	"time"
 )
@@ -32,3 +33,60 @@ func (nt *NullTime) SetValue(dt time.Time) {
 	nt.Time = dt
 	nt.Valid = !dt.IsZero()
 }
+
+// NewNullTime - returns a NullTime holding *t, not Valid if t is nil
+func NewNullTime(t *time.Time) NullTime {
+	if t == nil {
+		return NullTime{}
+	}
+	return NullTime{Time: *t, Valid: true}
+}
+
+// Ptr - returns a pointer to a copy of Time, nil if not Valid
+func (nt NullTime) Ptr() *time.Time {
+	if !nt.Valid {
+		return nil
+	}
+	t := nt.Time
+	return &t
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (nt NullTime) MarshalJSON() ([]byte, error) {
+	if !nt.Valid {
+		return jsonNull, nil
+	}
+	return nt.Time.MarshalJSON()
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (nt *NullTime) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, jsonNull) {
+		nt.Time, nt.Valid = time.Time{}, false
+		return nil
+	}
+
+	err := nt.Time.UnmarshalJSON(b)
+	nt.Valid = err == nil
+	return err
+}
+
+// MarshalText implements the encoding.TextMarshaler interface (RFC 3339, empty when not Valid).
+func (nt NullTime) MarshalText() ([]byte, error) {
+	if !nt.Valid {
+		return []byte{}, nil
+	}
+	return nt.Time.MarshalText()
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface (empty is not Valid).
+func (nt *NullTime) UnmarshalText(b []byte) error {
+	if len(b) == 0 {
+		nt.Time, nt.Valid = time.Time{}, false
+		return nil
+	}
+
+	err := nt.Time.UnmarshalText(b)
+	nt.Valid = err == nil
+	return err
+}
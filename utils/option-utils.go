@@ -0,0 +1,75 @@
+package utils
+
+// QueryOption - disables a rewrite stage of PQuery (or enables an optional one).
+// Options are passed among the args:
+//
+//	dbutl.PQuery("SELECT now() FROM dual WHERE id = ?", utils.WithoutUTCTranslation(), id)
+type QueryOption func(pq *PreparedQuery)
+
+// WithoutUTCTranslation - keeps now(), current_timestamp, sysdate, etc. in the local time of the
+// database server (now() is still renamed where the database doesn't have it)
+func WithoutUTCTranslation() QueryOption {
+	return func(pq *PreparedQuery) {
+		pq.noUTC = true
+	}
+}
+
+// WithoutLimitRewrite - keeps LIMIT / OFFSET as written (SQL Server and Oracle)
+func WithoutLimitRewrite() QueryOption {
+	return func(pq *PreparedQuery) {
+		pq.noLimitRewrite = true
+	}
+}
+
+// WithoutIdentifierRewrite - keeps the double quoted identifiers as written (MySQL)
+func WithoutIdentifierRewrite() QueryOption {
+	return func(pq *PreparedQuery) {
+		pq.noIdentRewrite = true
+	}
+}
+
+// WithDurationBinding - binds the time.Duration args as intervals in Postgres and as
+// seconds (float) in the other databases. Without it they are bound as they always were,
+// as int64 nanoseconds, so the queries written for that keep working
+func WithDurationBinding() QueryOption {
+	return func(pq *PreparedQuery) {
+		pq.bindDurs = true
+	}
+}
+
+// WithTempTableInLists - writes all the "IN (?)" lists of the query as joins with a temp table
+// filled in the same session, whatever their length and database type (see DbUtils.SetInListTempTableThreshold)
+func WithTempTableInLists() QueryOption {
+	return func(pq *PreparedQuery) {
+		pq.forceTempLists = true
+	}
+}
+
+// applyOptions - applies the QueryOption args to pq and returns the other args
+func (pq *PreparedQuery) applyOptions(args []interface{}) []interface{} {
+	var res []interface{}
+	found := false
+
+	for i, arg := range args {
+		opt, ok := arg.(QueryOption)
+		if !ok {
+			if found {
+				res = append(res, arg)
+			}
+			continue
+		}
+
+		if !found {
+			found = true
+			res = append(make([]interface{}, 0, len(args)-1), args[:i]...)
+		}
+
+		opt(pq)
+	}
+
+	if !found {
+		return args
+	}
+
+	return res
+}
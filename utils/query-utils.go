@@ -1,459 +1,1210 @@
-package utils
-
-import (
-	"bytes"
-	"errors"
-	"fmt"
-	"strings"
-)
-
-// PreparedQuery - prepared query and parameters
-// Query parameter placeholders will be written as ? in all suported databses.
-//   Ex: select col1 from table1 where col2 = ?
-// Some alterations to the query will be made:
-//   - get dates as UTC
-//   - in Postgresql
-//       - changes params written as ? to $1, $2, etc
-//   - in MySQL
-//       - replaces quote identifiers with backticks
-//   - in SQL Server
-//       - replaces "LIMIT ? OFFSET ?" with "OFFSET ? ROWS FETCH NEXT ? ROWS ONLY"
-//       - switches parameters set for OFFSET and LIMIT to reflect the changed query
-//       - Limitations:
-//           - LIMIT ? OFFSET ? must be the last 2 parameters in the query
-//   - in Oracle
-//       - changes params written as ? to :1, :2, etc
-type PreparedQuery struct {
-	DbType      string
-	ParamPrefix string
-	Query       string
-	Args        []interface{}
-}
-
-// SetArg - Set Arg Value
-func (pq *PreparedQuery) SetArg(i int, val interface{}) {
-	if i < 0 {
-		panic(errors.New("invalid index argument"))
-	}
-
-	n := 0
-	target := i + 1
-	if pq.Args != nil {
-		n = len(pq.Args)
-	}
-
-	if n < target {
-		for k := n; k < target; k++ {
-			pq.Args = append(pq.Args, nil)
-		}
-	}
-
-	pq.Args[i] = val
-}
-
-// Prepare - prepares query for running
-func (pq *PreparedQuery) Prepare() {
-	switch {
-	case pq.DbType == Postgres:
-		pq.modifyQuery4Postgres()
-
-	case pq.DbType == MySQL:
-		pq.modifyQuery4MySQL()
-
-	case pq.DbType == SQLServer:
-		pq.modifyQuery4MSSQL()
-
-	case pq.DbType == Oracle || pq.DbType == Oci8:
-		pq.modifyQuery4Oracle12c()
-
-	case pq.DbType == Oracle11g:
-		pq.modifyQuery4Oracle11g()
-
-	case pq.DbType == Sqlite3:
-		pq.modifyQuery4Sqlite()
-	}
-
-	pq.replaceParamPlaceHolders()
-}
-
-func (pq *PreparedQuery) modifyQuery4Postgres() {
-	q := pq.Query
-
-	q = strings.Replace(q, "now()", "now() at time zone 'UTC'", -1)
-	q = strings.Replace(q, "current_timestamp", "current_timestamp at time zone 'UTC'", -1)
-	q = strings.Replace(q, "DATE ?", "?", -1)
-	q = strings.Replace(q, "TIMESTAMP ?", "?", -1)
-	q = strings.Replace(q, "date ?", "?", -1)
-	q = strings.Replace(q, "timestamp ?", "?", -1)
-
-	pq.Query = q
-
-	pq.minus2except(true)
-	pq.minus2except(false)
-}
-
-func (pq *PreparedQuery) modifyQuery4MySQL() {
-	q := pq.Query
-
-	backquote := `` + "`" + ``
-	q = strings.Replace(q, "now()", "UTC_TIMESTAMP()", -1)
-	q = strings.Replace(q, "current_timestamp", "UTC_TIMESTAMP()", -1)
-	q = strings.Replace(q, "DATE ?", "?", -1)
-	q = strings.Replace(q, "TIMESTAMP ?", "?", -1)
-	q = strings.Replace(q, "date ?", "?", -1)
-	q = strings.Replace(q, "timestamp ?", "?", -1)
-	q = strings.Replace(q, `"`, backquote, -1)
-
-	pq.Query = q
-
-	pq.minus2except(true)
-	pq.minus2except(false)
-}
-
-func (pq *PreparedQuery) modifyQuery4MSSQL() {
-	q := pq.Query
-
-	q = strings.Replace(q, "now()", "getutcdate()", -1)
-	q = strings.Replace(q, "getdate()", "getutcdate()", -1)
-	q = strings.Replace(q, "current_timestamp", "getutcdate()", -1)
-	q = strings.Replace(q, "DATE ?", "convert(date, ?)", -1)
-	q = strings.Replace(q, "TIMESTAMP ?", "convert(datetime, ?)", -1)
-	q = strings.Replace(q, "date ?", "convert(date, ?)", -1)
-	q = strings.Replace(q, "timestamp ?", "convert(datetime, ?)", -1)
-
-	pq.Query = q
-
-	pq.minus2except(true)
-	pq.minus2except(false)
-	pq.mssqlLimitAndOffset()
-}
-
-func (pq *PreparedQuery) modifyQuery4Oracle12c() {
-	q := pq.Query
-
-	q = strings.Replace(q, "systimestamp", "sys_extract_utc(systimestamp)", -1)
-	q = strings.Replace(q, "now()", "sys_extract_utc(systimestamp)", -1)
-	q = strings.Replace(q, "sysdate", "sys_extract_utc(systimestamp)", -1)
-	q = strings.Replace(q, "current_timestamp", "sys_extract_utc(systimestamp)", -1)
-	q = strings.Replace(q, "DATE ?", "to_date(?, 'yyyy-mm-dd')", -1)
-	q = strings.Replace(q, "TIMESTAMP ?", "to_timestamp(?, 'yyyy-mm-dd HH:mm:ss')", -1)
-	q = strings.Replace(q, "date ?", "to_date(?, 'yyyy-mm-dd')", -1)
-	q = strings.Replace(q, "timestamp ?", "to_timestamp(?, 'yyyy-mm-dd HH:mm:ss')", -1)
-
-	pq.Query = q
-
-	pq.except2minus(true)
-	pq.except2minus(false)
-	pq.oracle12cLimitAndOffset()
-}
-
-func (pq *PreparedQuery) modifyQuery4Oracle11g() {
-	q := pq.Query
-
-	q = strings.Replace(q, "systimestamp", "sys_extract_utc(systimestamp)", -1)
-	q = strings.Replace(q, "now()", "sys_extract_utc(systimestamp)", -1)
-	q = strings.Replace(q, "sysdate", "sys_extract_utc(systimestamp)", -1)
-	q = strings.Replace(q, "current_timestamp", "sys_extract_utc(systimestamp)", -1)
-	q = strings.Replace(q, "DATE ?", "to_date(?, 'yyyy-mm-dd')", -1)
-	q = strings.Replace(q, "TIMESTAMP ?", "to_timestamp(?, 'yyyy-mm-dd HH:mm:ss')", -1)
-	q = strings.Replace(q, "date ?", "to_date(?, 'yyyy-mm-dd')", -1)
-	q = strings.Replace(q, "timestamp ?", "to_timestamp(?, 'yyyy-mm-dd HH:mm:ss')", -1)
-
-	pq.Query = q
-
-	pq.except2minus(true)
-	pq.except2minus(false)
-	pq.oracle11gLimitAndOffset()
-}
-
-func (pq *PreparedQuery) modifyQuery4Sqlite() {
-	q := pq.Query
-
-	q = strings.Replace(q, "now()", "strftime('%Y-%m-%d %H:%M:%f','now')", -1)
-	q = strings.Replace(q, "current_timestamp", "strftime('%Y-%m-%d %H:%M:%f','now')", -1)
-	q = strings.Replace(q, "DATE ?", "date(?)", -1)
-	q = strings.Replace(q, "TIMESTAMP ?", "datetime(?)", -1)
-	q = strings.Replace(q, "date ?", "date(?)", -1)
-	q = strings.Replace(q, "timestamp ?", "datetime(?)", -1)
-
-	pq.Query = q
-
-	pq.minus2except(true)
-	pq.minus2except(false)
-}
-
-func (pq *PreparedQuery) replaceParamPlaceHolders() {
-	i := 1
-	pos := 0
-	idx := -1
-	var qbuf bytes.Buffer
-	l := len(pq.Query)
-
-	idx = strings.Index(pq.Query[pos:], "?")
-	if idx < 0 || len(pq.ParamPrefix) == 0 {
-		return
-	}
-
-	for {
-		if idx < 0 {
-			qbuf.WriteString(pq.Query[pos:])
-			break
-		} else {
-			qbuf.WriteString(pq.Query[pos : pos+idx])
-			pos += idx + 1
-		}
-
-		if pos < l-1 && pq.Query[pos:pos+1] == "?" {
-			qbuf.WriteString("?")
-			pos++
-		} else {
-			prm := fmt.Sprintf("%s%d", pq.ParamPrefix, i)
-			qbuf.WriteString(prm)
-			i++
-		}
-
-		idx = strings.Index(pq.Query[pos:], "?")
-	}
-
-	pq.Query = qbuf.String()
-}
-
-func (pq *PreparedQuery) minus2except(searchUppercase bool) {
-	pos := 0
-	idx := -1
-	pos2 := 0
-	var qbuf bytes.Buffer
-
-	if searchUppercase {
-		idx = strings.Index(pq.Query[pos:], "MINUS")
-	} else {
-		idx = strings.Index(pq.Query[pos:], "minus")
-	}
-
-	if idx < 0 {
-		return
-	}
-
-	for {
-		if idx < 0 {
-			qbuf.WriteString(pq.Query[pos:])
-			break
-		} else {
-			qbuf.WriteString(pq.Query[pos : pos+idx])
-			pos += idx + len("minus")
-		}
-
-		pos2 = pos - len("minus") - 1
-		if !IsWhiteSpace(pq.Query[pos:pos+1]) || !IsWhiteSpace(pq.Query[pos2:pos2+1]) {
-			qbuf.WriteString(pq.Query[pos2+1 : pos])
-		} else {
-			if searchUppercase {
-				qbuf.WriteString("EXCEPT")
-			} else {
-				qbuf.WriteString("except")
-			}
-		}
-
-		if searchUppercase {
-			idx = strings.Index(pq.Query[pos:], "MINUS")
-		} else {
-			idx = strings.Index(pq.Query[pos:], "minus")
-		}
-	}
-
-	pq.Query = qbuf.String()
-}
-
-func (pq *PreparedQuery) except2minus(searchUppercase bool) {
-	pos := 0
-	idx := -1
-	pos2 := 0
-	var qbuf bytes.Buffer
-
-	if searchUppercase {
-		idx = strings.Index(pq.Query[pos:], "EXCEPT")
-	} else {
-		idx = strings.Index(pq.Query[pos:], "except")
-	}
-
-	if idx < 0 {
-		return
-	}
-
-	for {
-		if idx < 0 {
-			qbuf.WriteString(pq.Query[pos:])
-			break
-		} else {
-			qbuf.WriteString(pq.Query[pos : pos+idx])
-			pos += idx + len("except")
-		}
-
-		pos2 = pos - len("except") - 1
-		if !IsWhiteSpace(pq.Query[pos:pos+1]) || !IsWhiteSpace(pq.Query[pos2:pos2+1]) {
-			qbuf.WriteString(pq.Query[pos2+1 : pos])
-		} else {
-			if searchUppercase {
-				qbuf.WriteString("MINUS")
-			} else {
-				qbuf.WriteString("minus")
-			}
-		}
-
-		if searchUppercase {
-			idx = strings.Index(pq.Query[pos:], "EXCEPT")
-		} else {
-			idx = strings.Index(pq.Query[pos:], "except")
-		}
-	}
-
-	pq.Query = qbuf.String()
-}
-
-func (pq *PreparedQuery) mssqlLimitAndOffset() {
-	idx1 := strings.Index(pq.Query, "LIMIT ?")
-	idx2 := strings.Index(pq.Query, "OFFSET ?")
-	offsetLwCase := false
-
-	if idx1 < 0 {
-		idx1 = strings.Index(pq.Query, "limit ?")
-	}
-
-	if idx2 < 0 {
-		idx2 = strings.Index(pq.Query, "offset ?")
-		offsetLwCase = true
-	}
-
-	if idx1 > -1 {
-		if idx2 > -1 {
-			idx3 := idx1 + len("LIMIT ?")
-			idx4 := idx2 + len("OFFSET ?")
-			q1 := pq.Query[:idx1]
-			q2 := pq.Query[idx3:idx2]
-			q3 := pq.Query[idx4:]
-
-			pq.Query = fmt.Sprintf("%sOFFSET ? ROWS%sFETCH NEXT ? ROWS ONLY%s", q1, q2, q3)
-
-			if pq.Args != nil {
-				n := len(pq.Args)
-				if n >= 2 {
-					pq.Args = append(pq.Args[:n-2], pq.Args[n-1], pq.Args[n-2])
-				}
-			}
-		} else {
-			idx3 := idx1 + len("LIMIT ?")
-			q1 := pq.Query[:idx1]
-			q3 := pq.Query[idx3:]
-
-			pq.Query = fmt.Sprintf("%sOFFSET 0 ROWS\nFETCH NEXT ? ROWS ONLY%s", q1, q3)
-		}
-	} else if idx2 > -1 {
-		if offsetLwCase {
-			pq.Query = strings.Replace(pq.Query, "offset ?", "OFFSET ? ROWS", -1)
-		} else {
-			pq.Query = strings.Replace(pq.Query, "OFFSET ?", "OFFSET ? ROWS", -1)
-		}
-	}
-}
-
-func (pq *PreparedQuery) oracle12cLimitAndOffset() {
-	idx1 := strings.Index(pq.Query, "LIMIT ?")
-	idx2 := strings.Index(pq.Query, "OFFSET ?")
-	offsetLwCase := false
-
-	if idx1 < 0 {
-		idx1 = strings.Index(pq.Query, "limit ?")
-	}
-
-	if idx2 < 0 {
-		idx2 = strings.Index(pq.Query, "offset ?")
-		offsetLwCase = true
-	}
-
-	if idx1 > -1 {
-		if idx2 > -1 {
-			idx3 := idx1 + len("LIMIT ?")
-			idx4 := idx2 + len("OFFSET ?")
-			q1 := pq.Query[:idx1]
-			q2 := pq.Query[idx3:idx2]
-			q3 := pq.Query[idx4:]
-
-			pq.Query = fmt.Sprintf("%sOFFSET ? ROWS%sFETCH NEXT ? ROWS ONLY%s", q1, q2, q3)
-
-			if pq.Args != nil {
-				n := len(pq.Args)
-				if n >= 2 {
-					pq.Args = append(pq.Args[:n-2], pq.Args[n-1], pq.Args[n-2])
-				}
-			}
-		} else {
-			idx3 := idx1 + len("LIMIT ?")
-			q1 := pq.Query[:idx1]
-			q3 := pq.Query[idx3:]
-
-			pq.Query = fmt.Sprintf("%sOFFSET 0 ROWS\nFETCH NEXT ? ROWS ONLY%s", q1, q3)
-		}
-	} else if idx2 > -1 {
-		if offsetLwCase {
-			pq.Query = strings.Replace(pq.Query, "offset ?", "OFFSET ? ROWS", -1)
-		} else {
-			pq.Query = strings.Replace(pq.Query, "OFFSET ?", "OFFSET ? ROWS", -1)
-		}
-	}
-}
-
-func (pq *PreparedQuery) oracle11gLimitAndOffset() {
-	idx1 := strings.Index(pq.Query, "LIMIT ?")
-	idx2 := strings.Index(pq.Query, "OFFSET ?")
-
-	if idx1 < 0 {
-		idx1 = strings.Index(pq.Query, "limit ?")
-	}
-
-	if idx2 < 0 {
-		idx2 = strings.Index(pq.Query, "offset ?")
-	}
-
-	if idx1 > -1 {
-		q1 := strings.TrimSpace(pq.Query[:idx1])
-
-		if idx2 > -1 {
-			pq.Query = fmt.Sprintf(`
-				SELECT * FROM (SELECT rownum rnumignore, a.* FROM (
-					%s
-				) a WHERE rownum <= ?) WHERE rnumignore > ?
-			`, q1)
-
-			if pq.Args != nil {
-				n := len(pq.Args)
-				if n >= 2 {
-					offset := pq.Args[n-1].(int)
-					nrRows := pq.Args[n-2].(int)
-					pq.Args[n-2] = offset + nrRows
-				}
-			}
-		} else {
-			pq.Query = fmt.Sprintf(`
-				SELECT * FROM (SELECT rownum rnumignore, a.* FROM (
-					%s
-				) a WHERE rownum <= ?)
-			`, q1)
-		}
-	} else if idx2 > -1 {
-		q1 := strings.TrimSpace(pq.Query[:idx2])
-
-		pq.Query = fmt.Sprintf(`
-			SELECT * FROM (SELECT rownum rnumignore, a.* FROM (
-				%s
-			) a) WHERE rnumignore > ?
-		`, q1)
-
-		if pq.Args != nil {
-			n := len(pq.Args)
-			if n >= 1 {
-				offset := pq.Args[n-1].(int)
-				pq.Args[n-1] = offset + 1
-			}
-		}
-	}
-}
+package utils
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrParamCount - the number of args doesn't match the number of ? placeholders
+var ErrParamCount = errors.New("parameter count mismatch")
+
+// PreparedQuery - prepared query and parameters
+// Query parameter placeholders will be written as ? in all suported databses.
+//   Ex: select col1 from table1 where col2 = ?
+// Some alterations to the query will be made:
+//   - get dates as UTC
+//   - translates "expr +/- INTERVAL ? DAY" (SECOND, MINUTE, HOUR, DAY, WEEK, MONTH, YEAR) into the date arithmetic of each database
+//   - expands slice args bound to "IN (?)" into one placeholder per item (in Oracle, lists over 1000 items are split into OR-ed groups);
+//     lists over the temp table threshold (see DbUtils.SetInListTempTableThreshold) are joined through a temp table
+//   - binds slice args of "expr = ANY (?)" and "expr <> ALL (?)" as arrays in Postgres and expands them as IN / NOT IN lists elsewhere
+//   - translates JSON_VALUE(expr, '$.path') into expr #>> '{path}' (Postgres), JSON_UNQUOTE(JSON_EXTRACT(...)) (MySQL) and json_extract (SQLite); map and struct args are bound as JSON text
+//   - translates REGEXP_LIKE(expr, pattern [, 'i']) into expr ~ pattern (Postgres) and expr REGEXP pattern (MySQL, SQLite); SQL Server only gets LIKE for plain text patterns anchored with ^ / $
+//   - rewrites ISNULL(a, b), IFNULL(a, b) and NVL(a, b) as COALESCE(a, b) (as NVL(a, b) in Oracle 11g)
+//   - binds :name placeholders to sql.Named args, a name used more than once being bound once
+//     (the parameter number is reused in Postgres and Oracle, the value is repeated elsewhere)
+//   - translates a trailing "RETURNING col1, col2" of INSERT, UPDATE and DELETE (see Returned)
+//   - writes MINUS as EXCEPT (EXCEPT as MINUS in Oracle); "EXCEPT / INTERSECT DISTINCT" loses the
+//     DISTINCT where it is not accepted and "ALL" is refused where it is not supported
+//   - in Postgresql
+//       - changes params written as ? to $1, $2, etc
+//   - in MySQL
+//       - replaces quote identifiers with backticks
+//       - removes RETURNING, the value of a single column is taken from LastInsertId
+//   - in SQL Server
+//       - replaces "LIMIT ? OFFSET ?" with "OFFSET ? ROWS FETCH NEXT ? ROWS ONLY"
+//       - switches parameters set for OFFSET and LIMIT to reflect the changed query
+//       - replaces "FOR UPDATE [SKIP LOCKED|NOWAIT]" with "WITH (UPDLOCK, ROWLOCK[, READPAST|NOWAIT])" table hints
+//       - replaces "RETURNING col" with "OUTPUT INSERTED.col" (DELETED.col for DELETE)
+//       - Limitations:
+//           - LIMIT ? OFFSET ? must be the last 2 parameters in the query
+//       - changes params written as ? to @p1, @p2, etc (see DbUtils.SetSQLServerParamPrefix)
+//   - in Oracle
+//       - changes params written as ? to :1, :2, etc
+//       - binds the RETURNING columns with "RETURNING col INTO ?" out parameters
+//       - in Oracle 11g, pages "LIMIT ? OFFSET ?" with ROW_NUMBER() OVER (ORDER BY ...), the ORDER BY of the query (whose columns must be selected)
+//       - refuses LIMIT / OFFSET with FOR UPDATE (Oracle can't lock the rows of a FETCH NEXT / rownum query, ORA-02014)
+// Prepare leaves the caller's query and args untouched: Query and Args hold the
+// rewritten values while SourceQuery and SourceArgs return the original ones.
+type PreparedQuery struct {
+	DbType      string
+	ParamPrefix string
+	Query       string
+	Args        []interface{}
+
+	prepared  bool
+	noRewrite bool
+	srcQuery  string
+	srcArgs   []interface{}
+	err       error
+	returning []string
+	slots     []int
+	consumer  string
+	traceCtx  context.Context
+
+	noUTC          bool
+	noLimitRewrite bool
+	noIdentRewrite bool
+	bindDurs       bool
+
+	// tempLists - the IN lists written as temp table joins, filled by DbUtils before running the query
+	tempListMin    int
+	forceTempLists bool
+	tempLists      []tempList
+
+	// argsErr - the placeholders of a query prepared without args. Kept apart from err,
+	// so the rewrites still run and SetArg can clear it once all the args are set
+	argsErr  error
+	wantArgs int
+}
+
+// SetArg - Set Arg Value
+func (pq *PreparedQuery) SetArg(i int, val interface{}) {
+	if i < 0 {
+		panic(errors.New("invalid index argument"))
+	}
+
+	n := 0
+	target := i + 1
+	if pq.Args != nil {
+		n = len(pq.Args)
+	}
+
+	if n < target {
+		for k := n; k < target; k++ {
+			pq.Args = append(pq.Args, nil)
+		}
+	}
+
+	pq.Args[i] = val
+
+	if pq.argsErr != nil && len(pq.Args) >= pq.wantArgs {
+		pq.argsErr = nil
+	}
+}
+
+// Prepare - prepares query for running.
+// Calling Prepare on an already prepared query does nothing
+func (pq *PreparedQuery) Prepare() {
+	if pq.prepared {
+		return
+	}
+
+	pq.srcQuery = pq.Query
+	pq.srcArgs = pq.Args
+	pq.prepared = true
+
+	// the rewriters reorder and change args, work on a copy
+	if pq.Args != nil {
+		pq.Args = append(make([]interface{}, 0, len(pq.srcArgs)), pq.srcArgs...)
+	}
+
+	pq.bindNamedParams()
+	pq.bindValuers()
+	pq.bindDecimals()
+	pq.bindUUIDs()
+	pq.bindDurations()
+	pq.bindBools()
+	pq.bindEnums()
+	pq.bindJSONArgs()
+	pq.validateParamCount()
+	pq.expandInLists()
+	pq.translateReturning()
+
+	switch {
+	case pq.DbType == Postgres:
+		pq.modifyQuery4Postgres()
+
+	case pq.DbType == MySQL:
+		pq.modifyQuery4MySQL()
+
+	case pq.DbType == SQLServer:
+		pq.modifyQuery4MSSQL()
+
+	case pq.DbType == Oracle || pq.DbType == Oci8:
+		pq.modifyQuery4Oracle12c()
+
+	case pq.DbType == Oracle11g:
+		pq.modifyQuery4Oracle11g()
+
+	case pq.DbType == Sqlite3:
+		pq.modifyQuery4Sqlite()
+	}
+
+	pq.replaceParamPlaceHolders()
+}
+
+// Err - returns the error found while preparing the query, if any.
+// DbUtils returns it instead of running the query
+func (pq *PreparedQuery) Err() error {
+	if pq.err != nil {
+		return pq.err
+	}
+
+	return pq.argsErr
+}
+
+// IsPrepared - checks if the query was already rewritten for its database type
+func (pq *PreparedQuery) IsPrepared() bool {
+	return pq.prepared
+}
+
+// markPrepared - marks the query text as already rewritten
+func (pq *PreparedQuery) markPrepared() {
+	pq.srcQuery = pq.Query
+	pq.srcArgs = pq.Args
+	pq.prepared = true
+	pq.noRewrite = true
+}
+
+// validateRewritten - checks that an already rewritten query uses the
+// parameter style of its database type
+func (pq *PreparedQuery) validateRewritten() error {
+	if len(pq.Args) == 0 || len(pq.ParamPrefix) == 0 {
+		return nil
+	}
+
+	if !pq.hasPrefixedParams() {
+		return fmt.Errorf("query was not prepared for %s: expected %s1 style parameters", pq.DbType, pq.ParamPrefix)
+	}
+
+	return nil
+}
+
+// looksPrepared - the query has no ? placeholders but has parameters in the
+// database type style, so it was already rewritten
+func (pq *PreparedQuery) looksPrepared() bool {
+	if len(pq.Args) == 0 || len(pq.ParamPrefix) == 0 {
+		return false
+	}
+
+	return countPlaceholders(pq.Query) == 0 && pq.hasPrefixedParams()
+}
+
+// hasPrefixedParams - the query holds a ParamPrefix followed by a digit (ex: $1).
+// Scanned rather than matched with a regexp, as the prefix is set per DbUtils
+func (pq *PreparedQuery) hasPrefixedParams() bool {
+	q := pq.Query
+
+	for {
+		idx := strings.Index(q, pq.ParamPrefix)
+		if idx < 0 {
+			return false
+		}
+
+		q = q[idx+len(pq.ParamPrefix):]
+		if len(q) > 0 && q[0] >= '0' && q[0] <= '9' {
+			return true
+		}
+	}
+}
+
+// countPlaceholders - counts the ? placeholders, ?? being an escaped ?
+func countPlaceholders(q string) int {
+	n := 0
+
+	for i := 0; i < len(q); i++ {
+		if q[i] != '?' {
+			continue
+		}
+
+		if i+1 < len(q) && q[i+1] == '?' {
+			i++
+			continue
+		}
+
+		n++
+	}
+
+	return n
+}
+
+// validateParamCount - checks that there is one arg for each ? placeholder.
+// A query prepared without args gets the error until SetArg sets all of them
+func (pq *PreparedQuery) validateParamCount() {
+	if pq.err != nil {
+		return
+	}
+
+	nargs := len(pq.Args)
+	if pq.slots != nil {
+		nargs = len(pq.slots)
+	} else if nargs > 0 && allNamedArgs(pq.Args) {
+		// named params handled by the driver
+		return
+	}
+
+	offsets := placeholderOffsets(pq.Query)
+	if len(offsets) == nargs {
+		return
+	}
+
+	var missing []string
+	if len(offsets) > nargs {
+		for k := nargs; k < len(offsets); k++ {
+			line, col := lineAndColumn(pq.Query, offsets[k])
+			missing = append(missing, fmt.Sprintf("#%d (line %d, column %d)", k+1, line, col))
+		}
+
+		err := fmt.Errorf("%w: %d placeholders, %d args: no value for placeholder %s",
+			ErrParamCount, len(offsets), nargs, strings.Join(missing, ", "))
+
+		if nargs == 0 {
+			pq.argsErr = err
+			pq.wantArgs = len(offsets)
+		} else {
+			pq.err = err
+		}
+		return
+	}
+
+	for k := len(offsets); k < nargs; k++ {
+		missing = append(missing, fmt.Sprintf("#%d", k+1))
+	}
+
+	pq.err = fmt.Errorf("%w: %d placeholders, %d args: no placeholder for arg %s",
+		ErrParamCount, len(offsets), nargs, strings.Join(missing, ", "))
+}
+
+// placeholderOffsets - returns the offsets of the ? placeholders, ?? being an escaped ?
+func placeholderOffsets(q string) []int {
+	var offsets []int
+
+	for i := 0; i < len(q); i++ {
+		if q[i] != '?' {
+			continue
+		}
+
+		if i+1 < len(q) && q[i+1] == '?' {
+			i++
+			continue
+		}
+
+		offsets = append(offsets, i)
+	}
+
+	return offsets
+}
+
+// lineAndColumn - returns the 1 based line and column of offset in q
+func lineAndColumn(q string, offset int) (int, int) {
+	line := 1 + strings.Count(q[:offset], "\n")
+	col := offset - strings.LastIndex(q[:offset], "\n")
+
+	return line, col
+}
+
+func allNamedArgs(args []interface{}) bool {
+	for _, arg := range args {
+		if _, ok := arg.(sql.NamedArg); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SourceQuery - returns the query as written, before Prepare
+func (pq *PreparedQuery) SourceQuery() string {
+	if !pq.prepared {
+		return pq.Query
+	}
+	return pq.srcQuery
+}
+
+// SourceArgs - returns the args as given, before Prepare
+func (pq *PreparedQuery) SourceArgs() []interface{} {
+	if !pq.prepared {
+		return pq.Args
+	}
+	return pq.srcArgs
+}
+
+// WithArgs - returns a new PreparedQuery for the same query, with different args.
+// Useful for retries or for running the same statement with fresh values
+func (pq *PreparedQuery) WithArgs(args ...interface{}) *PreparedQuery {
+	npq := PreparedQuery{
+		DbType:      pq.DbType,
+		ParamPrefix: pq.ParamPrefix,
+		Query:       pq.SourceQuery(),
+		consumer:    pq.consumer,
+		traceCtx:    pq.traceCtx,
+
+		noUTC:          pq.noUTC,
+		noLimitRewrite: pq.noLimitRewrite,
+		noIdentRewrite: pq.noIdentRewrite,
+		bindDurs:       pq.bindDurs,
+	}
+	npq.Args = npq.applyOptions(args)
+
+	switch {
+	case pq.noRewrite:
+		npq.markPrepared()
+		npq.err = npq.validateRewritten()
+	case pq.prepared:
+		npq.Prepare()
+	}
+
+	return &npq
+}
+
+func (pq *PreparedQuery) modifyQuery4Postgres() {
+	q := pq.Query
+
+	if !pq.noUTC {
+		q = strings.Replace(q, "now()", "now() at time zone 'UTC'", -1)
+		q = strings.Replace(q, "current_timestamp", "current_timestamp at time zone 'UTC'", -1)
+	}
+	q = strings.Replace(q, "DATE ?", "?", -1)
+	q = strings.Replace(q, "TIMESTAMP ?", "?", -1)
+	q = strings.Replace(q, "date ?", "?", -1)
+	q = strings.Replace(q, "timestamp ?", "?", -1)
+
+	pq.Query = q
+
+	pq.translateIntervals()
+	pq.translateJSON()
+	pq.translateRegexpLike()
+	pq.rewriteSetOperators()
+	pq.normalizeNullFunctions()
+}
+
+func (pq *PreparedQuery) modifyQuery4MySQL() {
+	q := pq.Query
+
+	backquote := `` + "`" + ``
+	if !pq.noUTC {
+		q = strings.Replace(q, "now()", "UTC_TIMESTAMP()", -1)
+		q = strings.Replace(q, "current_timestamp", "UTC_TIMESTAMP()", -1)
+	}
+	q = strings.Replace(q, "DATE ?", "?", -1)
+	q = strings.Replace(q, "TIMESTAMP ?", "?", -1)
+	q = strings.Replace(q, "date ?", "?", -1)
+	q = strings.Replace(q, "timestamp ?", "?", -1)
+	if !pq.noIdentRewrite {
+		q = strings.Replace(q, `"`, backquote, -1)
+	}
+
+	pq.Query = q
+
+	pq.translateIntervals()
+	pq.translateJSON()
+	pq.translateRegexpLike()
+	pq.rewriteSetOperators()
+	pq.normalizeNullFunctions()
+}
+
+func (pq *PreparedQuery) modifyQuery4MSSQL() {
+	q := pq.Query
+
+	if !pq.noUTC {
+		q = strings.Replace(q, "now()", "getutcdate()", -1)
+		q = strings.Replace(q, "getdate()", "getutcdate()", -1)
+		q = strings.Replace(q, "current_timestamp", "getutcdate()", -1)
+	} else {
+		q = strings.Replace(q, "now()", "getdate()", -1)
+	}
+	q = strings.Replace(q, "DATE ?", "convert(date, ?)", -1)
+	q = strings.Replace(q, "TIMESTAMP ?", "convert(datetime, ?)", -1)
+	q = strings.Replace(q, "date ?", "convert(date, ?)", -1)
+	q = strings.Replace(q, "timestamp ?", "convert(datetime, ?)", -1)
+
+	pq.Query = q
+
+	pq.translateIntervals()
+	pq.translateJSON()
+	pq.translateRegexpLike()
+	pq.rewriteSetOperators()
+	pq.normalizeNullFunctions()
+	pq.mssqlLockingHints()
+	if !pq.noLimitRewrite {
+		pq.mssqlLimitAndOffset()
+	}
+}
+
+func (pq *PreparedQuery) modifyQuery4Oracle12c() {
+	q := pq.Query
+
+	if !pq.noUTC {
+		q = strings.Replace(q, "systimestamp", "sys_extract_utc(systimestamp)", -1)
+		q = strings.Replace(q, "now()", "sys_extract_utc(systimestamp)", -1)
+		q = strings.Replace(q, "sysdate", "sys_extract_utc(systimestamp)", -1)
+		q = strings.Replace(q, "current_timestamp", "sys_extract_utc(systimestamp)", -1)
+	} else {
+		q = strings.Replace(q, "now()", "systimestamp", -1)
+	}
+	q = strings.Replace(q, "DATE ?", "to_date(?, 'yyyy-mm-dd')", -1)
+	q = strings.Replace(q, "TIMESTAMP ?", "to_timestamp(?, 'yyyy-mm-dd HH:mm:ss')", -1)
+	q = strings.Replace(q, "date ?", "to_date(?, 'yyyy-mm-dd')", -1)
+	q = strings.Replace(q, "timestamp ?", "to_timestamp(?, 'yyyy-mm-dd HH:mm:ss')", -1)
+
+	pq.Query = q
+
+	pq.translateIntervals()
+	pq.translateJSON()
+	pq.translateRegexpLike()
+	pq.rewriteSetOperators()
+	pq.normalizeNullFunctions()
+	if !pq.noLimitRewrite {
+		pq.oracle12cLimitAndOffset()
+	}
+}
+
+func (pq *PreparedQuery) modifyQuery4Oracle11g() {
+	q := pq.Query
+
+	if !pq.noUTC {
+		q = strings.Replace(q, "systimestamp", "sys_extract_utc(systimestamp)", -1)
+		q = strings.Replace(q, "now()", "sys_extract_utc(systimestamp)", -1)
+		q = strings.Replace(q, "sysdate", "sys_extract_utc(systimestamp)", -1)
+		q = strings.Replace(q, "current_timestamp", "sys_extract_utc(systimestamp)", -1)
+	} else {
+		q = strings.Replace(q, "now()", "systimestamp", -1)
+	}
+	q = strings.Replace(q, "DATE ?", "to_date(?, 'yyyy-mm-dd')", -1)
+	q = strings.Replace(q, "TIMESTAMP ?", "to_timestamp(?, 'yyyy-mm-dd HH:mm:ss')", -1)
+	q = strings.Replace(q, "date ?", "to_date(?, 'yyyy-mm-dd')", -1)
+	q = strings.Replace(q, "timestamp ?", "to_timestamp(?, 'yyyy-mm-dd HH:mm:ss')", -1)
+
+	pq.Query = q
+
+	pq.translateIntervals()
+	pq.translateJSON()
+	pq.translateRegexpLike()
+	pq.rewriteSetOperators()
+	pq.normalizeNullFunctions()
+	pq.renameFunction("COALESCE", "NVL", 2)
+	if !pq.noLimitRewrite {
+		pq.oracle11gLimitAndOffset()
+	}
+}
+
+func (pq *PreparedQuery) modifyQuery4Sqlite() {
+	q := pq.Query
+
+	if !pq.noUTC {
+		q = strings.Replace(q, "now()", "strftime('%Y-%m-%d %H:%M:%f','now')", -1)
+		q = strings.Replace(q, "current_timestamp", "strftime('%Y-%m-%d %H:%M:%f','now')", -1)
+	} else {
+		q = strings.Replace(q, "now()", "strftime('%Y-%m-%d %H:%M:%f','now','localtime')", -1)
+		q = strings.Replace(q, "current_timestamp", "strftime('%Y-%m-%d %H:%M:%f','now','localtime')", -1)
+	}
+	q = strings.Replace(q, "DATE ?", "date(?)", -1)
+	q = strings.Replace(q, "TIMESTAMP ?", "datetime(?)", -1)
+	q = strings.Replace(q, "date ?", "date(?)", -1)
+	q = strings.Replace(q, "timestamp ?", "datetime(?)", -1)
+
+	pq.Query = q
+
+	pq.translateIntervals()
+	pq.translateJSON()
+	pq.translateRegexpLike()
+	pq.rewriteSetOperators()
+	pq.normalizeNullFunctions()
+	pq.removeForUpdate()
+}
+
+// normalizeNullFunctions - rewrites the 2 argument ISNULL, IFNULL and NVL into COALESCE
+func (pq *PreparedQuery) normalizeNullFunctions() {
+	pq.renameFunction("ISNULL", "COALESCE", 2)
+	pq.renameFunction("IFNULL", "COALESCE", 2)
+	pq.renameFunction("NVL", "COALESCE", 2)
+}
+
+// renameFunction - renames calls of function from (case insensitive) to function to.
+// Only calls with nargs arguments are renamed. nargs < 0 renames all calls
+func (pq *PreparedQuery) renameFunction(from string, to string, nargs int) {
+	var qbuf bytes.Buffer
+	q := pq.Query
+	uq := asciiUpper(q)
+	from = asciiUpper(from)
+	pos := 0
+	changed := false
+
+	for {
+		idx := strings.Index(uq[pos:], from)
+		if idx < 0 {
+			break
+		}
+
+		start := pos + idx
+		end := start + len(from)
+
+		// skip spaces between the function name and the parenthesis
+		paren := end
+		for paren < len(q) && IsWhiteSpace(q[paren:paren+1]) {
+			paren++
+		}
+
+		isCall := paren < len(q) && q[paren] == '(' &&
+			(start == 0 || !isIdentChar(q[start-1])) &&
+			(nargs < 0 || countCallArgs(q, paren) == nargs)
+
+		qbuf.WriteString(q[pos:start])
+		if isCall {
+			qbuf.WriteString(to)
+			changed = true
+		} else {
+			qbuf.WriteString(q[start:end])
+		}
+
+		pos = end
+	}
+
+	if !changed {
+		return
+	}
+
+	qbuf.WriteString(q[pos:])
+	pq.Query = qbuf.String()
+}
+
+// countCallArgs - counts the top level arguments of the call whose parenthesis opens at paren
+func countCallArgs(q string, paren int) int {
+	depth := 0
+	args := 1
+	empty := true
+	inString := false
+
+	for i := paren; i < len(q); i++ {
+		c := q[i]
+
+		if inString {
+			if c == '\'' {
+				inString = false
+			}
+			continue
+		}
+
+		switch c {
+		case '\'':
+			inString = true
+			empty = false
+		case '(':
+			depth++
+			if depth > 1 {
+				empty = false
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				if empty {
+					return 0
+				}
+				return args
+			}
+		case ',':
+			if depth == 1 {
+				args++
+			}
+		default:
+			if !IsWhiteSpace(string(c)) {
+				empty = false
+			}
+		}
+	}
+
+	return -1
+}
+
+// rewriteCalls - replaces the calls of the function name (case insensitive) by the text returned
+// by rewrite, which gets the position of the call and its trimmed top level arguments.
+// Nested calls are rewritten first
+func (pq *PreparedQuery) rewriteCalls(name string, rewrite func(pos int, args []string) (string, error)) {
+	if pq.err != nil {
+		return
+	}
+
+	q := pq.Query
+	positions := sqlWords(q, name, false)
+
+	for k := len(positions) - 1; k >= 0; k-- {
+		start := positions[k]
+		paren := skipSpacesForward(q, start+len(name))
+		if paren >= len(q) || q[paren] != '(' {
+			continue
+		}
+
+		end := closingParen(q, paren)
+		if end < 0 {
+			continue
+		}
+
+		args := splitTopLevel(q[paren+1:end], ',')
+		for i := range args {
+			args[i] = strings.TrimSpace(args[i])
+		}
+
+		call, err := rewrite(start, args)
+		if err != nil {
+			pq.err = err
+			return
+		}
+
+		q = q[:start] + call + q[end+1:]
+	}
+
+	pq.Query = q
+}
+
+// closingParen - returns the position of the parenthesis closing the one at open, -1 if none
+func closingParen(q string, open int) int {
+	depth := 0
+
+	for i := open; i < len(q); i++ {
+		switch q[i] {
+		case '\'':
+			end := strings.IndexByte(q[i+1:], '\'')
+			if end < 0 {
+				return -1
+			}
+			i += end + 1
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c == '#' ||
+		(c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// asciiUpper - uppercases only ASCII letters, so byte offsets are kept
+func asciiUpper(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'a' && c <= 'z' {
+			b[i] = c - ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+func (pq *PreparedQuery) replaceParamPlaceHolders() {
+	i := 1
+	pos := 0
+	idx := -1
+	var qbuf bytes.Buffer
+	l := len(pq.Query)
+
+	idx = strings.Index(pq.Query[pos:], "?")
+	if idx < 0 || len(pq.ParamPrefix) == 0 {
+		return
+	}
+
+	for {
+		if idx < 0 {
+			qbuf.WriteString(pq.Query[pos:])
+			break
+		} else {
+			qbuf.WriteString(pq.Query[pos : pos+idx])
+			pos += idx + 1
+		}
+
+		if pos < l-1 && pq.Query[pos:pos+1] == "?" {
+			qbuf.WriteString("?")
+			pos++
+		} else {
+			n := i
+			// named params used more than once reuse their number
+			if pq.slots != nil && i <= len(pq.slots) {
+				n = pq.slots[i-1] + 1
+			}
+			prm := fmt.Sprintf("%s%d", pq.ParamPrefix, n)
+			qbuf.WriteString(prm)
+			i++
+		}
+
+		idx = strings.Index(pq.Query[pos:], "?")
+	}
+
+	pq.Query = qbuf.String()
+}
+
+// rewriteSetOperators - writes the set operators as the database expects them:
+// MINUS becomes EXCEPT (MINUS in Oracle), the default DISTINCT modifier of EXCEPT and INTERSECT
+// is removed where it is not accepted and ALL is refused where it is not supported
+func (pq *PreparedQuery) rewriteSetOperators() {
+	except := "EXCEPT"
+	other := "MINUS"
+	allowDistinct := true
+	allowAll := true
+
+	switch pq.DbType {
+	case Oracle, Oci8:
+		except, other = other, except
+		allowDistinct = false
+	case Oracle11g:
+		except, other = other, except
+		allowDistinct = false
+		allowAll = false
+	case SQLServer, Sqlite3:
+		allowDistinct = false
+		allowAll = false
+	}
+
+	type setOp struct {
+		pos  int
+		word string
+	}
+
+	var ops []setOp
+	for _, w := range []string{except, other, "INTERSECT"} {
+		for _, pos := range sqlWords(pq.Query, w, false) {
+			ops = append(ops, setOp{pos: pos, word: w})
+		}
+	}
+
+	if len(ops) == 0 {
+		return
+	}
+
+	sort.Slice(ops, func(i, j int) bool { return ops[i].pos < ops[j].pos })
+
+	q := pq.Query
+	var qbuf bytes.Buffer
+	last := 0
+
+	for _, op := range ops {
+		end := op.pos + len(op.word)
+		name := op.word
+		if name == other {
+			name = except
+		}
+
+		// DISTINCT / ALL modifier
+		modStart := end
+		for modStart < len(q) && IsWhiteSpace(q[modStart:modStart+1]) {
+			modStart++
+		}
+		modEnd := modStart
+		for modEnd < len(q) && isIdentChar(q[modEnd]) {
+			modEnd++
+		}
+		modifier := strings.ToUpper(q[modStart:modEnd])
+
+		if modifier == "ALL" && !allowAll {
+			pq.err = fmt.Errorf("%s ALL is not supported in %s", name, pq.DbType)
+			return
+		}
+
+		qbuf.WriteString(q[last:op.pos])
+		if name != op.word {
+			qbuf.WriteString(matchCase(q[op.pos:end], name))
+		} else {
+			qbuf.WriteString(q[op.pos:end])
+		}
+		last = end
+
+		if modifier == "DISTINCT" && !allowDistinct {
+			last = modEnd
+		}
+	}
+
+	qbuf.WriteString(q[last:])
+	pq.Query = qbuf.String()
+}
+
+// matchCase - returns word lowercased if like is lowercase, uppercased otherwise
+func matchCase(like string, word string) string {
+	if like == strings.ToLower(like) {
+		return strings.ToLower(word)
+	}
+
+	return strings.ToUpper(word)
+}
+
+func (pq *PreparedQuery) mssqlLimitAndOffset() {
+	idx1 := strings.Index(pq.Query, "LIMIT ?")
+	idx2 := strings.Index(pq.Query, "OFFSET ?")
+	offsetLwCase := false
+
+	if idx1 < 0 {
+		idx1 = strings.Index(pq.Query, "limit ?")
+	}
+
+	if idx2 < 0 {
+		idx2 = strings.Index(pq.Query, "offset ?")
+		offsetLwCase = true
+	}
+
+	if idx1 > -1 {
+		if idx2 > -1 {
+			idx3 := idx1 + len("LIMIT ?")
+			idx4 := idx2 + len("OFFSET ?")
+			q1 := pq.Query[:idx1]
+			q2 := pq.Query[idx3:idx2]
+			q3 := pq.Query[idx4:]
+
+			pq.Query = fmt.Sprintf("%sOFFSET ? ROWS%sFETCH NEXT ? ROWS ONLY%s", q1, q2, q3)
+
+			if pq.Args != nil {
+				n := len(pq.Args)
+				if n >= 2 {
+					pq.Args = append(pq.Args[:n-2], pq.Args[n-1], pq.Args[n-2])
+				}
+			}
+		} else {
+			idx3 := idx1 + len("LIMIT ?")
+			q1 := pq.Query[:idx1]
+			q3 := pq.Query[idx3:]
+
+			pq.Query = fmt.Sprintf("%sOFFSET 0 ROWS\nFETCH NEXT ? ROWS ONLY%s", q1, q3)
+		}
+	} else if idx2 > -1 {
+		if offsetLwCase {
+			pq.Query = strings.Replace(pq.Query, "offset ?", "OFFSET ? ROWS", -1)
+		} else {
+			pq.Query = strings.Replace(pq.Query, "OFFSET ?", "OFFSET ? ROWS", -1)
+		}
+	}
+}
+
+func (pq *PreparedQuery) oracle12cLimitAndOffset() {
+	idx1 := strings.Index(pq.Query, "LIMIT ?")
+	idx2 := strings.Index(pq.Query, "OFFSET ?")
+	offsetLwCase := false
+
+	if idx1 < 0 {
+		idx1 = strings.Index(pq.Query, "limit ?")
+	}
+
+	if idx2 < 0 {
+		idx2 = strings.Index(pq.Query, "offset ?")
+		offsetLwCase = true
+	}
+
+	if (idx1 > -1 || idx2 > -1) && pq.oracleLimitForUpdate() {
+		return
+	}
+
+	if idx1 > -1 {
+		if idx2 > -1 {
+			idx3 := idx1 + len("LIMIT ?")
+			idx4 := idx2 + len("OFFSET ?")
+			q1 := pq.Query[:idx1]
+			q2 := pq.Query[idx3:idx2]
+			q3 := pq.Query[idx4:]
+
+			pq.Query = fmt.Sprintf("%sOFFSET ? ROWS%sFETCH NEXT ? ROWS ONLY%s", q1, q2, q3)
+
+			if pq.Args != nil {
+				n := len(pq.Args)
+				if n >= 2 {
+					pq.Args = append(pq.Args[:n-2], pq.Args[n-1], pq.Args[n-2])
+				}
+			}
+		} else {
+			idx3 := idx1 + len("LIMIT ?")
+			q1 := pq.Query[:idx1]
+			q3 := pq.Query[idx3:]
+
+			pq.Query = fmt.Sprintf("%sOFFSET 0 ROWS\nFETCH NEXT ? ROWS ONLY%s", q1, q3)
+		}
+	} else if idx2 > -1 {
+		if offsetLwCase {
+			pq.Query = strings.Replace(pq.Query, "offset ?", "OFFSET ? ROWS", -1)
+		} else {
+			pq.Query = strings.Replace(pq.Query, "OFFSET ?", "OFFSET ? ROWS", -1)
+		}
+	}
+}
+
+// oracle11gLimitAndOffset - emulates the top level "LIMIT ? OFFSET ?" by numbering the rows
+// with ROW_NUMBER() OVER (ORDER BY ...) when all the ORDER BY terms are selected columns,
+// else with rownum over the ordered query.
+// A leading WITH clause is kept in front of the wrapping query and whatever follows
+// the LIMIT / OFFSET clauses is kept after it
+func (pq *PreparedQuery) oracle11gLimitAndOffset() {
+	q := pq.Query
+	limitStart, limitEnd := paramClause(q, "LIMIT")
+	offsetStart, offsetEnd := paramClause(q, "OFFSET")
+
+	if limitStart < 0 && offsetStart < 0 {
+		return
+	}
+
+	if pq.oracleLimitForUpdate() {
+		return
+	}
+
+	start, end := limitStart, limitEnd
+	if start < 0 || (offsetStart >= 0 && offsetStart < start) {
+		start = offsetStart
+	}
+	if offsetEnd > end {
+		end = offsetEnd
+	}
+
+	bodyStart := withClauseEnd(q[:start])
+	with := q[:bodyStart]
+	body := strings.TrimSpace(q[bodyStart:start])
+	trailing := q[end:]
+
+	var where string
+
+	switch {
+	case limitStart > -1 && offsetStart > -1:
+		where = "rnumignore > ? AND rnumignore <= ?"
+
+		if pq.Args != nil {
+			li := countPlaceholders(q[:limitStart])
+			oi := countPlaceholders(q[:offsetStart])
+			nrRows, ok1 := intArg(pq.Args, li)
+			offset, ok2 := intArg(pq.Args, oi)
+			if !ok1 || !ok2 {
+				pq.err = fmt.Errorf("LIMIT and OFFSET must be bound to integer args")
+				return
+			}
+
+			// the lower bound comes first in the rewritten query
+			if li > oi {
+				li, oi = oi, li
+			}
+			pq.Args[li] = offset
+			pq.Args[oi] = offset + nrRows
+		}
+	case limitStart > -1:
+		where = "rnumignore <= ?"
+	default:
+		where = "rnumignore > ?"
+	}
+
+	rowNumber := "rownum"
+	orderBy := orderByClause(body)
+	if orderBy > -1 {
+		if order, ok := liftOrderBy(body[:orderBy], body[orderBy:]); ok {
+			rowNumber = "ROW_NUMBER() OVER (ORDER BY " + order + ")"
+			body = strings.TrimSpace(body[:orderBy])
+		}
+	} else {
+		rowNumber = "ROW_NUMBER() OVER (ORDER BY NULL)"
+	}
+
+	paging := fmt.Sprintf(`
+		SELECT * FROM (
+			SELECT a.*, %s rnumignore FROM (
+				%s
+			) a
+		) WHERE %s ORDER BY rnumignore
+	`, rowNumber, body, where)
+
+	pq.Query = with + paging + trailing
+}
+
+// orderByClause - returns the position of the top level ORDER BY of q, -1 if none
+func orderByClause(q string) int {
+	positions := topLevelWords(q, "ORDER")
+
+	for k := len(positions) - 1; k >= 0; k-- {
+		rest := strings.TrimLeft(q[positions[k]+len("ORDER"):], " \t\r\n")
+		if len(rest) >= 2 && strings.EqualFold(rest[:2], "BY") && (len(rest) == 2 || !isIdentChar(rest[2])) {
+			return positions[k]
+		}
+	}
+
+	return -1
+}
+
+// sqlIdent - an identifier, plain or double quoted
+const sqlIdent = `(?:[A-Za-z_][A-Za-z0-9_$#]*|"[^"]+")`
+
+// reColumnRef - a column, optionally qualified (t.col, schema.t.col)
+var reColumnRef = regexp.MustCompile(`^(?:` + sqlIdent + `\.)*(` + sqlIdent + `)$`)
+
+// reOrderTerm - an ORDER BY term: a column and its ASC / DESC, NULLS FIRST / LAST options
+var reOrderTerm = regexp.MustCompile(`(?is)^(.*?)((?:\s+(?:ASC|DESC))?(?:\s+NULLS\s+(?:FIRST|LAST))?)$`)
+
+// reColumnAlias - an expression with an "AS alias"
+var reColumnAlias = regexp.MustCompile(`(?is)\sAS\s+(` + sqlIdent + `)$`)
+
+// liftOrderBy - returns the terms of the "ORDER BY ..." clause orderBy, usable over the wrapped query
+// selectPart. Only terms naming a selected column (or its alias) are usable, as the name of
+// the column in the wrapped query: for the others (expressions, columns not selected,
+// positions, SELECT *) false is returned
+func liftOrderBy(selectPart string, orderBy string) (string, bool) {
+	order := strings.TrimSpace(orderBy[len("ORDER"):])
+	order = strings.TrimSpace(order[len("BY"):])
+
+	columns := selectedColumns(selectPart)
+	terms := splitTopLevel(order, ',')
+	lifted := make([]string, 0, len(terms))
+
+	for _, term := range terms {
+		m := reOrderTerm.FindStringSubmatch(strings.TrimSpace(term))
+		ref := reColumnRef.FindStringSubmatch(strings.TrimSpace(m[1]))
+		if ref == nil || !columns[identKey(ref[1])] {
+			return "", false
+		}
+
+		lifted = append(lifted, ref[1]+m[2])
+	}
+
+	return strings.Join(lifted, ", "), true
+}
+
+// selectedColumns - the names of the columns selected by the first top level SELECT of q,
+// as identKey: the plain or qualified columns and the aliases. The expressions without alias
+// and the * are not listed
+func selectedColumns(q string) map[string]bool {
+	columns := make(map[string]bool)
+
+	selects := topLevelWords(q, "SELECT")
+	if len(selects) == 0 {
+		return columns
+	}
+
+	list := q[selects[0]+len("SELECT"):]
+	for _, pos := range topLevelWords(q, "FROM") {
+		if pos > selects[0] {
+			list = q[selects[0]+len("SELECT") : pos]
+			break
+		}
+	}
+
+	for i, item := range splitTopLevel(list, ',') {
+		item = strings.TrimSpace(item)
+		if i == 0 {
+			item = trimWord(trimWord(item, "DISTINCT"), "ALL")
+		}
+
+		if m := reColumnRef.FindStringSubmatch(item); m != nil {
+			columns[identKey(m[1])] = true
+			continue
+		}
+
+		if m := reColumnAlias.FindStringSubmatch(item); m != nil {
+			columns[identKey(m[1])] = true
+			continue
+		}
+
+		// expr alias, expr ending with a value (not an operator) before the alias
+		fields := strings.Fields(item)
+		if len(fields) < 2 {
+			continue
+		}
+
+		alias := fields[len(fields)-1]
+		expr := strings.TrimSpace(item[:len(item)-len(alias)])
+		last := expr[len(expr)-1]
+		if reColumnRef.MatchString(alias) && !strings.Contains(alias, ".") &&
+			(isIdentChar(last) || last == ')' || last == '\'' || last == '"') {
+			columns[identKey(alias)] = true
+		}
+	}
+
+	return columns
+}
+
+// trimWord - removes the leading keyword word (case insensitive) of s
+func trimWord(s string, word string) string {
+	if len(s) > len(word) && strings.EqualFold(s[:len(word)], word) && !isIdentChar(s[len(word)]) {
+		return strings.TrimSpace(s[len(word):])
+	}
+
+	return s
+}
+
+// identKey - the name of the identifier id as Oracle resolves it: quoted as is, else uppercased
+func identKey(id string) string {
+	if strings.HasPrefix(id, `"`) {
+		return strings.Trim(id, `"`)
+	}
+
+	return strings.ToUpper(id)
+}
+
+// paramClause - returns the start and end of the last top level "word ?" clause (ex: LIMIT ?), -1 if none
+func paramClause(q string, word string) (int, int) {
+	positions := topLevelWords(q, word)
+
+	for k := len(positions) - 1; k >= 0; k-- {
+		i := positions[k] + len(word)
+		for i < len(q) && IsWhiteSpace(q[i:i+1]) {
+			i++
+		}
+
+		if i < len(q) && q[i] == '?' && (i+1 == len(q) || q[i+1] != '?') {
+			return positions[k], i + 1
+		}
+	}
+
+	return -1, -1
+}
+
+// withClauseEnd - returns the position of the main SELECT of a query starting with a WITH clause, 0 otherwise
+func withClauseEnd(q string) int {
+	with := topLevelWords(q, "WITH")
+	if len(with) == 0 || strings.TrimSpace(q[:with[0]]) != "" {
+		return 0
+	}
+
+	for _, pos := range topLevelWords(q, "SELECT") {
+		if pos > with[0] {
+			return pos
+		}
+	}
+
+	return 0
+}
+
+// intArg - returns args[k] as an int64, if it is an integer
+func intArg(args []interface{}, k int) (int64, bool) {
+	if k < 0 || k >= len(args) {
+		return 0, false
+	}
+
+	arg := args[k]
+	if valuer, ok := arg.(driver.Valuer); ok {
+		val, err := valuer.Value()
+		if err != nil {
+			return 0, false
+		}
+		arg = val
+	}
+
+	v := reflect.ValueOf(arg)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), true
+	}
+
+	return 0, false
+}
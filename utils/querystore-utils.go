@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// QueryStore - named SQL queries, usually loaded from .sql files
+type QueryStore struct {
+	sync.RWMutex
+	queries map[string]string
+}
+
+// NewQueryStore - instantiates an empty QueryStore
+func NewQueryStore() *QueryStore {
+	return &QueryStore{
+		queries: make(map[string]string),
+	}
+}
+
+// NewQueryStoreFromFS - loads the files matching pattern from fsys (ex: "queries/*.sql").
+// Each query is named after its file name, without extension
+func NewQueryStoreFromFS(fsys fs.FS, pattern string) (*QueryStore, error) {
+	qs := NewQueryStore()
+
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, err
+		}
+
+		base := path.Base(name)
+		qs.Add(strings.TrimSuffix(base, path.Ext(base)), string(content))
+	}
+
+	return qs, nil
+}
+
+// Add - adds (or replaces) a named query
+func (qs *QueryStore) Add(name string, query string) {
+	qs.Lock()
+	defer qs.Unlock()
+
+	qs.queries[name] = query
+}
+
+// Get - returns a named query
+func (qs *QueryStore) Get(name string) (string, bool) {
+	qs.RLock()
+	defer qs.RUnlock()
+
+	q, ok := qs.queries[name]
+	return q, ok
+}
+
+// Names - returns the sorted query names
+func (qs *QueryStore) Names() []string {
+	qs.RLock()
+	defer qs.RUnlock()
+
+	names := make([]string, 0, len(qs.queries))
+	for name := range qs.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// PQuery - prepares a named query for running with dbutl
+func (qs *QueryStore) PQuery(dbutl *DbUtils, name string, args ...interface{}) (*PreparedQuery, error) {
+	q, ok := qs.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("query %s not found", name)
+	}
+
+	return dbutl.PQuery(q, args...), nil
+}
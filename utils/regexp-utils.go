@@ -0,0 +1,127 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// translateRegexpLike - translates REGEXP_LIKE(expr, pattern [, flags]) (flags 'i' or 'c')
+// into expr ~ pattern (~* with 'i') in Postgres and expr REGEXP pattern in MySQL and SQLite
+// (SQLite needs a regexp function registered by the driver). Oracle supports REGEXP_LIKE.
+// SQL Server has no regular expressions: patterns made only of literal text, optionally
+// anchored with ^ and $, are rewritten as LIKE, anything else is an error
+func (pq *PreparedQuery) translateRegexpLike() {
+	pq.rewriteCalls("REGEXP_LIKE", func(pos int, args []string) (string, error) {
+		if len(args) < 2 || len(args) > 3 {
+			return "", fmt.Errorf("REGEXP_LIKE expects 2 or 3 arguments (expr, pattern, flags), got %d", len(args))
+		}
+
+		expr, pattern := args[0], args[1]
+		flags := ""
+		if len(args) == 3 {
+			flags = strings.Trim(args[2], "'")
+			if flags != "i" && flags != "c" {
+				return "", fmt.Errorf("REGEXP_LIKE flags must be 'i' or 'c', got %s", args[2])
+			}
+		}
+
+		switch pq.DbType {
+		case Postgres:
+			if flags == "i" {
+				return "(" + expr + " ~* " + pattern + ")", nil
+			}
+			return "(" + expr + " ~ " + pattern + ")", nil
+		case MySQL:
+			if flags != "" {
+				return "REGEXP_LIKE(" + expr + ", " + pattern + ", '" + flags + "')", nil
+			}
+			return "(" + expr + " REGEXP " + pattern + ")", nil
+		case Sqlite3:
+			if flags != "" {
+				return "", fmt.Errorf("REGEXP_LIKE flags are not supported in SQLite")
+			}
+			return "(" + expr + " REGEXP " + pattern + ")", nil
+		case SQLServer:
+			return pq.regexpAsLike(pos, expr, pattern)
+		default:
+			return "REGEXP_LIKE(" + strings.Join(args, ", ") + ")", nil
+		}
+	})
+}
+
+// regexpAsLike - SQL Server fallback of REGEXP_LIKE: the pattern (a literal or a string arg)
+// must be literal text, optionally anchored with ^ and $
+func (pq *PreparedQuery) regexpAsLike(pos int, expr string, pattern string) (string, error) {
+	if pattern == "?" {
+		k := countPlaceholders(pq.Query[:pos]) + countPlaceholders(expr)
+		if k >= len(pq.Args) {
+			return "", fmt.Errorf("no arg for the REGEXP_LIKE pattern")
+		}
+
+		re, ok := pq.Args[k].(string)
+		if !ok {
+			return "", fmt.Errorf("REGEXP_LIKE in SQL Server needs a string pattern")
+		}
+
+		like, ok := regexpToLike(re)
+		if !ok {
+			return "", fmt.Errorf("REGEXP_LIKE is not supported in SQL Server (pattern %q is not plain text)", re)
+		}
+
+		pq.Args[k] = like
+		return "(" + expr + " LIKE ?)", nil
+	}
+
+	if len(pattern) < 2 || pattern[0] != '\'' || pattern[len(pattern)-1] != '\'' {
+		return "", fmt.Errorf("REGEXP_LIKE is not supported in SQL Server (pattern %s)", pattern)
+	}
+
+	re := strings.Replace(pattern[1:len(pattern)-1], "''", "'", -1)
+	like, ok := regexpToLike(re)
+	if !ok {
+		return "", fmt.Errorf("REGEXP_LIKE is not supported in SQL Server (pattern %s is not plain text)", pattern)
+	}
+
+	return "(" + expr + " LIKE '" + strings.Replace(like, "'", "''", -1) + "')", nil
+}
+
+// regexpToLike - converts a regular expression made of literal text, optionally anchored with
+// ^ and $, into a SQL Server LIKE pattern
+func regexpToLike(re string) (string, bool) {
+	prefix, suffix := "%", "%"
+
+	if strings.HasPrefix(re, "^") {
+		prefix = ""
+		re = re[1:]
+	}
+
+	if strings.HasSuffix(re, "$") && !strings.HasSuffix(re, `\$`) {
+		suffix = ""
+		re = re[:len(re)-1]
+	}
+
+	var like strings.Builder
+	like.WriteString(prefix)
+
+	for i := 0; i < len(re); i++ {
+		c := re[i]
+
+		if c == '\\' && i+1 < len(re) && strings.IndexByte(`.^$*+?()[]{}|\`, re[i+1]) >= 0 {
+			i++
+			c = re[i]
+		} else if strings.IndexByte(`.^$*+?()[]{}|\`, c) >= 0 {
+			return "", false
+		}
+
+		// LIKE wildcards are matched literally
+		if c == '%' || c == '_' || c == '[' {
+			like.WriteString("[" + string(c) + "]")
+		} else {
+			like.WriteByte(c)
+		}
+	}
+
+	like.WriteString(suffix)
+
+	return like.String(), true
+}
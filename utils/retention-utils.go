@@ -0,0 +1,375 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Locker - distributed lock used to elect the instance running the purges.
+// TryLock returns false if another instance holds the lock. DbLocker implements it
+type Locker interface {
+	TryLock(ctx context.Context, name string) (bool, error)
+	Unlock(ctx context.Context, name string) error
+}
+
+// TableRetention - rows of Table older than MaxAge (by TimeColumn) are deleted,
+// BatchSize rows at a time, identified by KeyColumn
+type TableRetention struct {
+	Table      string
+	KeyColumn  string
+	TimeColumn string
+	MaxAge     time.Duration
+	BatchSize  int
+}
+
+// DirRetention - files in Dir matching Pattern, last modified more than MaxAge ago, are deleted
+type DirRetention struct {
+	Dir     string
+	Pattern string
+	MaxAge  time.Duration
+}
+
+// RetentionResult - outcome of one policy
+type RetentionResult struct {
+	Name    string `json:"name"`
+	Deleted int64  `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// RetentionSummary - outcome of a purge run
+type RetentionSummary struct {
+	Start   time.Time         `json:"start"`
+	End     time.Time         `json:"end"`
+	Skipped bool              `json:"skipped"`
+	Results []RetentionResult `json:"results"`
+}
+
+// RetentionRegistry - registry of the retention policies of the application subsystems
+type RetentionRegistry struct {
+	sync.RWMutex
+	schedule
+	healthGate
+	dbutl    *DbUtils
+	audit    *AuditLog
+	locker   Locker
+	lockName string
+	beat     time.Duration
+	tables   []TableRetention
+	dirs     []DirRetention
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// NewRetentionRegistry - instantiates a RetentionRegistry. audit may be nil
+func NewRetentionRegistry(dbutl *DbUtils, audit *AuditLog) *RetentionRegistry {
+	return &RetentionRegistry{
+		dbutl:    dbutl,
+		audit:    audit,
+		lockName: "retention",
+	}
+}
+
+// SetLocker - runs the purges only on the instance holding the named lock
+func (r *RetentionRegistry) SetLocker(locker Locker, name string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.locker = locker
+	r.lockName = name
+}
+
+// SetHeartbeat - writes a Heartbeat row, named as the lock ("retention" by default), while a run
+// is in progress, updated every interval with the policy being purged. 0 disables it
+func (r *RetentionRegistry) SetHeartbeat(interval time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.beat = interval
+}
+
+// AddTable - registers a table retention policy
+func (r *RetentionRegistry) AddTable(p TableRetention) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.tables = append(r.tables, p)
+}
+
+// AddAuditLog - registers the retention policy of the audit_log table, whose rows are
+// identified by keyColumn (its primary key, audit_log_id in the tables of the Readme)
+func (r *RetentionRegistry) AddAuditLog(keyColumn string, maxAge time.Duration) {
+	r.AddTable(TableRetention{
+		Table:      "audit_log",
+		KeyColumn:  keyColumn,
+		TimeColumn: "log_time",
+		MaxAge:     maxAge,
+	})
+}
+
+// AddDir - registers a directory retention policy (ex: temporary export files)
+func (r *RetentionRegistry) AddDir(p DirRetention) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.dirs = append(r.dirs, p)
+}
+
+// Start - runs the purges every interval in the background. Stop must be called to end them.
+// The runs are skipped while the system is unhealthy (see SetHealthChecker)
+func (r *RetentionRegistry) Start(interval time.Duration) error {
+	if err := checkInterval(interval); err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	if r.cancel != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.setNextRun(time.Now().Add(interval))
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-ticker.C:
+				r.setNextRun(t.Add(interval))
+				if r.healthy() {
+					r.Run(ctx)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop - stops the background purges
+func (r *RetentionRegistry) Stop() {
+	r.Lock()
+	cancel := r.cancel
+	r.cancel = nil
+	r.Unlock()
+
+	if cancel != nil {
+		cancel()
+		r.wg.Wait()
+		r.setNextRun(time.Time{})
+	}
+}
+
+// Run - runs all policies once and writes a summary audit entry
+func (r *RetentionRegistry) Run(ctx context.Context) (RetentionSummary, error) {
+	r.RLock()
+	locker := r.locker
+	lockName := r.lockName
+	beat := r.beat
+	tables := append([]TableRetention(nil), r.tables...)
+	dirs := append([]DirRetention(nil), r.dirs...)
+	r.RUnlock()
+
+	summary := RetentionSummary{
+		Start: time.Now().UTC(),
+	}
+
+	if locker != nil {
+		ok, err := locker.TryLock(ctx, lockName)
+		if err != nil {
+			return summary, err
+		}
+
+		if !ok {
+			summary.Skipped = true
+			summary.End = time.Now().UTC()
+			return summary, nil
+		}
+		defer locker.Unlock(ctx, lockName)
+	}
+
+	var hb *Heartbeat
+	if beat > 0 {
+		hb = NewHeartbeat(r.dbutl, lockName, beat)
+		if err := hb.Start(); err != nil {
+			summary.End = time.Now().UTC()
+			return summary, fmt.Errorf("retention heartbeat: %w", err)
+		}
+	}
+
+	progress := func(name string) {
+		if hb != nil {
+			hb.SetProgress(fmt.Sprintf("%s (%d/%d)", name, len(summary.Results)+1, len(tables)+len(dirs)))
+		}
+	}
+
+	failed := 0
+	var total int64
+
+	for _, p := range tables {
+		progress(p.Table)
+		n, err := r.purgeTable(ctx, p)
+		res := RetentionResult{Name: p.Table, Deleted: n}
+		if err != nil {
+			res.Error = err.Error()
+			failed++
+		}
+		total += n
+		summary.Results = append(summary.Results, res)
+	}
+
+	for _, p := range dirs {
+		progress(p.Dir)
+		n, err := purgeDir(ctx, p)
+		res := RetentionResult{Name: p.Dir, Deleted: n}
+		if err != nil {
+			res.Error = err.Error()
+			failed++
+		}
+		total += n
+		summary.Results = append(summary.Results, res)
+	}
+
+	summary.End = time.Now().UTC()
+
+	var err error
+	if failed > 0 {
+		err = fmt.Errorf("%d retention policies failed", failed)
+	}
+
+	if hb != nil {
+		if herr := hb.Stop(); err == nil && herr != nil {
+			err = fmt.Errorf("retention heartbeat: %w", herr)
+		}
+	}
+
+	if r.audit != nil {
+		r.audit.Log(err, "retention", "retention run",
+			"policies", len(summary.Results),
+			"deleted", total,
+			"elapsed", summary.End.Sub(summary.Start).String(),
+			"elapsed_ms", DurationToMillis(summary.End.Sub(summary.Start)))
+	}
+
+	return summary, err
+}
+
+func (r *RetentionRegistry) purgeTable(ctx context.Context, p TableRetention) (int64, error) {
+	if !identRegexp.MatchString(p.Table) {
+		return 0, fmt.Errorf("invalid table name: %s", p.Table)
+	}
+
+	for _, col := range []string{p.KeyColumn, p.TimeColumn} {
+		if !identRegexp.MatchString(col) {
+			return 0, fmt.Errorf("invalid column name: %s", col)
+		}
+	}
+
+	batchSize := p.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	cutoff := time.Now().UTC().Add(-p.MaxAge)
+	var deleted int64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+
+		// the time column is selected, so the ORDER BY can be kept by the paging rewrites
+		pq := r.dbutl.PQuery(fmt.Sprintf(`
+			SELECT %s, %s FROM %s WHERE %s < ? ORDER BY %s LIMIT ?
+		`, p.KeyColumn, p.TimeColumn, p.Table, p.TimeColumn, p.TimeColumn), cutoff, batchSize)
+
+		var keys []interface{}
+		var dest []interface{}
+		err := r.dbutl.ForEachRow(pq, func(row *sql.Rows, sc *SQLScan) error {
+			// the key is the first column, the others (time, row number of the paging) are ignored
+			if dest == nil {
+				cols, err := row.Columns()
+				if err != nil {
+					return err
+				}
+
+				dest = make([]interface{}, len(cols))
+				for i := range dest {
+					dest[i] = new(interface{})
+				}
+			}
+
+			if err := row.Scan(dest...); err != nil {
+				return err
+			}
+			keys = append(keys, *dest[0].(*interface{}))
+			return nil
+		})
+
+		if err != nil {
+			return deleted, err
+		}
+
+		if len(keys) == 0 {
+			return deleted, nil
+		}
+
+		n, err := r.dbutl.DeleteByKeys(p.Table, p.KeyColumn, keys, batchSize, nil)
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+
+		// the same rows would be selected again (ex: NULL keys)
+		if n == 0 || len(keys) < batchSize {
+			return deleted, nil
+		}
+	}
+}
+
+func purgeDir(ctx context.Context, p DirRetention) (int64, error) {
+	pattern := p.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	files, err := filepath.Glob(filepath.Join(p.Dir, pattern))
+	if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-p.MaxAge)
+	var deleted int64
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return deleted, err
+		}
+
+		info, err := os.Stat(f)
+		if err != nil || !info.Mode().IsRegular() || !info.ModTime().Before(cutoff) {
+			continue
+		}
+
+		if err := os.Remove(f); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
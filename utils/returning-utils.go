@@ -0,0 +1,439 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ReturningResult - sql.Result of Exec for a statement with a RETURNING clause.
+// The returned rows belong to the call, so a PreparedQuery can be run by several goroutines:
+//
+//	res, err := dbutl.Exec(pq)
+//	rows := res.(*utils.ReturningResult).Returned()
+type ReturningResult struct {
+	// res - the driver result (Oracle, MySQL), nil when the rows were read as a query
+	res      sql.Result
+	affected int64
+	rows     [][]interface{}
+}
+
+// LastInsertId - the id of the driver result, where there is one (MySQL)
+func (r *ReturningResult) LastInsertId() (int64, error) {
+	if r.res != nil {
+		return r.res.LastInsertId()
+	}
+
+	return 0, errors.New("LastInsertId is not supported for statements with a RETURNING clause, use the returned values")
+}
+
+// RowsAffected - the number of affected (returned) rows
+func (r *ReturningResult) RowsAffected() (int64, error) {
+	if r.res != nil {
+		return r.res.RowsAffected()
+	}
+
+	return r.affected, nil
+}
+
+// Returned - returns the rows of the RETURNING clause read by the Exec call.
+// In Oracle and MySQL at most one row is returned. ExecReturning scans them into its
+// destinations instead, and leaves Returned empty
+func (r *ReturningResult) Returned() [][]interface{} {
+	return r.rows
+}
+
+// Returning - returns the columns of the RETURNING clause of the query, if any
+func (pq *PreparedQuery) Returning() []string {
+	return pq.returning
+}
+
+// translateReturning - translates the trailing "RETURNING col1, col2" clause of
+// INSERT, UPDATE and DELETE statements:
+//   - Postgres and SQLite (3.35+) support it as written
+//   - SQL Server: OUTPUT INSERTED.col1, INSERTED.col2 (DELETED.col for DELETE)
+//   - Oracle: RETURNING col1, col2 INTO ?, ? with sql.Out binds appended to Args
+//   - MySQL: the clause is removed, the value of a single column is taken from LastInsertId
+func (pq *PreparedQuery) translateReturning() {
+	q := strings.TrimRight(pq.Query, " \t\r\n;")
+
+	verb := ""
+	fields := strings.Fields(q)
+	if len(fields) > 0 {
+		verb = strings.ToUpper(fields[0])
+	}
+
+	if verb != "INSERT" && verb != "UPDATE" && verb != "DELETE" {
+		return
+	}
+
+	positions := topLevelWords(q, "RETURNING")
+	if len(positions) == 0 {
+		return
+	}
+
+	pos := positions[len(positions)-1]
+	clause := q[pos+len("RETURNING"):]
+
+	// already in the Oracle form
+	if len(topLevelWords(clause, "INTO")) > 0 {
+		return
+	}
+
+	cols := splitTopLevel(clause, ',')
+	for i, col := range cols {
+		cols[i] = strings.TrimSpace(col)
+		if cols[i] == "" {
+			pq.err = errors.New("empty column in the RETURNING clause")
+			return
+		}
+	}
+
+	base := strings.TrimRight(q[:pos], " \t\r\n")
+	pq.returning = cols
+
+	switch pq.DbType {
+	case Postgres, Sqlite3:
+		// native
+
+	case MySQL:
+		if verb != "INSERT" || len(cols) > 1 {
+			pq.err = errors.New("MySQL supports RETURNING only for one column of an INSERT (taken from LastInsertId)")
+			return
+		}
+		pq.Query = base
+
+	case Oracle, Oracle11g, Oci8:
+		pq.Query = base + " RETURNING " + strings.Join(cols, ", ") + " INTO " + listPlaceholders(len(cols))
+		for range cols {
+			if pq.slots != nil {
+				pq.slots = append(pq.slots, len(pq.Args))
+			}
+			pq.Args = append(pq.Args, sql.Out{Dest: new(interface{})})
+		}
+
+	case SQLServer:
+		pq.Query, pq.err = mssqlOutputClause(base, verb, cols)
+	}
+}
+
+// mssqlOutputClause - inserts the OUTPUT clause equivalent to RETURNING cols in q
+func mssqlOutputClause(q string, verb string, cols []string) (string, error) {
+	prefix := "INSERTED."
+	if verb == "DELETE" {
+		prefix = "DELETED."
+	}
+
+	outCols := make([]string, len(cols))
+	for i, col := range cols {
+		if col != "*" && (!identRegexp.MatchString(col) || strings.Contains(col, ".")) {
+			return q, fmt.Errorf("RETURNING %s is not supported in SQL Server, only column names can be returned", col)
+		}
+		outCols[i] = prefix + col
+	}
+
+	var candidates []int
+	switch verb {
+	case "INSERT":
+		candidates = append(candidates, topLevelWords(q, "VALUES")...)
+		candidates = append(candidates, topLevelWords(q, "SELECT")...)
+		candidates = append(candidates, topLevelWords(q, "DEFAULT")...)
+	case "UPDATE":
+		candidates = append(candidates, topLevelWords(q, "FROM")...)
+		candidates = append(candidates, topLevelWords(q, "WHERE")...)
+	case "DELETE":
+		// DELETE [FROM] t [FROM t JOIN ...] [WHERE ...]
+		from := topLevelWords(q, "FROM")
+		if len(from) > 0 && strings.TrimSpace(q[len("DELETE"):from[0]]) == "" {
+			from = from[1:]
+		}
+		candidates = append(candidates, from...)
+		candidates = append(candidates, topLevelWords(q, "WHERE")...)
+	}
+
+	at := len(q)
+	for _, c := range candidates {
+		if c < at {
+			at = c
+		}
+	}
+
+	if verb == "INSERT" && at == len(q) {
+		return q, errors.New("RETURNING needs an INSERT ... VALUES or INSERT ... SELECT statement in SQL Server")
+	}
+
+	out := "OUTPUT " + strings.Join(outCols, ", ")
+	if at == len(q) {
+		return q + " " + out, nil
+	}
+
+	return q[:at] + out + " " + q[at:], nil
+}
+
+// execReturning - runs a statement with a RETURNING clause. The values of the first returned
+// row are scanned into dest if given, all returned rows are kept in the ReturningResult otherwise
+func (u *DbUtils) execReturning(tx *sql.Tx, pq *PreparedQuery, dest []interface{}) (sql.Result, error) {
+	n := len(pq.returning)
+	if dest != nil && len(dest) != n {
+		return nil, fmt.Errorf("expected %d destinations for the RETURNING clause, got %d", n, len(dest))
+	}
+
+	switch pq.DbType {
+	case Oracle, Oracle11g, Oci8:
+		holders := make([]interface{}, n)
+		target := dest
+		if target == nil {
+			target = make([]interface{}, n)
+			for i := range target {
+				target[i] = &holders[i]
+			}
+		}
+
+		// the out binds are the last args
+		args := append(make([]interface{}, 0, len(pq.Args)), pq.Args...)
+		for i := 0; i < n; i++ {
+			args[len(args)-n+i] = sql.Out{Dest: target[i]}
+		}
+
+		res, err := u.execStmt(tx, pq, args)
+		if err != nil {
+			return res, err
+		}
+
+		r := &ReturningResult{res: res}
+		if dest == nil {
+			r.rows = [][]interface{}{holders}
+		}
+
+		return r, nil
+
+	case MySQL:
+		res, err := u.execStmt(tx, pq, pq.Args)
+		if err != nil {
+			return res, err
+		}
+
+		id, err := res.LastInsertId()
+		if err != nil {
+			return res, err
+		}
+
+		r := &ReturningResult{res: res}
+		if dest != nil {
+			err = assignInt64(dest[0], id)
+		} else {
+			r.rows = [][]interface{}{{id}}
+		}
+
+		return r, err
+	}
+
+	// the args were checked by the caller (exec or ExecReturningTx)
+	rows, err := u.queryStmt(tx, pq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	r := &ReturningResult{}
+	var affected int64
+	for rows.Next() {
+		affected++
+
+		if dest != nil {
+			if affected == 1 {
+				err = rows.Scan(dest...)
+			}
+		} else {
+			values := make([]interface{}, n)
+			pointers := make([]interface{}, n)
+			for i := range values {
+				pointers[i] = &values[i]
+			}
+
+			err = rows.Scan(pointers...)
+			r.rows = append(r.rows, values)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	r.affected = affected
+	if dest != nil && affected == 0 {
+		return r, sql.ErrNoRows
+	}
+
+	return r, nil
+}
+
+// ExecReturning - runs a statement with a RETURNING clause and scans the
+// returned values (of the first row) into dest
+func (u *DbUtils) ExecReturning(pq *PreparedQuery, dest ...interface{}) (sql.Result, error) {
+	return u.ExecReturningTx(nil, pq, dest...)
+}
+
+// ExecReturningTx - runs a statement with a RETURNING clause and scans the
+// returned values (of the first row) into dest (in a transaction)
+func (u *DbUtils) ExecReturningTx(tx *sql.Tx, pq *PreparedQuery, dest ...interface{}) (sql.Result, error) {
+	if err := pq.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(pq.returning) == 0 {
+		return nil, errors.New("query has no RETURNING clause")
+	}
+
+	if len(pq.tempLists) > 0 {
+		var res sql.Result
+		err := u.withTempLists(tx, pq, func(tx *sql.Tx, pq *PreparedQuery) error {
+			var err error
+			res, err = u.ExecReturningTx(tx, pq, dest...)
+			return err
+		})
+
+		return res, err
+	}
+
+	u.checkArgsUTC(pq)
+
+	start := time.Now()
+	res, err := u.execReturning(tx, pq, dest)
+	u.afterExec(pq, start, res, err)
+
+	return res, err
+}
+
+// assignInt64 - stores id into dest, a pointer to an integer or to an empty interface
+func assignInt64(dest interface{}, id int64) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("destination must be a non nil pointer")
+	}
+
+	e := v.Elem()
+	switch e.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		e.SetUint(uint64(id))
+	case reflect.Interface:
+		e.Set(reflect.ValueOf(id))
+	default:
+		return fmt.Errorf("cannot store the inserted id into %s", e.Type())
+	}
+
+	return nil
+}
+
+// topLevelWords - returns the positions of the keyword word (case insensitive) in q,
+// outside string literals, quoted identifiers, comments and parentheses
+func topLevelWords(q string, word string) []int {
+	return sqlWords(q, word, true)
+}
+
+// sqlWords - returns the positions of the keyword word (case insensitive) in q, outside string
+// literals, quoted identifiers and comments. With topLevel, the words inside parentheses are skipped
+func sqlWords(q string, word string, topLevel bool) []int {
+	var res []int
+	depth := 0
+
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+
+		switch c {
+		case '\'', '"', '`':
+			end := strings.IndexByte(q[i+1:], c)
+			if end < 0 {
+				return res
+			}
+			i += end + 1
+			continue
+		case '[':
+			end := strings.IndexByte(q[i+1:], ']')
+			if end < 0 {
+				return res
+			}
+			i += end + 1
+			continue
+		case '-':
+			if i+1 < len(q) && q[i+1] == '-' {
+				end := strings.IndexByte(q[i:], '\n')
+				if end < 0 {
+					return res
+				}
+				i += end
+				continue
+			}
+		case '/':
+			if i+1 < len(q) && q[i+1] == '*' {
+				end := strings.Index(q[i+2:], "*/")
+				if end < 0 {
+					return res
+				}
+				i += end + 3
+				continue
+			}
+		case '(':
+			depth++
+			continue
+		case ')':
+			depth--
+			continue
+		}
+
+		if (topLevel && depth != 0) || i+len(word) > len(q) || (i > 0 && isIdentChar(q[i-1])) {
+			continue
+		}
+
+		if strings.EqualFold(q[i:i+len(word)], word) &&
+			(i+len(word) == len(q) || !isIdentChar(q[i+len(word)])) {
+			res = append(res, i)
+			i += len(word) - 1
+		}
+	}
+
+	return res
+}
+
+// splitTopLevel - splits q by sep, outside string literals and parentheses
+func splitTopLevel(q string, sep byte) []string {
+	var parts []string
+	depth := 0
+	inString := false
+	last := 0
+
+	for i := 0; i < len(q); i++ {
+		c := q[i]
+
+		if inString {
+			if c == '\'' {
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '\'':
+			inString = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == sep && depth == 0:
+			parts = append(parts, q[last:i])
+			last = i + 1
+		}
+	}
+
+	return append(parts, q[last:])
+}
@@ -0,0 +1,458 @@
+package utils
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrStopRecurrence - returned by the callback of RecurrenceRule.ForEach to stop the iteration
+// (the rules without UNTIL or COUNT never end); ForEach then returns nil
+var ErrStopRecurrence = errors.New("stop recurrence")
+
+// Frequency - the FREQ of a RecurrenceRule
+type Frequency string
+
+const (
+	// Daily - FREQ=DAILY
+	Daily Frequency = "DAILY"
+	// Weekly - FREQ=WEEKLY
+	Weekly Frequency = "WEEKLY"
+	// Monthly - FREQ=MONTHLY
+	Monthly Frequency = "MONTHLY"
+	// Yearly - FREQ=YEARLY
+	Yearly Frequency = "YEARLY"
+)
+
+// maxEmptyPeriods - the periods without occurrences after which the iteration ends
+// (FREQ=YEARLY on Feb 29 has one every 4 years at most 8 apart)
+const maxEmptyPeriods = 1000
+
+var ruleDays = []string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// RuleDay - a BYDAY entry: a weekday, with its position in the month (FREQ=MONTHLY) or in the year
+// (FREQ=YEARLY) if N is not 0: 1MO is the first Monday, -1FR the last Friday
+type RuleDay struct {
+	N       int
+	Weekday time.Weekday
+}
+
+// String - formats the entry as in a RRULE: MO, 2TU, -1FR
+func (d RuleDay) String() string {
+	if d.N == 0 {
+		return ruleDays[d.Weekday]
+	}
+	return strconv.Itoa(d.N) + ruleDays[d.Weekday]
+}
+
+// RecurrenceRule - the subset of the iCalendar (RFC 5545) RRULE made of FREQ, INTERVAL, BYDAY,
+// UNTIL and COUNT: "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,TH;COUNT=10".
+// The occurrences are computed from a start time (DTSTART), keeping its wall clock and location.
+// It can be stored in a text column
+type RecurrenceRule struct {
+	Freq Frequency
+	// Interval - every how many periods, 1 if 0
+	Interval int
+	ByDay    []RuleDay
+	// Until - the last occurrence allowed (inclusive), none if zero
+	Until time.Time
+	// Count - the number of occurrences, unlimited if 0
+	Count int
+}
+
+// ParseRRule - parses a RRULE value, with or without the "RRULE:" prefix.
+// The other rule parts (BYMONTH, BYSETPOS, WKST, ...) are refused, weeks start on Monday
+func ParseRRule(s string) (*RecurrenceRule, error) {
+	r := new(RecurrenceRule)
+
+	str := strings.TrimSpace(s)
+	if len(str) >= 6 && strings.EqualFold(str[:6], "RRULE:") {
+		str = str[6:]
+	}
+
+	for _, part := range strings.Split(str, ";") {
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid rrule %q: %q is not a name=value pair", s, part)
+		}
+
+		name, value := strings.ToUpper(strings.TrimSpace(kv[0])), strings.TrimSpace(kv[1])
+
+		var err error
+		switch name {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && r.Interval < 1 {
+				err = errors.New("must be positive")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count < 1 {
+				err = errors.New("must be positive")
+			}
+		case "UNTIL":
+			r.Until, err = parseRRuleTime(value)
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				var d RuleDay
+				if d, err = parseRuleDay(day); err != nil {
+					break
+				}
+				r.ByDay = append(r.ByDay, d)
+			}
+		default:
+			return nil, fmt.Errorf("invalid rrule %q: %s is not supported", s, name)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid rrule %q: %s: %w", s, name, err)
+		}
+	}
+
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid rrule %q: %w", s, err)
+	}
+
+	return r, nil
+}
+
+func parseRuleDay(s string) (RuleDay, error) {
+	var d RuleDay
+
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if len(s) < 2 {
+		return d, fmt.Errorf("invalid day %q", s)
+	}
+
+	wd := -1
+	for i, name := range ruleDays {
+		if s[len(s)-2:] == name {
+			wd = i
+		}
+	}
+
+	if wd < 0 {
+		return d, fmt.Errorf("invalid day %q", s)
+	}
+	d.Weekday = time.Weekday(wd)
+
+	if n := s[:len(s)-2]; n != "" {
+		var err error
+		if d.N, err = strconv.Atoi(n); err != nil || d.N == 0 || d.N < -53 || d.N > 53 {
+			return d, fmt.Errorf("invalid day %q", s)
+		}
+	}
+
+	return d, nil
+}
+
+// parseRRuleTime - parses an UNTIL value: 20241231, 20241231T235959 (local) or 20241231T235959Z
+func parseRRuleTime(s string) (time.Time, error) {
+	switch {
+	case len(s) == 8:
+		return time.ParseInLocation("20060102", s, time.Local)
+	case strings.HasSuffix(s, "Z"):
+		return time.Parse("20060102T150405Z", s)
+	default:
+		return time.ParseInLocation("20060102T150405", s, time.Local)
+	}
+}
+
+// Validate - checks the rule: a known FREQ, and the BYDAY positions only for MONTHLY and YEARLY
+func (r *RecurrenceRule) Validate() error {
+	switch r.Freq {
+	case Daily, Weekly, Monthly, Yearly:
+	case "":
+		return errors.New("FREQ is missing")
+	default:
+		return fmt.Errorf("FREQ %s is not supported", r.Freq)
+	}
+
+	if r.Interval < 0 || r.Count < 0 {
+		return errors.New("INTERVAL and COUNT must be positive")
+	}
+
+	for _, d := range r.ByDay {
+		if d.N != 0 && (r.Freq == Daily || r.Freq == Weekly) {
+			return fmt.Errorf("BYDAY %s: the positions are only allowed with FREQ=MONTHLY or YEARLY", d)
+		}
+
+		if d.Weekday < time.Sunday || d.Weekday > time.Saturday {
+			return fmt.Errorf("BYDAY: invalid weekday %d", d.Weekday)
+		}
+	}
+
+	return nil
+}
+
+// String - formats the rule as a RRULE value (without the "RRULE:" prefix). UNTIL is written in UTC
+func (r *RecurrenceRule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Scan implements the sql.Scanner interface. NULL is an empty rule (Freq "")
+func (r *RecurrenceRule) Scan(value interface{}) error {
+	var s string
+
+	switch v := value.(type) {
+	case nil:
+		*r = RecurrenceRule{}
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a RecurrenceRule", value)
+	}
+
+	rule, err := ParseRRule(s)
+	if err != nil {
+		return err
+	}
+
+	*r = *rule
+	return nil
+}
+
+// Value implements the driver.Valuer interface. An empty rule (Freq "") is NULL
+func (r RecurrenceRule) Value() (driver.Value, error) {
+	if r.Freq == "" {
+		return nil, nil
+	}
+	return r.String(), nil
+}
+
+// ForEach - calls fn with each occurrence of the rule starting from dtstart, in order.
+// dtstart is an occurrence only if it matches the rule (as in python-dateutil, unlike RFC 5545
+// where it always counts as the first one). The days that do not exist (Feb 30) are skipped.
+// A non nil error returned by fn stops the iteration and is returned, except ErrStopRecurrence
+func (r *RecurrenceRule) ForEach(dtstart time.Time, fn func(t time.Time) error) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+
+	count := 0
+	empty := 0
+
+	for period := 0; empty < maxEmptyPeriods; period += interval {
+		found := false
+
+		for _, t := range r.periodOccurrences(dtstart, period) {
+			if t.Before(dtstart) {
+				continue
+			}
+
+			if !r.Until.IsZero() && t.After(r.Until) {
+				return nil
+			}
+
+			found = true
+
+			if err := fn(t); err != nil {
+				if err == ErrStopRecurrence {
+					return nil
+				}
+				return err
+			}
+
+			count++
+			if r.Count > 0 && count >= r.Count {
+				return nil
+			}
+		}
+
+		if found {
+			empty = 0
+		} else {
+			empty++
+		}
+	}
+
+	return nil
+}
+
+// Next - returns the first occurrence after the time after, false if there is none
+func (r *RecurrenceRule) Next(dtstart, after time.Time) (time.Time, bool) {
+	var next time.Time
+	found := false
+
+	r.ForEach(dtstart, func(t time.Time) error {
+		if !t.After(after) {
+			return nil
+		}
+
+		next, found = t, true
+		return ErrStopRecurrence
+	})
+
+	return next, found
+}
+
+// Between - returns the occurrences in [from, to)
+func (r *RecurrenceRule) Between(dtstart, from, to time.Time) []time.Time {
+	var list []time.Time
+
+	r.ForEach(dtstart, func(t time.Time) error {
+		if !t.Before(to) {
+			return ErrStopRecurrence
+		}
+
+		if !t.Before(from) {
+			list = append(list, t)
+		}
+		return nil
+	})
+
+	return list
+}
+
+// periodOccurrences - returns the sorted occurrences of the period number n from dtstart
+// (the day, week, month or year of dtstart for 0)
+func (r *RecurrenceRule) periodOccurrences(dtstart time.Time, n int) []time.Time {
+	y, m, d := dtstart.Date()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), dtstart.Nanosecond(), dtstart.Location())
+	}
+
+	var list []time.Time
+
+	switch r.Freq {
+	case Daily:
+		t := at(y, m, d+n)
+		if len(r.ByDay) == 0 || r.hasWeekday(t.Weekday()) {
+			list = append(list, t)
+		}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return []time.Time{at(y, m, d+7*n)}
+		}
+
+		// the weeks start on Monday
+		monday := d - (int(dtstart.Weekday())+6)%7 + 7*n
+		for i := 0; i < 7; i++ {
+			t := at(y, m, monday+i)
+			if r.hasWeekday(t.Weekday()) {
+				list = append(list, t)
+			}
+		}
+	case Monthly:
+		first := time.Date(y, m+time.Month(n), 1, 0, 0, 0, 0, time.UTC)
+		year, month := first.Year(), first.Month()
+		days := DaysInMonth(year, month)
+
+		if len(r.ByDay) == 0 {
+			if d <= days {
+				list = append(list, at(year, month, d))
+			}
+			break
+		}
+
+		for _, day := range r.matchingDays(first, days) {
+			list = append(list, at(year, month, day))
+		}
+	case Yearly:
+		year := y + n
+
+		if len(r.ByDay) == 0 {
+			if d <= DaysInMonth(year, m) {
+				list = append(list, at(year, m, d))
+			}
+			break
+		}
+
+		first := time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		days := 365
+		if IsLeapYear(year) {
+			days = 366
+		}
+
+		for _, day := range r.matchingDays(first, days) {
+			list = append(list, at(year, time.January, day))
+		}
+	}
+
+	return list
+}
+
+// matchingDays - returns the sorted days (1 based) of the period of length days starting on first
+// matching BYDAY
+func (r *RecurrenceRule) matchingDays(first time.Time, days int) []int {
+	seen := make(map[int]bool)
+	var list []int
+
+	for _, bd := range r.ByDay {
+		// the first day of the period with the weekday
+		start := 1 + (int(bd.Weekday)-int(first.Weekday())+7)%7
+		var candidates []int
+
+		switch {
+		case bd.N == 0:
+			for day := start; day <= days; day += 7 {
+				candidates = append(candidates, day)
+			}
+		case bd.N > 0:
+			candidates = append(candidates, start+7*(bd.N-1))
+		default:
+			last := start + 7*((days-start)/7)
+			candidates = append(candidates, last+7*(bd.N+1))
+		}
+
+		for _, day := range candidates {
+			if day >= 1 && day <= days && !seen[day] {
+				seen[day] = true
+				list = append(list, day)
+			}
+		}
+	}
+
+	sort.Ints(list)
+
+	return list
+}
+
+func (r *RecurrenceRule) hasWeekday(wd time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d.Weekday == wd {
+			return true
+		}
+	}
+	return false
+}
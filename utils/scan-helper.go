@@ -6,26 +6,69 @@ import (
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // SQLScan helper class for reading sql to Struct
 // Columns in struct must be marked with a `sql:"col_name"` tag
 // Ex: in sql a column name is col1, in struct the col tag must be `sql:"col1"`
+// Pointer fields (*string, *int64, *time.Time, etc) hold nullable columns: nil for NULL,
+// a newly allocated value otherwise.
+// Fields implementing sql.Scanner (ID, decimal types, etc) are passed to rows.Scan as they are.
+// Tag options follow the column name: `sql:"id,uuid"` reads a uuid into a [16]byte or string field,
+// `sql:"payload,json"` unmarshals a JSON column into a struct, map or slice field,
+// `sql:"status,enum=active:1;disabled:0"` maps the database codes of a string based enum field.
+// The column to field mapping is computed once per struct type and column set
+// and cached for the whole package (see scanPlan)
 type SQLScan struct {
 	sync.RWMutex
 	columnNames []string
+	rows        *sql.Rows
 	dateformats []string
+	plan        *scanPlan
+	location    *time.Location
+	positional  bool
+
+	// buffers reused across rows, sized by the plan
+	pointers []interface{}
+	texts    []sql.NullString
+	values   []interface{}
+	rnum     int
+	discard  interface{}
+}
+
+// SetLocation - sets the location of the times read without a time zone (Oracle, SQLite),
+// overriding DbUtils.SetScanLocation for this helper
+func (s *SQLScan) SetLocation(loc *time.Location) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.location = loc
+}
+
+// SetPositional - fills the struct fields in declaration order from the select list position,
+// ignoring the sql tags (see DbUtils.SetPositionalScan)
+func (s *SQLScan) SetPositional(positional bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.positional = positional
+	s.plan = nil
+	s.pointers = nil
 }
 
 // Clear - clears the columns array.
-// Used to be able to reuse the scan helper for another SQL
+// The columns are also read again when Scan gets another *sql.Rows
 func (s *SQLScan) Clear() {
 	s.Lock()
 	defer s.Unlock()
 
 	s.columnNames = nil
+	s.rows = nil
 	s.dateformats = nil
+	s.plan = nil
+	s.pointers = nil
 }
 
 // Scan - reads sql statement into a struct
@@ -34,129 +77,557 @@ func (s *SQLScan) Scan(u *DbUtils, rows *sql.Rows, dest interface{}) error {
 	defer s.Unlock()
 
 	isOracle := u.dbType == Oci8 || u.dbType == Oracle || u.dbType == Oracle11g
-	isSqlite := u.dbType == Sqlite3
 
-	if s.columnNames == nil || len(s.columnNames) == 0 {
+	loc := s.location
+	if loc == nil {
+		loc = u.scanLocation
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	// the columns are read again for another result set, so the helper can serve several queries
+	newRows := rows != s.rows
+	if newRows || len(s.columnNames) == 0 {
 		cols, err := rows.Columns()
 		if err != nil {
 			return err
 		}
 
+		// the names are kept as returned by the driver, the plan normalizes them for matching
+		s.rows = rows
 		s.columnNames = cols
+	}
 
-		if isOracle {
-			for i, colName := range s.columnNames {
-				if colName[0:1] != "\"" {
-					s.columnNames[i] = strings.ToLower(colName)
-				}
-			}
+	structVal := reflect.ValueOf(dest).Elem()
+
+	if newRows || s.plan == nil || s.plan.typ != structVal.Type() || s.plan.gen != atomic.LoadUint64(&scanPlanGen) {
+		s.plan = getScanPlan(u, structVal.Type(), s.columnNames, s.positional || u.positionalScan)
+		s.pointers = nil
+	}
+
+	plan := s.plan
+	if u.strictScan && (len(plan.unmappedColumns) > 0 || len(plan.unmappedFields) > 0) {
+		return &ScanMappingError{
+			Type:    plan.typ,
+			Columns: plan.unmappedColumns,
+			Fields:  plan.unmappedFields,
 		}
 	}
 
-	nrCols := len(s.columnNames)
-	pointers := make([]interface{}, nrCols)
-	altpointers := make([]interface{}, nrCols)
-	putback := make([]int, 0)
-	fieldTypes := make([]reflect.Type, nrCols)
+	if len(s.pointers) != len(plan.columns) {
+		s.allocBuffers()
+	}
 
-	structVal := reflect.ValueOf(dest).Elem()
-	nFields := structVal.NumField()
+	pointers := s.pointers
 
-	rnum := 0
+	// only the field pointers change from row to row
+	for i, c := range plan.columns {
+		if c.kind == scanField {
+			pointers[i] = structVal.Field(c.field).Addr().Interface()
+		}
+	}
+
+	err := rows.Scan(pointers...)
+	if err != nil {
+		return err
+	}
 
-	dt := time.Now()
-	dtnull := NullTime{}
-	dtType := reflect.TypeOf(dt)
-	dtnullType := reflect.TypeOf(dtnull)
+	utcReport := u.utcReporter()
 
-	for i, colName := range s.columnNames {
-		if isOracle && colName == "rnumignore" {
-			pointers[i] = &rnum
-			fieldTypes[i] = reflect.ValueOf(rnum).Type()
+	for i, c := range plan.columns {
+		if c.kind == scanConvert {
+			err := setConverted(structVal.Field(c.field), c.convert, *pointers[i].(*interface{}))
+			if err != nil {
+				return fmt.Errorf("column %s: %w", s.columnNames[i], err)
+			}
 			continue
 		}
 
-		for j := 0; j < nFields; j++ {
-			typeField := structVal.Type().Field(j)
-			tag := typeField.Tag
+		if !c.isTime {
+			continue
+		}
 
-			if tag.Get("sql") == colName {
-				pointers[i] = structVal.Field(j).Addr().Interface()
-				fieldTypes[i] = typeField.Type
+		field := structVal.Field(c.field).Addr().Interface()
 
-				if isSqlite && (fieldTypes[i] == dtType || fieldTypes[i] == dtnullType) {
-					altpointers[i] = pointers[i]
-					putback = append(putback, i)
-					pointers[i] = new(sql.NullString)
+		switch {
+		case c.kind == scanSqliteTime:
+			val, ok := pointers[i].(*sql.NullString)
+			if !ok || val == nil || !(*val).Valid {
+				if dtval, ok := field.(**time.Time); ok {
+					*dtval = nil
 				}
+				break
+			}
+
+			sdt := (*val).String
+
+			sdt = strings.Replace(sdt, "T", " ", 1)
+			sdt = strings.Replace(sdt, "Z", "", 1)
 
+			if len(sdt) == 0 {
 				break
 			}
+
+			dt, err := s.parseSDate(sdt, loc)
+			if err != nil {
+				return err
+			}
+
+			switch dtval := field.(type) {
+			case *NullTime:
+				(*dtval).SetValue(dt)
+			case **time.Time:
+				*dtval = &dt
+			default:
+				*field.(*time.Time) = dt
+			}
+		case isOracle:
+			// in oci, the timestamp is comming up as local time zone
+			// even if you ask for the UTC: its wall clock is kept, in loc
+			var dtval *time.Time
+
+			switch f := field.(type) {
+			case *NullTime:
+				if f.Valid {
+					dtval = &f.Time
+				}
+			case **time.Time:
+				dtval = *f
+			default:
+				dtval = field.(*time.Time)
+			}
+
+			if dtval != nil {
+				*dtval = wallClockIn(*dtval, loc)
+			}
+		}
+
+		if dtval, ok := field.(**time.Time); ok {
+			field = *dtval
+		}
+
+		if utcReport != nil {
+			checkScannedUTC(utcReport, s.columnNames[i], field)
 		}
 	}
 
-	err := rows.Scan(pointers...)
-	if err != nil {
-		return err
+	return nil
+}
+
+// allocBuffers - allocates the buffers the columns of the plan are scanned into
+func (s *SQLScan) allocBuffers() {
+	nrCols := len(s.plan.columns)
+
+	s.pointers = make([]interface{}, nrCols)
+	s.texts = make([]sql.NullString, nrCols)
+	s.values = make([]interface{}, nrCols)
+
+	for i, c := range s.plan.columns {
+		switch c.kind {
+		case scanNone:
+			s.pointers[i] = &s.discard
+		case scanRowNumber:
+			s.pointers[i] = &s.rnum
+		case scanSqliteTime:
+			s.pointers[i] = &s.texts[i]
+		case scanConvert:
+			s.pointers[i] = &s.values[i]
+		}
 	}
+}
 
-	if isSqlite {
-		np := len(putback)
-		for k := 0; k < np; k++ {
-			i := putback[k]
+// scanKind - how a column is scanned
+type scanKind int
+
+const (
+	// scanNone - the column has no matching field
+	scanNone scanKind = iota
+	// scanField - the column is scanned straight into its field
+	scanField
+	// scanRowNumber - the row number added by the Oracle 11g pagination
+	scanRowNumber
+	// scanSqliteTime - the SQLite date is scanned as text and parsed into its field
+	scanSqliteTime
+	// scanConvert - the driver value is converted by the converter registered for the field type
+	scanConvert
+)
 
-			if val, ok := pointers[i].(*sql.NullString); ok && val != nil && (*val).Valid {
-				sdt := (*val).String
+// scanColumn - scan plan of a column
+type scanColumn struct {
+	kind  scanKind
+	field int
+	// isTime - the field is a time.Time, a *time.Time or a NullTime
+	isTime  bool
+	convert ConverterFunc
+	// conversion - name of the conversion done by convert (see ScanReport)
+	conversion string
+}
 
-				sdt = strings.Replace(sdt, "T", " ", 1)
-				sdt = strings.Replace(sdt, "Z", "", 1)
-				l := len(sdt)
+var (
+	dtType     = reflect.TypeOf(time.Time{})
+	dtnullType = reflect.TypeOf(NullTime{})
+	dtptrType  = reflect.TypeOf(&time.Time{})
+)
 
-				if l == 0 {
-					continue
-				}
+// scanPlan - the column to field mapping of a struct type and a column set
+type scanPlan struct {
+	typ     reflect.Type
+	columns []scanColumn
+	// unmappedColumns - columns with no matching field
+	unmappedColumns []string
+	// unmappedFields - sql tagged fields with no matching column (as Name (tag))
+	unmappedFields []string
+	// gen - scanPlanGen when the plan was computed
+	gen uint64
+}
 
-				val, err := s.parseSDate(sdt)
-				if err != nil {
-					return err
-				}
+// ScanMappingError - returned by SQLScan in strict mode (see DbUtils.SetStrictScan)
+type ScanMappingError struct {
+	Type reflect.Type
+	// Columns - result set columns with no matching struct field
+	Columns []string
+	// Fields - sql tagged struct fields with no matching column
+	Fields []string
+}
 
-				if fieldTypes[i] == dtnullType {
-					dtval := altpointers[i].(*NullTime)
-					(*dtval).SetValue(val)
-				} else {
-					dtval := altpointers[i].(*time.Time)
-					*dtval = val
-				}
+// Error - describes the unmapped columns and fields
+func (e *ScanMappingError) Error() string {
+	var parts []string
+
+	if len(e.Columns) > 0 {
+		parts = append(parts, "columns without a field: "+strings.Join(e.Columns, ", "))
+	}
+
+	if len(e.Fields) > 0 {
+		parts = append(parts, "fields without a column: "+strings.Join(e.Fields, ", "))
+	}
+
+	return fmt.Sprintf("scan into %s: %s", e.Type, strings.Join(parts, "; "))
+}
+
+type scanPlanKey struct {
+	typ        reflect.Type
+	dbType     string
+	columnCase ColumnCase
+	positional bool
+	columns    string
+}
+
+// typePlanKey - the settings a typePlan depends on
+type typePlanKey struct {
+	typ        reflect.Type
+	dbType     string
+	columnCase ColumnCase
+}
+
+// typePlan - the part of the scan plans that depends only on the struct type:
+// the tag lookup and how each field is scanned
+type typePlan struct {
+	lookup *columnLookup
+	// fields - the scan of each field, by field index
+	fields []scanColumn
+}
+
+var (
+	scanPlanMux sync.RWMutex
+	scanPlans   = make(map[scanPlanKey]*scanPlan)
+	typePlans   = make(map[typePlanKey]*typePlan)
+	// scanPlanStats - lookups of scanPlans
+	scanPlanStats cacheStats
+	// scanPlanGen - incremented (under scanPlanMux) when the cached plans are dropped,
+	// so the plans kept by the SQLScan helpers are computed again
+	scanPlanGen uint64
+)
+
+// resetScanPlans - drops the cached scan plans, including those kept by the SQLScan helpers
+func resetScanPlans() {
+	scanPlanMux.Lock()
+	defer scanPlanMux.Unlock()
+
+	scanPlans = make(map[scanPlanKey]*scanPlan)
+	typePlans = make(map[typePlanKey]*typePlan)
+	atomic.AddUint64(&scanPlanGen, 1)
+}
+
+// getTypePlan - returns the cached type plan of typ, computing it if needed
+func getTypePlan(u *DbUtils, typ reflect.Type) *typePlan {
+	key := typePlanKey{typ: typ, dbType: u.dbType, columnCase: u.columnCase}
+
+	scanPlanMux.RLock()
+	tp, ok := typePlans[key]
+	scanPlanMux.RUnlock()
+
+	if ok {
+		return tp
+	}
+
+	gen := atomic.LoadUint64(&scanPlanGen)
+	isOracle := u.dbType == Oci8 || u.dbType == Oracle || u.dbType == Oracle11g
+
+	tp = &typePlan{
+		lookup: newColumnLookup(typ, u.columnCase, isOracle),
+		fields: make([]scanColumn, typ.NumField()),
+	}
+
+	for j := range tp.fields {
+		planColumn(u, &tp.fields[j], typ.Field(j), j)
+	}
+
+	// not cached if the plans were dropped meanwhile
+	scanPlanMux.Lock()
+	if gen == scanPlanGen {
+		typePlans[key] = tp
+	}
+	scanPlanMux.Unlock()
+
+	return tp
+}
+
+// getScanPlan - returns the cached scan plan of typ and columns, computing it if needed
+func getScanPlan(u *DbUtils, typ reflect.Type, columns []string, positional bool) *scanPlan {
+	key := scanPlanKey{
+		typ:        typ,
+		dbType:     u.dbType,
+		columnCase: u.columnCase,
+		positional: positional,
+		columns:    strings.Join(columns, "\x00"),
+	}
+
+	scanPlanMux.RLock()
+	plan, ok := scanPlans[key]
+	scanPlanMux.RUnlock()
+
+	scanPlanStats.lookup(ok)
+
+	if ok {
+		return plan
+	}
+
+	gen := atomic.LoadUint64(&scanPlanGen)
+	plan = newScanPlan(u, typ, columns, positional)
+	plan.gen = gen
+
+	// not cached if the plans were dropped meanwhile
+	scanPlanMux.Lock()
+	if gen == scanPlanGen {
+		scanPlans[key] = plan
+	}
+	scanPlanMux.Unlock()
+
+	return plan
+}
+
+func newScanPlan(u *DbUtils, typ reflect.Type, columns []string, positional bool) *scanPlan {
+	isOracle := u.dbType == Oci8 || u.dbType == Oracle || u.dbType == Oracle11g
+
+	plan := &scanPlan{
+		typ:     typ,
+		columns: make([]scanColumn, len(columns)),
+	}
+
+	nFields := typ.NumField()
+	mapped := make([]bool, nFields)
+
+	tp := getTypePlan(u, typ)
+
+	// in positional mode the columns fill the exported fields in declaration order
+	var fields []int
+	if positional {
+		for j := 0; j < nFields; j++ {
+			typeField := typ.Field(j)
+			if typeField.PkgPath == "" && typeField.Tag.Get("sql") != "-" {
+				fields = append(fields, j)
 			}
 		}
-	} else if isOracle {
-		// in oci, the timestamp is comming up as local time zone
-		// even if you ask for the UTC
-
-		for i := 0; i < nrCols; i++ {
-			if fieldTypes[i] == dtType {
-				dtval := pointers[i].(*time.Time)
-				strdt := Date2string(*dtval, ISODateTimestamp)
-				*dtval = String2dateNoErr(strdt, UTCDateTimestamp)
-			} else if fieldTypes[i] == dtnullType {
-				dtval := pointers[i].(*NullTime)
-				if dtval.Valid {
-					strdt := Date2string((*dtval).Time, ISODateTimestamp)
-					(*dtval).Time = String2dateNoErr(strdt, UTCDateTimestamp)
-				}
+	}
+
+	for i, colName := range columns {
+		c := &plan.columns[i]
+
+		if isOracle && strings.EqualFold(colName, "rnumignore") {
+			c.kind = scanRowNumber
+			continue
+		}
+
+		if positional {
+			if len(fields) > 0 {
+				*c = tp.fields[fields[0]]
+				mapped[fields[0]] = true
+				fields = fields[1:]
 			}
+		} else if j, ok := tp.lookup.field(colName); ok {
+			*c = tp.fields[j]
+			mapped[j] = true
+		}
+
+		if c.kind == scanNone {
+			plan.unmappedColumns = append(plan.unmappedColumns, colName)
 		}
 	}
 
-	return nil
+	if positional {
+		for _, j := range fields {
+			plan.unmappedFields = append(plan.unmappedFields, typ.Field(j).Name)
+		}
+
+		return plan
+	}
+
+	for j := 0; j < nFields; j++ {
+		tag, _ := parseSQLTag(typ.Field(j).Tag.Get("sql"))
+		if !mapped[j] && tag != "" && tag != "-" {
+			plan.unmappedFields = append(plan.unmappedFields, fmt.Sprintf("%s (%s)", typ.Field(j).Name, tag))
+		}
+	}
+
+	return plan
+}
+
+// planColumn - sets how the column c is scanned into the field j
+func planColumn(u *DbUtils, c *scanColumn, typeField reflect.StructField, j int) {
+	_, tagOpts := parseSQLTag(typeField.Tag.Get("sql"))
+
+	c.kind = scanField
+	c.field = j
+	c.isTime = typeField.Type == dtType || typeField.Type == dtnullType || typeField.Type == dtptrType
+
+	if u.dbType == Sqlite3 && c.isTime {
+		c.kind = scanSqliteTime
+	}
+
+	var jsonConv ConverterFunc
+	if hasTagOption(tagOpts, "json") {
+		jsonConv = jsonConverter(typeField.Type)
+	}
+
+	// the later conversions take precedence, the registered converters last
+	conversions := []struct {
+		name    string
+		convert ConverterFunc
+	}{
+		{"uuid", uuidConverter(u.dbType, typeField.Type, tagOpts)},
+		{"bool", boolConverter(typeField.Type)},
+		{"duration", durationConverter(typeField.Type)},
+		{"enum", enumConverter(typeField.Type, tagOpts)},
+		{"json", jsonConv},
+		{"registered converter", getConverter(typeField.Type)},
+	}
+
+	for _, conv := range conversions {
+		if conv.convert != nil {
+			c.kind = scanConvert
+			c.isTime = false
+			c.convert = conv.convert
+			c.conversion = conv.name
+		}
+	}
+}
+
+// parseSQLTag - splits the sql tag "name,option,..." into the column name and its options
+func parseSQLTag(tag string) (string, []string) {
+	parts := strings.Split(tag, ",")
+	return parts[0], parts[1:]
+}
+
+func hasTagOption(opts []string, opt string) bool {
+	for _, o := range opts {
+		if strings.TrimSpace(o) == opt {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizeColumnName(colName string, c ColumnCase, isOracle bool) string {
+	switch c {
+	case ColumnCaseLower, ColumnCaseInsensitive:
+		return strings.ToLower(colName)
+	case ColumnCaseUpper:
+		return strings.ToUpper(colName)
+	case ColumnCasePreserve:
+		return colName
+	default:
+		// the unquoted Oracle identifiers come uppercased
+		if isOracle {
+			return strings.ToLower(colName)
+		}
+		return colName
+	}
+}
+
+// columnLookup - sql tag -> field index of a struct type. A column is looked up by its name
+// as returned by the driver first (quoted mixed case Oracle columns), then by its name
+// normalized as configured by DbUtils.SetColumnCase
+type columnLookup struct {
+	exact      map[string]int
+	normalized map[string]int
+	c          ColumnCase
+	isOracle   bool
+}
+
+func newColumnLookup(typ reflect.Type, c ColumnCase, isOracle bool) *columnLookup {
+	l := &columnLookup{
+		exact:      make(map[string]int),
+		normalized: make(map[string]int),
+		c:          c,
+		isOracle:   isOracle,
+	}
+
+	for j := 0; j < typ.NumField(); j++ {
+		tag, _ := parseSQLTag(typ.Field(j).Tag.Get("sql"))
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		// the first field with a tag wins
+		if _, ok := l.exact[tag]; !ok {
+			l.exact[tag] = j
+		}
+
+		key := normalizeTagName(tag, c)
+		if _, ok := l.normalized[key]; !ok {
+			l.normalized[key] = j
+		}
+	}
+
+	return l
+}
+
+// field - returns the index of the field matching colName
+func (l *columnLookup) field(colName string) (int, bool) {
+	if l.c != ColumnCaseInsensitive && l.c != ColumnCaseLower && l.c != ColumnCaseUpper {
+		if j, ok := l.exact[colName]; ok {
+			return j, true
+		}
+	}
+
+	j, ok := l.normalized[normalizeColumnName(colName, l.c, l.isOracle)]
+	return j, ok
+}
+
+func normalizeTagName(tag string, c ColumnCase) string {
+	switch c {
+	case ColumnCaseLower, ColumnCaseInsensitive:
+		return strings.ToLower(tag)
+	case ColumnCaseUpper:
+		return strings.ToUpper(tag)
+	default:
+		return tag
+	}
 }
 
 func padRight(str string, item string, count int) string {
 	return str + strings.Repeat(item, count-len(str))
 }
 
-func (s *SQLScan) parseSDate(sdt string) (time.Time, error) {
+// wallClockIn - returns the time with the wall clock of t in loc
+func wallClockIn(t time.Time, loc *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+}
+
+func (s *SQLScan) parseSDate(sdt string, loc *time.Location) (time.Time, error) {
 	var dt time.Time
 	var err error
 	var err1 error
@@ -197,11 +668,6 @@ func (s *SQLScan) parseSDate(sdt string) (time.Time, error) {
 			}
 		}
 	}
-	
-	loc, err := time.LoadLocation("UTC")
-	if err != nil {
-		return time.Now(), err
-	}
 
 	for _, format := range s.dateformats {
 		dt, err1 = time.ParseInLocation(format, sdate, loc)
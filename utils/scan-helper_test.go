@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"time"
+)
+
+// benchRows - number of rows returned by the scanbench driver
+const benchRows = 1000000
+
+// scanbench driver: every query returns benchRows rows of (id, name, created, extra),
+// created in the text form SQLite returns
+type benchDriver struct{}
+type benchConn struct{}
+type benchStmt struct{}
+type benchResultRows struct{ i int }
+
+func (benchDriver) Open(string) (driver.Conn, error) { return benchConn{}, nil }
+
+func (benchConn) Prepare(string) (driver.Stmt, error) { return benchStmt{}, nil }
+func (benchConn) Close() error                        { return nil }
+func (benchConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (benchStmt) Close() error  { return nil }
+func (benchStmt) NumInput() int { return -1 }
+func (benchStmt) Exec([]driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+func (benchStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &benchResultRows{}, nil
+}
+
+func (r *benchResultRows) Columns() []string {
+	return []string{"id", "name", "created", "extra"}
+}
+func (r *benchResultRows) Close() error { return nil }
+func (r *benchResultRows) Next(dest []driver.Value) error {
+	if r.i >= benchRows {
+		return io.EOF
+	}
+
+	dest[0] = int64(r.i)
+	dest[1] = "name"
+	dest[2] = "2024-01-02 03:04:05"
+	dest[3] = int64(0)
+	r.i++
+
+	return nil
+}
+
+func init() {
+	sql.Register("scanbench", benchDriver{})
+}
+
+type benchRow struct {
+	ID      int64     `sql:"id"`
+	Name    string    `sql:"name"`
+	Created time.Time `sql:"created"`
+}
+
+func benchDb(b *testing.B) *DbUtils {
+	db, err := sql.Open("scanbench", "")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	u := &DbUtils{}
+	u.setDbType(Sqlite3)
+	u.db = db
+
+	return u
+}
+
+// benchScan - scans benchRows rows b.N times, newScan returns the helper used for a row
+func benchScan(b *testing.B, newScan func(sc *SQLScan) *SQLScan) {
+	u := benchDb(b)
+	defer u.db.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+
+	for n := 0; n < b.N; n++ {
+		rows, err := u.db.Query("SELECT id, name, created, extra FROM t")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		sc := new(SQLScan)
+		var row benchRow
+		for rows.Next() {
+			if err := newScan(sc).Scan(u, rows, &row); err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		if err := rows.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*benchRows), "ns/row")
+}
+
+// BenchmarkSQLScan - one SQLScan for the whole result set: the plan and the
+// scan buffers are reused, only the field pointers change from row to row
+func BenchmarkSQLScan(b *testing.B) {
+	benchScan(b, func(sc *SQLScan) *SQLScan {
+		return sc
+	})
+}
+
+// BenchmarkSQLScanPerRow - a new SQLScan for each row allocates the scan buffers
+// every row, as SQLScan did before reusing them (it also reads the columns again)
+func BenchmarkSQLScanPerRow(b *testing.B) {
+	benchScan(b, func(*SQLScan) *SQLScan {
+		return new(SQLScan)
+	})
+}
+
+// BenchmarkRowsScan - plain rows.Scan of the same rows, for reference
+func BenchmarkRowsScan(b *testing.B) {
+	u := benchDb(b)
+	defer u.db.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+
+	for n := 0; n < b.N; n++ {
+		rows, err := u.db.Query("SELECT id, name, created, extra FROM t")
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		var row benchRow
+		var created string
+		var extra int64
+		for rows.Next() {
+			if err := rows.Scan(&row.ID, &row.Name, &created, &extra); err != nil {
+				b.Fatal(err)
+			}
+
+			row.Created, err = time.Parse("2006-01-02 15:04:05", created)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+
+		if err := rows.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(b.N*benchRows), "ns/row")
+}
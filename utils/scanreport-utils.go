@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"text/tabwriter"
+)
+
+// ScanReport - the column to field mapping SQLScan will use for a result set and a struct type
+type ScanReport struct {
+	Type    reflect.Type       `json:"-"`
+	Columns []ScanColumnReport `json:"columns"`
+	// UnmappedColumns - columns with no matching field (discarded, or a ScanMappingError in strict mode)
+	UnmappedColumns []string `json:"unmapped_columns"`
+	// UnmappedFields - sql tagged fields with no matching column (left unchanged)
+	UnmappedFields []string `json:"unmapped_fields"`
+}
+
+// ScanColumnReport - how a column is scanned
+type ScanColumnReport struct {
+	Column       string `json:"column"`
+	DatabaseType string `json:"database_type"`
+	Field        string `json:"field,omitempty"`
+	FieldType    string `json:"field_type,omitempty"`
+	// Conversion - what happens to the driver value: direct, discarded, row number,
+	// sqlite date parse, oracle wall clock, uuid, bool, duration, enum, json or registered converter
+	Conversion string `json:"conversion"`
+}
+
+// DescribeScan - reports how the rows would be scanned into dest (a struct, a pointer to a struct
+// or its reflect.Type): which column feeds which field, what is unmatched and the conversions done.
+// The rows are not read
+func (u *DbUtils) DescribeScan(rows *sql.Rows, dest interface{}) (*ScanReport, error) {
+	typ, ok := dest.(reflect.Type)
+	if !ok {
+		typ = reflect.TypeOf(dest)
+	}
+
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("dest must be a struct, not %T", dest)
+	}
+
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	isOracle := u.dbType == Oci8 || u.dbType == Oracle || u.dbType == Oracle11g
+
+	columns := make([]string, len(colTypes))
+	for i, ct := range colTypes {
+		columns[i] = ct.Name()
+	}
+
+	plan := getScanPlan(u, typ, columns, u.positionalScan)
+
+	report := &ScanReport{
+		Type:            typ,
+		Columns:         make([]ScanColumnReport, len(columns)),
+		UnmappedColumns: plan.unmappedColumns,
+		UnmappedFields:  plan.unmappedFields,
+	}
+
+	for i, c := range plan.columns {
+		cr := &report.Columns[i]
+		cr.Column = columns[i]
+		cr.DatabaseType = colTypes[i].DatabaseTypeName()
+
+		if c.kind == scanField || c.kind == scanSqliteTime || c.kind == scanConvert {
+			cr.Field = typ.Field(c.field).Name
+			cr.FieldType = typ.Field(c.field).Type.String()
+		}
+
+		switch c.kind {
+		case scanNone:
+			cr.Conversion = "discarded"
+		case scanRowNumber:
+			cr.Conversion = "row number"
+		case scanSqliteTime:
+			cr.Conversion = "sqlite date parse"
+		case scanConvert:
+			cr.Conversion = c.conversion
+		case scanField:
+			cr.Conversion = "direct"
+			if c.isTime && isOracle {
+				cr.Conversion = "oracle wall clock"
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// String - formats the report as a table, followed by the unmapped columns and fields
+func (r *ScanReport) String() string {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "scan into %s\n", r.Type)
+
+	w := tabwriter.NewWriter(&buf, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "COLUMN\tDB TYPE\tFIELD\tFIELD TYPE\tCONVERSION")
+	for _, c := range r.Columns {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", c.Column, c.DatabaseType, c.Field, c.FieldType, c.Conversion)
+	}
+	w.Flush()
+
+	for _, col := range r.UnmappedColumns {
+		fmt.Fprintf(&buf, "column without a field: %s\n", col)
+	}
+
+	for _, f := range r.UnmappedFields {
+		fmt.Fprintf(&buf, "field without a column: %s\n", f)
+	}
+
+	return buf.String()
+}
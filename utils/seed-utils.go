@@ -0,0 +1,283 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var identRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$#]*(\.[A-Za-z_][A-Za-z0-9_$#]*)?$`)
+
+// SeedRow - a reference row to be seeded, column name -> value
+type SeedRow map[string]interface{}
+
+// SeedTable - reference rows required in a table.
+// KeyColumns identify a row. A row is inserted only if no row with the same key exists.
+// With Update, the other columns of an existing row are set to the seeded values (see UpsertTx)
+type SeedTable struct {
+	Table      string    `json:"table"`
+	KeyColumns []string  `json:"key_columns"`
+	Rows       []SeedRow `json:"rows"`
+	Update     bool      `json:"update,omitempty"`
+}
+
+// Seeder - declares the reference rows an application needs (roles, config entries)
+// and ensures they exist at startup
+type Seeder struct {
+	dbutl  *DbUtils
+	audit  *AuditLog
+	tables []SeedTable
+}
+
+// NewSeeder - instantiates a Seeder. audit may be nil
+func NewSeeder(dbutl *DbUtils, audit *AuditLog) *Seeder {
+	return &Seeder{
+		dbutl: dbutl,
+		audit: audit,
+	}
+}
+
+// Add - declares rows required in table
+func (s *Seeder) Add(table string, keyColumns []string, rows ...SeedRow) {
+	s.tables = append(s.tables, SeedTable{
+		Table:      table,
+		KeyColumns: keyColumns,
+		Rows:       rows,
+	})
+}
+
+// Upsert - declares rows required in table, whose other columns are kept to the given
+// values: an existing row is updated on each Run
+func (s *Seeder) Upsert(table string, keyColumns []string, rows ...SeedRow) {
+	s.tables = append(s.tables, SeedTable{
+		Table:      table,
+		KeyColumns: keyColumns,
+		Rows:       rows,
+		Update:     true,
+	})
+}
+
+// AddJSON - declares rows read from a JSON document.
+// The document is an array of {"table": "", "key_columns": [], "rows": [{}], "update": false} objects
+func (s *Seeder) AddJSON(r io.Reader) error {
+	var tables []SeedTable
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	err := dec.Decode(&tables)
+	if err != nil {
+		return err
+	}
+
+	s.tables = append(s.tables, tables...)
+
+	return nil
+}
+
+// AddFromFS - declares rows from the JSON files matching pattern in fsys (ex: an embed.FS)
+func (s *Seeder) AddFromFS(fsys fs.FS, pattern string) error {
+	names, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+
+		err = s.AddJSON(f)
+		f.Close()
+
+		if err != nil {
+			return fmt.Errorf("seed file %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// Run - inserts the missing rows (and updates the existing ones of the Upsert tables),
+// in declaration order, in a single transaction. The created rows are logged once the
+// transaction is committed.
+// Returns the number of created rows
+func (s *Seeder) Run() (int, error) {
+	var created [][]interface{}
+
+	tx, err := s.dbutl.BeginTransaction()
+	if err != nil {
+		return 0, err
+	}
+	defer s.dbutl.Rollback(tx)
+
+	for _, t := range s.tables {
+		for _, row := range t.Rows {
+			var inserted bool
+			if t.Update {
+				inserted, err = s.dbutl.UpsertTx(tx, t.Table, t.KeyColumns, row)
+			} else {
+				inserted, err = s.dbutl.InsertIfMissingTx(tx, t.Table, t.KeyColumns, row)
+			}
+			if err != nil {
+				return 0, fmt.Errorf("seed %s: %v", t.Table, err)
+			}
+
+			if !inserted {
+				continue
+			}
+
+			details := []interface{}{"table", t.Table}
+			for _, col := range t.KeyColumns {
+				details = append(details, col, row[col])
+			}
+			created = append(created, details)
+		}
+	}
+
+	if err := s.dbutl.Commit(tx); err != nil {
+		return 0, fmt.Errorf("seed: %v", err)
+	}
+
+	if s.audit != nil {
+		for _, details := range created {
+			s.audit.Log(nil, "seed", "reference row created", details...)
+		}
+	}
+
+	return len(created), nil
+}
+
+// InsertIfMissingTx - inserts row in table unless a row with the same keyColumns values exists.
+// The table IDGenerator, if set, is used as in InsertTx. Returns true if the row was inserted
+func (u *DbUtils) InsertIfMissingTx(tx *sql.Tx, table string, keyColumns []string, row map[string]interface{}) (bool, error) {
+	where, keyArgs, err := keyPredicate(table, keyColumns, row)
+	if err != nil {
+		return false, err
+	}
+
+	found, err := u.rowExistsTx(tx, table, where, keyArgs)
+	if err != nil || found {
+		return false, err
+	}
+
+	if _, err := u.InsertTx(tx, table, row); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UpsertTx - inserts row in table or, if a row with the same keyColumns values exists,
+// updates its other columns to the values of row. The table IDGenerator, if set, is used
+// as in InsertTx. Returns true if the row was inserted
+func (u *DbUtils) UpsertTx(tx *sql.Tx, table string, keyColumns []string, row map[string]interface{}) (bool, error) {
+	where, keyArgs, err := keyPredicate(table, keyColumns, row)
+	if err != nil {
+		return false, err
+	}
+
+	found, err := u.rowExistsTx(tx, table, where, keyArgs)
+	if err != nil {
+		return false, err
+	}
+
+	if !found {
+		if _, err := u.InsertTx(tx, table, row); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	isKey := make(map[string]bool, len(keyColumns))
+	for _, col := range keyColumns {
+		isKey[col] = true
+	}
+
+	cols := make([]string, 0, len(row))
+	for col := range row {
+		if isKey[col] {
+			continue
+		}
+		if !identRegexp.MatchString(col) {
+			return false, fmt.Errorf("invalid column name: %s", col)
+		}
+		cols = append(cols, col)
+	}
+
+	if len(cols) == 0 {
+		return false, nil
+	}
+	sort.Strings(cols)
+
+	assignments := make([]string, len(cols))
+	args := make([]interface{}, 0, len(cols)+len(keyArgs))
+	for i, col := range cols {
+		assignments[i] = col + " = ?"
+		args = append(args, row[col])
+	}
+	args = append(args, keyArgs...)
+
+	pq := u.PQuery(fmt.Sprintf(
+		"UPDATE %s SET %s WHERE %s",
+		table,
+		strings.Join(assignments, ", "),
+		where,
+	), args...)
+
+	if _, err := u.ExecTx(tx, pq); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// keyPredicate - the "col1 = ? AND col2 = ?" condition on the keyColumns of row, with its args
+func keyPredicate(table string, keyColumns []string, row map[string]interface{}) (string, []interface{}, error) {
+	if len(keyColumns) == 0 {
+		return "", nil, errors.New("at least one key column is required")
+	}
+
+	if !identRegexp.MatchString(table) {
+		return "", nil, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	where := make([]string, len(keyColumns))
+	keyArgs := make([]interface{}, len(keyColumns))
+	for i, col := range keyColumns {
+		if !identRegexp.MatchString(col) {
+			return "", nil, fmt.Errorf("invalid column name: %s", col)
+		}
+
+		val, ok := row[col]
+		if !ok {
+			return "", nil, fmt.Errorf("key column %s has no value", col)
+		}
+
+		where[i] = col + " = ?"
+		keyArgs[i] = val
+	}
+
+	return strings.Join(where, " AND "), keyArgs, nil
+}
+
+// rowExistsTx - checks if table has a row matching where
+func (u *DbUtils) rowExistsTx(tx *sql.Tx, table string, where string, args []interface{}) (bool, error) {
+	var found int
+	pq := u.PQuery(fmt.Sprintf("SELECT count(*) FROM %s WHERE %s", table, where), args...)
+
+	if err := tx.QueryRow(pq.Query, pq.Args...).Scan(&found); err != nil {
+		return false, err
+	}
+
+	return found > 0, nil
+}
@@ -0,0 +1,137 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// SequenceTable - table emulating sequences in MySQL and SQLite:
+//
+//	create table sequence_values (
+//	    sequence_name varchar(128) not null primary key,
+//	    last_value    bigint       not null
+//	);
+const SequenceTable string = "sequence_values"
+
+// NextSequenceValue - returns the next value of the sequence seq.
+// In MySQL and SQLite the sequence is emulated with the SequenceTable table,
+// a missing sequence being created on first use (starting at 1)
+func (u *DbUtils) NextSequenceValue(seq string) (int64, error) {
+	if u.dbType == Sqlite3 {
+		// the emulation needs a transaction
+		tx, err := u.BeginTransaction()
+		if err != nil {
+			return 0, err
+		}
+		defer u.Rollback(tx)
+
+		id, err := u.NextSequenceValueTx(tx, seq)
+		if err != nil {
+			return 0, err
+		}
+
+		// a failed commit rolls the increment back: the value could be handed out again
+		if err := u.Commit(tx); err != nil {
+			return 0, err
+		}
+
+		return id, nil
+	}
+
+	return u.NextSequenceValueTx(nil, seq)
+}
+
+// NextSequenceValueTx - returns the next value of the sequence seq (in a transaction).
+// For SQLite tx must not be nil
+func (u *DbUtils) NextSequenceValueTx(tx *sql.Tx, seq string) (int64, error) {
+	if !identRegexp.MatchString(seq) {
+		return 0, fmt.Errorf("invalid sequence name: %s", seq)
+	}
+
+	var query string
+
+	switch u.dbType {
+	case Postgres:
+		query = fmt.Sprintf("SELECT nextval('%s')", seq)
+	case Oracle, Oracle11g, Oci8:
+		query = fmt.Sprintf("SELECT %s.NEXTVAL FROM dual", seq)
+	case SQLServer:
+		query = fmt.Sprintf("SELECT NEXT VALUE FOR %s", seq)
+	case MySQL:
+		return u.nextMySQLSequenceValue(tx, seq)
+	case Sqlite3:
+		return u.nextSqliteSequenceValue(tx, seq)
+	default:
+		return 0, fmt.Errorf("sequences are not supported in %s", u.dbType)
+	}
+
+	var id int64
+	pq := u.PQuery(query)
+
+	var err error
+	if tx != nil {
+		err = tx.QueryRow(pq.Query).Scan(&id)
+	} else {
+		err = u.db.QueryRow(pq.Query).Scan(&id)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// nextMySQLSequenceValue - LAST_INSERT_ID(expr) makes the new value the insert id of the statement
+func (u *DbUtils) nextMySQLSequenceValue(tx *sql.Tx, seq string) (int64, error) {
+	pq := u.PQuery(`
+		INSERT INTO `+SequenceTable+` (sequence_name, last_value) VALUES (?, LAST_INSERT_ID(1))
+		ON DUPLICATE KEY UPDATE last_value = LAST_INSERT_ID(last_value + 1)
+	`, seq)
+
+	res, err := u.ExecTx(tx, pq)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.LastInsertId()
+}
+
+func (u *DbUtils) nextSqliteSequenceValue(tx *sql.Tx, seq string) (int64, error) {
+	if tx == nil {
+		return 0, fmt.Errorf("a transaction is required for sequences in %s", u.dbType)
+	}
+
+	pq := u.PQuery("UPDATE "+SequenceTable+" SET last_value = last_value + 1 WHERE sequence_name = ?", seq)
+
+	res, err := u.ExecTx(tx, pq)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if n == 0 {
+		pq = u.PQuery("INSERT INTO "+SequenceTable+" (sequence_name, last_value) VALUES (?, 1)", seq)
+
+		_, err = u.ExecTx(tx, pq)
+		if err != nil {
+			return 0, err
+		}
+
+		return 1, nil
+	}
+
+	var id int64
+	pq = u.PQuery("SELECT last_value FROM "+SequenceTable+" WHERE sequence_name = ?", seq)
+
+	err = tx.QueryRow(pq.Query, pq.Args...).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
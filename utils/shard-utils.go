@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ErrNoShards - no shard was added to the router
+var ErrNoShards = errors.New("no shards configured")
+
+// ErrNoShardKey - the context has no shard key
+var ErrNoShardKey = errors.New("no shard key in context")
+
+// shardVirtualNodes - points per shard on the consistent hashing ring
+const shardVirtualNodes int = 128
+
+type shardKeyType struct{}
+
+type ringPoint struct {
+	hash  uint32
+	shard string
+}
+
+type shardMapping struct {
+	Key   string `sql:"shard_key"`
+	Shard string `sql:"shard_name"`
+}
+
+// WithShardKey - returns a context carrying the tenant / shard key
+func WithShardKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, shardKeyType{}, key)
+}
+
+// ShardKeyFromContext - returns the tenant / shard key set with WithShardKey
+func ShardKeyFromContext(ctx context.Context) (string, bool) {
+	key, ok := ctx.Value(shardKeyType{}).(string)
+	return key, ok
+}
+
+// ShardRouter - selects the DbUtils to use for a tenant / shard key.
+// Keys with an explicit mapping go to their mapped shard, the others are
+// distributed with consistent hashing
+type ShardRouter struct {
+	sync.RWMutex
+	shards  map[string]*DbUtils
+	mapping map[string]string
+	ring    []ringPoint
+}
+
+// NewShardRouter - instantiates a ShardRouter
+func NewShardRouter() *ShardRouter {
+	return &ShardRouter{
+		shards:  make(map[string]*DbUtils),
+		mapping: make(map[string]string),
+	}
+}
+
+// AddShard - adds a named shard
+func (r *ShardRouter) AddShard(name string, dbutl *DbUtils) {
+	r.Lock()
+	defer r.Unlock()
+
+	if _, ok := r.shards[name]; !ok {
+		for i := 0; i < shardVirtualNodes; i++ {
+			r.ring = append(r.ring, ringPoint{
+				hash:  hashShardKey(name + "#" + strconv.Itoa(i)),
+				shard: name,
+			})
+		}
+
+		sort.Slice(r.ring, func(i, j int) bool {
+			return r.ring[i].hash < r.ring[j].hash
+		})
+	}
+
+	r.shards[name] = dbutl
+}
+
+// MapKey - explicitly maps key to the named shard
+func (r *ShardRouter) MapKey(key string, shard string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.mapping[key] = shard
+}
+
+// LoadMapping - loads explicit mappings from a query returning
+// the shard_key and shard_name columns
+func (r *ShardRouter) LoadMapping(dbutl *DbUtils, pq *PreparedQuery) error {
+	mapping := make(map[string]string)
+
+	err := dbutl.ForEachRow(pq, func(row *sql.Rows, sc *SQLScan) error {
+		var m shardMapping
+
+		err := sc.Scan(dbutl, row, &m)
+		if err != nil {
+			return err
+		}
+
+		mapping[m.Key] = m.Shard
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	for key, shard := range mapping {
+		r.mapping[key] = shard
+	}
+
+	return nil
+}
+
+// ForKey - returns the DbUtils for a tenant / shard key
+func (r *ShardRouter) ForKey(key string) (*DbUtils, error) {
+	r.RLock()
+	defer r.RUnlock()
+
+	if len(r.shards) == 0 {
+		return nil, ErrNoShards
+	}
+
+	if shard, ok := r.mapping[key]; ok {
+		dbutl, ok := r.shards[shard]
+		if !ok {
+			return nil, fmt.Errorf("key %s is mapped to unknown shard %s", key, shard)
+		}
+		return dbutl, nil
+	}
+
+	h := hashShardKey(key)
+	i := sort.Search(len(r.ring), func(i int) bool {
+		return r.ring[i].hash >= h
+	})
+
+	if i == len(r.ring) {
+		i = 0
+	}
+
+	return r.shards[r.ring[i].shard], nil
+}
+
+// FromContext - returns the DbUtils for the shard key carried by ctx
+func (r *ShardRouter) FromContext(ctx context.Context) (*DbUtils, error) {
+	key, ok := ShardKeyFromContext(ctx)
+	if !ok {
+		return nil, ErrNoShardKey
+	}
+
+	return r.ForKey(key)
+}
+
+// Shards - returns the shards by name
+func (r *ShardRouter) Shards() map[string]*DbUtils {
+	r.RLock()
+	defer r.RUnlock()
+
+	shards := make(map[string]*DbUtils, len(r.shards))
+	for name, dbutl := range r.shards {
+		shards[name] = dbutl
+	}
+
+	return shards
+}
+
+func hashShardKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
@@ -0,0 +1,224 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DbStatus - database connection pool statistics
+type DbStatus struct {
+	DbType            string `json:"db_type"`
+	MaxOpen           int    `json:"max_open"`
+	Open              int    `json:"open"`
+	InUse             int    `json:"in_use"`
+	Idle              int    `json:"idle"`
+	WaitCount         int64  `json:"wait_count"`
+	WaitDurationMs    int64  `json:"wait_duration_ms"`
+	MaxIdleClosed     int64  `json:"max_idle_closed"`
+	MaxLifetimeClosed int64  `json:"max_lifetime_closed"`
+}
+
+// CacheStatus - hit rate of a cache
+type CacheStatus struct {
+	Name   string `json:"name"`
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	// HitRate - Hits / (Hits + Misses), 0 before the first lookup
+	HitRate float64 `json:"hit_rate"`
+}
+
+// cacheStats - lookup counters of a cache, updated atomically
+type cacheStats struct {
+	hits   uint64
+	misses uint64
+}
+
+func (c *cacheStats) lookup(hit bool) {
+	if hit {
+		atomic.AddUint64(&c.hits, 1)
+	} else {
+		atomic.AddUint64(&c.misses, 1)
+	}
+}
+
+func (c *cacheStats) status(name string) CacheStatus {
+	s := CacheStatus{
+		Name:   name,
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+	}
+
+	if total := s.Hits + s.Misses; total > 0 {
+		s.HitRate = float64(s.Hits) / float64(total)
+	}
+
+	return s
+}
+
+// Scheduled - a job run periodically in the background (Heartbeat, RetentionRegistry,
+// UsageMeter or one of the application)
+type Scheduled interface {
+	// NextRun - the time of the next run, zero when the job is not started
+	NextRun() time.Time
+}
+
+// ScheduleStatus - next run time of a scheduled job, nil when it is not started
+type ScheduleStatus struct {
+	Name    string     `json:"name"`
+	NextRun *time.Time `json:"next_run"`
+}
+
+// schedule - the next run time of a background loop, implements Scheduled
+type schedule struct {
+	scheduleMux sync.RWMutex
+	next        time.Time
+}
+
+func (s *schedule) setNextRun(t time.Time) {
+	s.scheduleMux.Lock()
+	defer s.scheduleMux.Unlock()
+
+	s.next = t
+}
+
+// NextRun - the time of the next run, zero when not started
+func (s *schedule) NextRun() time.Time {
+	s.scheduleMux.RLock()
+	defer s.scheduleMux.RUnlock()
+
+	return s.next
+}
+
+// StatusSnapshot - point in time view of the package subsystems, ready to be serialized
+type StatusSnapshot struct {
+	Time      time.Time        `json:"time"`
+	Database  *DbStatus        `json:"database,omitempty"`
+	Caches    []CacheStatus    `json:"caches,omitempty"`
+	Audit     *AuditStatus     `json:"audit,omitempty"`
+	Health    []ProbeResult    `json:"health,omitempty"`
+	Schedules []ScheduleStatus `json:"schedules,omitempty"`
+}
+
+// Stats - returns the connection pool statistics
+func (u *DbUtils) Stats() DbStatus {
+	if u.db == nil {
+		return DbStatus{DbType: u.dbType}
+	}
+
+	s := u.db.Stats()
+
+	return DbStatus{
+		DbType:            u.dbType,
+		MaxOpen:           s.MaxOpenConnections,
+		Open:              s.OpenConnections,
+		InUse:             s.InUse,
+		Idle:              s.Idle,
+		WaitCount:         s.WaitCount,
+		WaitDurationMs:    int64(s.WaitDuration / time.Millisecond),
+		MaxIdleClosed:     s.MaxIdleClosed,
+		MaxLifetimeClosed: s.MaxLifetimeClosed,
+	}
+}
+
+// CacheStats - returns the hit rates of the statements prepared by Warmup (lookups by
+// Exec, RunQuery, ForEachRow, etc) and of the SQLScan plans (shared by the package)
+func (u *DbUtils) CacheStats() []CacheStatus {
+	return []CacheStatus{
+		u.stmtStats.status("statements"),
+		scanPlanStats.status("scan_plans"),
+	}
+}
+
+// StatusReporter - aggregates the status of the registered subsystems
+type StatusReporter struct {
+	sync.RWMutex
+	dbutl     *DbUtils
+	audit     *AuditLog
+	health    *HealthChecker
+	schedules []namedSchedule
+}
+
+type namedSchedule struct {
+	name string
+	s    Scheduled
+}
+
+// NewStatusReporter - instantiates a StatusReporter. dbutl and audit may be nil
+func NewStatusReporter(dbutl *DbUtils, audit *AuditLog) *StatusReporter {
+	return &StatusReporter{
+		dbutl: dbutl,
+		audit: audit,
+	}
+}
+
+// SetHealthChecker - includes the probe results in the snapshots
+func (r *StatusReporter) SetHealthChecker(h *HealthChecker) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.health = h
+}
+
+// AddSchedule - includes the next run time of the job s in the snapshots, as name
+// (ex: r.AddSchedule("retention", registry))
+func (r *StatusReporter) AddSchedule(name string, s Scheduled) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.schedules = append(r.schedules, namedSchedule{name, s})
+}
+
+// StatusSnapshot - collects the current status
+func (r *StatusReporter) StatusSnapshot() StatusSnapshot {
+	r.RLock()
+	defer r.RUnlock()
+
+	s := StatusSnapshot{
+		Time: time.Now().UTC(),
+	}
+
+	if r.dbutl != nil {
+		dbs := r.dbutl.Stats()
+		s.Database = &dbs
+		s.Caches = r.dbutl.CacheStats()
+	}
+
+	if r.audit != nil {
+		as := r.audit.Stats()
+		s.Audit = &as
+	}
+
+	if r.health != nil {
+		s.Health = r.health.Results()
+	}
+
+	for _, ns := range r.schedules {
+		ss := ScheduleStatus{Name: ns.name}
+		if next := ns.s.NextRun(); !next.IsZero() {
+			next = next.UTC()
+			ss.NextRun = &next
+		}
+		s.Schedules = append(s.Schedules, ss)
+	}
+
+	return s
+}
+
+// ServeHTTP - writes the status snapshot as JSON. The snapshot is encoded before anything
+// is written, so an encoding error is returned as a 500 and not after a partial 200 body
+func (r *StatusReporter) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s := r.StatusSnapshot()
+
+	b, err := json.Marshal(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(append(b, '\n'))
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+// Lap - a lap of a Stopwatch
+type Lap struct {
+	Name string `json:"name"`
+	// Duration - time since the previous lap (or the start)
+	Duration time.Duration `json:"duration"`
+	// Elapsed - time since the start
+	Elapsed time.Duration `json:"elapsed"`
+}
+
+// Stopwatch - measures elapsed time, reading it from the package clock (see SetClock)
+type Stopwatch struct {
+	mux     sync.Mutex
+	start   time.Time
+	lastLap time.Time
+	end     time.Time
+	stopped bool
+	laps    []Lap
+
+	audit *AuditLog
+	event string
+}
+
+// NewStopwatch - instantiates a started Stopwatch
+func NewStopwatch() *Stopwatch {
+	sw := new(Stopwatch)
+	sw.Start()
+	return sw
+}
+
+// Start - (re)starts the stopwatch, clearing its laps
+func (sw *Stopwatch) Start() {
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+
+	sw.start = Now()
+	sw.lastLap = sw.start
+	sw.stopped = false
+	sw.laps = nil
+}
+
+// StartTime - returns the time the stopwatch was started
+func (sw *Stopwatch) StartTime() time.Time {
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+
+	return sw.start
+}
+
+// Lap - records a lap and returns its duration (the time since the previous lap)
+func (sw *Stopwatch) Lap(name string) time.Duration {
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+
+	now := sw.now()
+	lap := Lap{
+		Name:     name,
+		Duration: now.Sub(sw.lastLap),
+		Elapsed:  now.Sub(sw.start),
+	}
+
+	sw.lastLap = now
+	sw.laps = append(sw.laps, lap)
+
+	return lap.Duration
+}
+
+// Laps - returns the recorded laps
+func (sw *Stopwatch) Laps() []Lap {
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+
+	return append([]Lap(nil), sw.laps...)
+}
+
+// Elapsed - returns the time since the start (until Stop, if stopped)
+func (sw *Stopwatch) Elapsed() time.Duration {
+	sw.mux.Lock()
+	defer sw.mux.Unlock()
+
+	return sw.now().Sub(sw.start)
+}
+
+// Stop - stops the stopwatch and returns the elapsed time.
+// For a stopwatch started by AuditLog.TraceStopwatch, the trace end is logged with the laps
+func (sw *Stopwatch) Stop() time.Duration {
+	sw.mux.Lock()
+	if !sw.stopped {
+		sw.end = Now()
+		sw.stopped = true
+	}
+	elapsed := sw.end.Sub(sw.start)
+	start, end, laps := sw.start, sw.end, sw.laps
+	audit, event := sw.audit, sw.event
+	sw.audit = nil
+	sw.mux.Unlock()
+
+	if audit != nil {
+		var details []interface{}
+		if len(laps) > 0 {
+			details = append(details, "laps", laps)
+		}
+		audit.un(event, start, end, details...)
+	}
+
+	return elapsed
+}
+
+func (sw *Stopwatch) now() time.Time {
+	if sw.stopped {
+		return sw.end
+	}
+	return Now()
+}
+
+// TraceStopwatch - logs the trace start of event (as Trace) and returns a started Stopwatch
+// whose Stop logs the trace end (as Un), with the laps:
+//
+//	sw := audit.TraceStopwatch("import")
+//	defer sw.Stop()
+func (a *AuditLog) TraceStopwatch(event string) *Stopwatch {
+	_, start := a.Trace(event)
+
+	return &Stopwatch{
+		start:   start,
+		lastLap: start,
+		audit:   a,
+		event:   event,
+	}
+}
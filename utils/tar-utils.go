@@ -0,0 +1,379 @@
+package utils
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// TarWriter - tar (and tar.gz) creator helper, with the API of ZipWriter
+type TarWriter struct {
+	sync.RWMutex
+	dest io.Writer
+	gz   *gzip.Writer
+	w    *tar.Writer
+}
+
+// NewTarWriter - instantiates a TarWriter
+func NewTarWriter(dest io.Writer) *TarWriter {
+	return &TarWriter{dest: dest, w: tar.NewWriter(dest)}
+}
+
+// NewTarGzWriter - instantiates a TarWriter writing a gzip compressed tar (.tar.gz, .tgz)
+func NewTarGzWriter(dest io.Writer) *TarWriter {
+	gz := gzip.NewWriter(dest)
+	return &TarWriter{dest: dest, gz: gz, w: tar.NewWriter(gz)}
+}
+
+// AddFile - add file
+func (t *TarWriter) AddFile(name string, sourcefile string) error {
+	return t.AddFileContext(context.Background(), name, sourcefile)
+}
+
+// AddFileContext - add file, keeping its modification time and permissions, stops if ctx is done
+func (t *TarWriter) AddFileContext(ctx context.Context, name string, sourcefile string) error {
+	f, err := os.Open(sourcefile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	h, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	h.Name = name
+
+	return t.AddFromReaderWithHeader(ctx, h, f)
+}
+
+// AddDir - adds all files from dir (recursively), entry names are prefixed with prefix
+func (t *TarWriter) AddDir(dir string, prefix string) error {
+	return t.AddDirContext(context.Background(), dir, prefix)
+}
+
+// AddDirContext - adds all files from dir (recursively), stops if ctx is done
+func (t *TarWriter) AddDirContext(ctx context.Context, dir string, prefix string) error {
+	return walkFiles(ctx, dir, prefix, func(name string, fpath string) error {
+		return t.AddFileContext(ctx, name, fpath)
+	})
+}
+
+// AddFromReader - add entry from io.reader. The tar header holds the size of the entry,
+// so source is first copied in a temporary file (see AddFromReaderWithHeader to avoid it)
+func (t *TarWriter) AddFromReader(name string, source io.Reader) error {
+	return t.AddFromReaderContext(context.Background(), name, source)
+}
+
+// AddFromReaderContext - add entry from io.reader, stops if ctx is done
+func (t *TarWriter) AddFromReaderContext(ctx context.Context, name string, source io.Reader) error {
+	tmp, err := ioutil.TempFile("", "tar-entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := copyContext(ctx, tmp, source)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	h := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: Now()}
+
+	return t.AddFromReaderWithHeader(ctx, h, tmp)
+}
+
+// AddFromReaderWithHeader - add entry from io.reader, h.Size bytes are read from source
+func (t *TarWriter) AddFromReaderWithHeader(ctx context.Context, h *tar.Header, source io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if err := t.w.WriteHeader(h); err != nil {
+		return err
+	}
+
+	_, err := copyContext(ctx, t.w, io.LimitReader(source, h.Size))
+
+	return err
+}
+
+// AddEntry - add file
+func (t *TarWriter) AddEntry(name string, content []byte) error {
+	h := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: Now()}
+
+	return t.AddEntryWithHeader(h, content)
+}
+
+// AddEntryWithHeader - add file, with the modification time, mode, owner of h
+func (t *TarWriter) AddEntryWithHeader(h *tar.Header, content []byte) error {
+	h.Size = int64(len(content))
+
+	return t.AddFromReaderWithHeader(context.Background(), h, bytes.NewReader(content))
+}
+
+// Close - closes the archive (and the gzip stream) and makes it ready to use
+// must call Close prior trying to using the newly created archive
+func (t *TarWriter) Close() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if err := t.w.Close(); err != nil {
+		return err
+	}
+
+	if t.gz != nil {
+		return t.gz.Close()
+	}
+
+	return nil
+}
+
+// errStopIteration - stops an iteration of the entries early
+var errStopIteration = errors.New("stop iteration")
+
+// TarReader - tar (and tar.gz, detected) reader helper, with the API of ZipReader.
+// A tar has no index, so each call reads the archive from its start
+type TarReader struct {
+	sync.RWMutex
+	src     io.ReaderAt
+	size    int64
+	closer  io.Closer
+	entries []string
+}
+
+// NewTarReader - instantiates a new TarReader
+func NewTarReader(content []byte) (*TarReader, error) {
+	return NewTarReaderAt(bytes.NewReader(content), int64(len(content)))
+}
+
+// NewTarReaderAt - instantiates a new TarReader reading the archive of size bytes from r
+func NewTarReaderAt(r io.ReaderAt, size int64) (*TarReader, error) {
+	t := &TarReader{src: r, size: size}
+
+	err := t.ForEachEntry(func(name string, info EntryInfo, r io.Reader) error {
+		t.entries = append(t.entries, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// NewTarReaderFromFile - instantiates a new TarReader reading the archive file from disk.
+// Close closes the file
+func NewTarReaderFromFile(fpath string) (*TarReader, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	t, err := NewTarReaderAt(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	t.closer = f
+
+	return t, nil
+}
+
+// open - returns a reader of the archive from its start, uncompressing it if gzip compressed
+// (the closer of the gzip stream is nil for a plain tar)
+func (t *TarReader) open() (*tar.Reader, io.Closer, error) {
+	var magic [2]byte
+	n, _ := t.src.ReadAt(magic[:], 0)
+
+	src := io.NewSectionReader(t.src, 0, t.size)
+
+	if n == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tar.NewReader(gz), gz, nil
+	}
+
+	return tar.NewReader(src), nil, nil
+}
+
+// GetEntries - get file names
+func (t *TarReader) GetEntries() []string {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.entries
+}
+
+// GetEntry - get file content
+func (t *TarReader) GetEntry(name string, dest io.Writer) error {
+	return t.GetEntryContext(context.Background(), name, dest)
+}
+
+// GetEntryContext - get file content, stops if ctx is done
+func (t *TarReader) GetEntryContext(ctx context.Context, name string, dest io.Writer) error {
+	found := false
+
+	err := t.ForEachEntryContext(ctx, func(entry string, info EntryInfo, r io.Reader) error {
+		if entry != name {
+			return nil
+		}
+
+		found = true
+		if _, err := copyContext(ctx, dest, r); err != nil {
+			return err
+		}
+
+		return errStopIteration
+	})
+
+	switch {
+	case err != nil && err != errStopIteration:
+		return err
+	case !found:
+		return ErrEntryNotFound
+	}
+
+	return nil
+}
+
+// ForEachEntry - runs a function for every entry, in the archive order.
+// A non nil error returned by fn stops the iteration and is returned
+func (t *TarReader) ForEachEntry(fn ZipEntryCallback) error {
+	return t.ForEachEntryContext(context.Background(), fn)
+}
+
+// ForEachEntryContext - runs a function for every entry, stops if ctx is done
+func (t *TarReader) ForEachEntryContext(ctx context.Context, fn ZipEntryCallback) error {
+	return t.forEach(ctx, func(h *tar.Header, r io.Reader) error {
+		return fn(h.Name, newTarEntryInfo(h), r)
+	})
+}
+
+func (t *TarReader) forEach(ctx context.Context, fn func(h *tar.Header, r io.Reader) error) error {
+	tr, closer, err := t.open()
+	if err != nil {
+		return err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// the pax global headers are not entries
+		if h.Typeflag == tar.TypeXGlobalHeader {
+			continue
+		}
+
+		if err := fn(h, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func newTarEntryInfo(h *tar.Header) EntryInfo {
+	mode := h.FileInfo().Mode()
+
+	return EntryInfo{
+		Name:           h.Name,
+		Size:           h.Size,
+		CompressedSize: h.Size,
+		Modified:       h.ModTime,
+		Mode:           mode,
+		IsDir:          mode.IsDir(),
+	}
+}
+
+// ExtractAll - extracts the archive into destDir, as ZipReader.ExtractAll.
+// The hard links, devices and fifos are skipped
+func (t *TarReader) ExtractAll(destDir string, opts *ExtractOptions) error {
+	return t.ExtractAllContext(context.Background(), destDir, opts)
+}
+
+// ExtractAllContext - extracts the archive into destDir, stops if ctx is done
+func (t *TarReader) ExtractAllContext(ctx context.Context, destDir string, opts *ExtractOptions) error {
+	x, err := newExtractor(destDir, opts)
+	if err != nil {
+		return err
+	}
+
+	// the sizes of a tar header are the ones read, the ratio is the one of the archive
+	c := limitsCounter{limits: x.opts.Limits}
+
+	err = t.forEach(ctx, func(h *tar.Header, r io.Reader) error {
+		if h.Typeflag == tar.TypeLink {
+			return nil
+		}
+
+		if err := c.add(h.Name, h.Size, -1); err != nil {
+			return err
+		}
+		if c.limits != nil {
+			if err := c.limits.checkRatio("", c.total, t.size); err != nil {
+				return err
+			}
+		}
+
+		return x.add(ctx, h.Name, h.FileInfo().Mode(), h.ModTime, r, h.Linkname)
+	})
+	if err != nil {
+		return err
+	}
+
+	return x.finish()
+}
+
+// Close - free, closes the archive file opened by NewTarReaderFromFile
+func (t *TarReader) Close() error {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.closer == nil {
+		return nil
+	}
+
+	err := t.closer.Close()
+	t.closer = nil
+
+	return err
+}
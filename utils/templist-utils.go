@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tempList - IN list written as "expr IN (SELECT v FROM name)", with the items to fill name with
+type tempList struct {
+	name  string
+	items []interface{}
+}
+
+// SetInListTempTableThreshold - the "IN (?)" lists longer than n items are joined through a temp
+// table filled in the session running the query, instead of being expanded into one placeholder per item.
+// 0 (the default) keeps all the lists expanded; WithTempTableInLists forces the temp table for one query.
+// The temp tables are created and dropped around each run: in the transaction of ExecTx, RunQueryTx, etc.
+// or in a transaction of their own for Exec, RunQuery, etc.
+// Oracle needs private temporary tables (18c and later); in Oracle 11g the lists stay expanded
+func (u *DbUtils) SetInListTempTableThreshold(n int) {
+	u.tempListMin = n
+}
+
+// useTempList - checks if a list of n items is written as a temp table join
+func (pq *PreparedQuery) useTempList(n int) bool {
+	if pq.DbType == Oracle11g {
+		return false
+	}
+
+	return pq.forceTempLists || (pq.tempListMin > 0 && n > pq.tempListMin)
+}
+
+// tempListName - a new temp table name, in the naming rules of dbType
+func tempListName(dbType string) (string, error) {
+	id, err := newExportID()
+	if err != nil {
+		return "", err
+	}
+
+	name := "tmp_inlist_" + id[:12]
+
+	switch dbType {
+	case SQLServer:
+		return "#" + name, nil
+	case Oracle, Oci8:
+		return "ORA$PTT_" + strings.ToUpper(name), nil
+	default:
+		return name, nil
+	}
+}
+
+// withTempLists - fills the temp tables of the IN lists of pq and runs fn in the same session:
+// in tx or, if nil, in a transaction of its own. fn gets a copy of pq without the temp lists.
+// The temp tables are dropped after fn
+func (u *DbUtils) withTempLists(tx *sql.Tx, pq *PreparedQuery, fn func(tx *sql.Tx, pq *PreparedQuery) error) error {
+	if err := pq.Err(); err != nil {
+		return err
+	}
+
+	own := tx == nil
+	if own {
+		var err error
+		tx, err = u.BeginTransaction()
+		if err != nil {
+			return err
+		}
+		defer u.Rollback(tx)
+	}
+
+	var err error
+	created := 0
+
+	for _, l := range pq.tempLists {
+		if err = u.fillTempList(tx, l); err != nil {
+			break
+		}
+		created++
+	}
+
+	if err == nil {
+		run := *pq
+		run.tempLists = nil
+		err = fn(tx, &run)
+	}
+
+	// a failed fill may have created its table
+	if created < len(pq.tempLists) {
+		created++
+	}
+
+	for _, l := range pq.tempLists[:created] {
+		_, derr := tx.Exec(u.tempListDrop(l.name))
+		if derr != nil && err == nil {
+			err = derr
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if own {
+		return u.Commit(tx)
+	}
+
+	return nil
+}
+
+// fillTempList - creates the temp table of l and inserts its items, in batches of DefaultBatchSize
+func (u *DbUtils) fillTempList(tx *sql.Tx, l tempList) error {
+	for start := 0; start < len(l.items); start += DefaultBatchSize {
+		end := start + DefaultBatchSize
+		if end > len(l.items) {
+			end = len(l.items)
+		}
+
+		// the items are bound as the other args (UUIDs, enums, etc)
+		pq := u.PQuery(u.tempListInsert(l.name, end-start), l.items[start:end]...)
+		if err := pq.Err(); err != nil {
+			return err
+		}
+
+		if start == 0 {
+			colType, err := tempListColumnType(u.dbType, pq.Args)
+			if err != nil {
+				return err
+			}
+
+			if _, err := tx.Exec(u.tempListCreate(l.name, colType)); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.Exec(pq.Query, pq.Args...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (u *DbUtils) tempListCreate(name string, colType string) string {
+	switch u.dbType {
+	case Postgres, MySQL:
+		return fmt.Sprintf("CREATE TEMPORARY TABLE %s (v %s)", name, colType)
+	case Sqlite3:
+		return fmt.Sprintf("CREATE TEMP TABLE %s (v %s)", name, colType)
+	case Oracle, Oci8:
+		return fmt.Sprintf("CREATE PRIVATE TEMPORARY TABLE %s (v %s) ON COMMIT DROP DEFINITION", name, colType)
+	default:
+		return fmt.Sprintf("CREATE TABLE %s (v %s)", name, colType)
+	}
+}
+
+func (u *DbUtils) tempListDrop(name string) string {
+	if u.dbType == MySQL {
+		return "DROP TEMPORARY TABLE " + name
+	}
+
+	return "DROP TABLE " + name
+}
+
+// tempListInsert - inserts n rows with a single statement (INSERT ALL in Oracle)
+func (u *DbUtils) tempListInsert(name string, n int) string {
+	switch u.dbType {
+	case Oracle, Oci8:
+		into := strings.Repeat(" INTO "+name+" (v) VALUES (?)", n)
+		return "INSERT ALL" + into + " SELECT 1 FROM dual"
+	default:
+		values := strings.TrimSuffix(strings.Repeat("(?), ", n), ", ")
+		return "INSERT INTO " + name + " (v) VALUES " + values
+	}
+}
+
+// tempListColumnType - the column type of the temp table, from the first not null item
+func tempListColumnType(dbType string, items []interface{}) (string, error) {
+	var v driver.Value
+	for _, item := range items {
+		cv, err := driver.DefaultParameterConverter.ConvertValue(item)
+		if err != nil {
+			return "", err
+		}
+
+		if cv != nil {
+			v = cv
+			break
+		}
+	}
+
+	// by database type: Postgres, MySQL, SQL Server, Oracle, SQLite
+	var types [5]string
+
+	switch v.(type) {
+	case int64:
+		types = [5]string{"bigint", "bigint", "bigint", "number(19)", "integer"}
+	case float64:
+		types = [5]string{"double precision", "double", "float", "binary_double", "real"}
+	case bool:
+		types = [5]string{"boolean", "boolean", "bit", "number(1)", "integer"}
+	case []byte:
+		types = [5]string{"bytea", "varbinary(4000)", "varbinary(max)", "raw(2000)", "blob"}
+	case time.Time:
+		types = [5]string{"timestamp", "datetime(6)", "datetime2", "timestamp", "timestamp"}
+	case string, nil:
+		types = [5]string{"text", "varchar(4000)", "nvarchar(4000) COLLATE DATABASE_DEFAULT", "varchar2(4000)", "text"}
+	default:
+		return "", fmt.Errorf("unsupported IN list item for a temp table: %T", v)
+	}
+
+	switch dbType {
+	case Postgres:
+		return types[0], nil
+	case MySQL:
+		return types[1], nil
+	case SQLServer:
+		return types[2], nil
+	case Oracle, Oci8:
+		return types[3], nil
+	case Sqlite3:
+		return types[4], nil
+	default:
+		return "", fmt.Errorf("temp table IN lists are not supported in %s", dbType)
+	}
+}
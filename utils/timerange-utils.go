@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"sort"
+	"time"
+)
+
+// TimeRange - the half open interval [Start, End), for booking and availability checks:
+// a booking ending at 10:00 does not overlap one starting at 10:00.
+// A range whose End is not after its Start is empty
+type TimeRange struct {
+	Start time.Time
+	End   time.Time
+}
+
+// NewTimeRange - instantiates a TimeRange
+func NewTimeRange(start, end time.Time) TimeRange {
+	return TimeRange{Start: start, End: end}
+}
+
+// IsEmpty - checks if the range holds no time
+func (r TimeRange) IsEmpty() bool {
+	return !r.End.After(r.Start)
+}
+
+// Duration - returns the length of the range (0 if empty)
+func (r TimeRange) Duration() time.Duration {
+	if r.IsEmpty() {
+		return 0
+	}
+	return r.End.Sub(r.Start)
+}
+
+// Contains - checks if t is in the range
+func (r TimeRange) Contains(t time.Time) bool {
+	return InTimeSpanBounds(r.Start, r.End, t, SpanClosedOpen)
+}
+
+// ContainsRange - checks if o is entirely in the range. An empty o is in every range
+func (r TimeRange) ContainsRange(o TimeRange) bool {
+	if o.IsEmpty() {
+		return true
+	}
+	return !o.Start.Before(r.Start) && !o.End.After(r.End)
+}
+
+// Overlaps - checks if the ranges have some time in common
+func (r TimeRange) Overlaps(o TimeRange) bool {
+	return !r.IsEmpty() && !o.IsEmpty() && r.Start.Before(o.End) && o.Start.Before(r.End)
+}
+
+// Intersect - returns the time common to the ranges, false if they do not overlap
+func (r TimeRange) Intersect(o TimeRange) (TimeRange, bool) {
+	if !r.Overlaps(o) {
+		return TimeRange{}, false
+	}
+
+	return TimeRange{Start: MaxTime(r.Start, o.Start), End: MinTime(r.End, o.End)}, true
+}
+
+// Union - returns the range covering both ranges, false if they neither overlap nor touch
+// (their union would have a gap). An empty range is ignored
+func (r TimeRange) Union(o TimeRange) (TimeRange, bool) {
+	switch {
+	case o.IsEmpty():
+		return r, true
+	case r.IsEmpty():
+		return o, true
+	case r.Start.After(o.End) || o.Start.After(r.End):
+		return TimeRange{}, false
+	}
+
+	return TimeRange{Start: MinTime(r.Start, o.Start), End: MaxTime(r.End, o.End)}, true
+}
+
+// MergeRanges - returns the ranges sorted by Start, with the overlapping and touching ones merged
+// and the empty ones dropped. The ranges passed are not changed
+func MergeRanges(ranges []TimeRange) []TimeRange {
+	sorted := make([]TimeRange, 0, len(ranges))
+	for _, r := range ranges {
+		if !r.IsEmpty() {
+			sorted = append(sorted, r)
+		}
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Start.Before(sorted[j].Start)
+	})
+
+	var merged []TimeRange
+	for _, r := range sorted {
+		if n := len(merged); n > 0 {
+			if u, ok := merged[n-1].Union(r); ok {
+				merged[n-1] = u
+				continue
+			}
+		}
+
+		merged = append(merged, r)
+	}
+
+	return merged
+}
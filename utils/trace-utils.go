@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type spanKey struct {
+	event string
+	start time.Time
+}
+
+// SpanQuery - queries with the same fingerprint run while a trace was open
+type SpanQuery struct {
+	Query string `json:"query"`
+	Count int    `json:"count"`
+	// Elapsed - the total time of the queries
+	Elapsed time.Duration `json:"elapsed_ns"`
+	// ElapsedMs - Elapsed in milliseconds (with fractions)
+	ElapsedMs float64 `json:"elapsed_ms"`
+	Rows      int64   `json:"rows"`
+	Errors    int     `json:"errors,omitempty"`
+}
+
+type traceSpan struct {
+	audit *AuditLog
+	// parent - the span of the context TraceContext was called with, if any
+	parent  *traceSpan
+	ended   bool
+	queries map[string]*SpanQuery
+	elapsed time.Duration
+}
+
+// traceContextKey - the context key of the trace span
+type traceContextKey struct{}
+
+// SetTraceQueries - when enabled, the end entry written by Un for a TraceContext includes
+// the queries run through the DbUtils of the audit log with its context (see
+// PreparedQuery.SetTraceContext): their number, total time and a breakdown by normalized
+// query (count, elapsed ms, rows). A query counts for its span and the spans it is nested in
+func (a *AuditLog) SetTraceQueries(enabled bool) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	a.traceQueries = enabled
+
+	if enabled && !a.traceHooked {
+		a.traceHooked = true
+		a.dbutl.AddQueryHook(a.recordQuery)
+	}
+}
+
+// TraceContext - logs the start of the event s, as Trace, and returns a context carrying
+// its span, with the arguments of Un:
+//
+//	ctx, event, start := audit.TraceContext(ctx, "import")
+//	defer audit.Un(event, start)
+//	dbutl.Exec(dbutl.PQuery(q, id).SetTraceContext(ctx))
+func (a *AuditLog) TraceContext(ctx context.Context, s string) (context.Context, string, time.Time) {
+	s, startTime := a.Trace(s)
+
+	if span := a.startSpan(spanFromContext(ctx), s, startTime); span != nil {
+		ctx = context.WithValue(ctx, traceContextKey{}, span)
+	}
+
+	return ctx, s, startTime
+}
+
+// SetTraceContext - sets the context whose trace span the query is recorded in (see
+// AuditLog.TraceContext). Returns pq, so it can be chained: dbutl.PQuery(q, args...).SetTraceContext(ctx)
+func (pq *PreparedQuery) SetTraceContext(ctx context.Context) *PreparedQuery {
+	pq.traceCtx = ctx
+	return pq
+}
+
+func spanFromContext(ctx context.Context) *traceSpan {
+	if ctx == nil {
+		return nil
+	}
+
+	span, _ := ctx.Value(traceContextKey{}).(*traceSpan)
+
+	return span
+}
+
+func (a *AuditLog) startSpan(parent *traceSpan, event string, start time.Time) *traceSpan {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if !a.traceQueries {
+		return nil
+	}
+
+	if a.spans == nil {
+		a.spans = make(map[spanKey]*traceSpan)
+	}
+
+	span := &traceSpan{
+		audit:   a,
+		parent:  parent,
+		queries: make(map[string]*SpanQuery),
+	}
+	a.spans[spanKey{event, start}] = span
+
+	return span
+}
+
+func (a *AuditLog) endSpan(event string, start time.Time) *traceSpan {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	key := spanKey{event, start}
+	span := a.spans[key]
+	delete(a.spans, key)
+
+	if span != nil {
+		span.ended = true
+	}
+
+	return span
+}
+
+// recordQuery - query hook adding the query to the span of its trace context
+// and to the spans that one is nested in
+func (a *AuditLog) recordQuery(ev *QueryEvent) {
+	// the audit entries themselves are not traced
+	if ev.Query.Query == a.query {
+		return
+	}
+
+	span := spanFromContext(ev.Query.traceCtx)
+	if span == nil {
+		return
+	}
+
+	normalized := ev.Query.NormalizedQuery()
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	for ; span != nil; span = span.parent {
+		if span.audit != a || span.ended {
+			continue
+		}
+
+		sq, ok := span.queries[normalized]
+		if !ok {
+			sq = &SpanQuery{Query: normalized}
+			span.queries[normalized] = sq
+		}
+
+		sq.Count++
+		sq.Elapsed += ev.Duration
+		if ev.Rows > 0 {
+			sq.Rows += ev.Rows
+		}
+		if ev.Err != nil {
+			sq.Errors++
+		}
+
+		span.elapsed += ev.Duration
+	}
+}
+
+// breakdown - the queries of the span, slowest first
+func (s *traceSpan) breakdown() ([]SpanQuery, int) {
+	res := make([]SpanQuery, 0, len(s.queries))
+	count := 0
+
+	for _, sq := range s.queries {
+		q := *sq
+		q.ElapsedMs = DurationToMillis(q.Elapsed)
+		res = append(res, q)
+		count += sq.Count
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Elapsed > res[j].Elapsed
+	})
+
+	return res, count
+}
@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// TruncateTable - removes all rows of table and resets its identity / autoincrement counter.
+// Except for Postgres, TRUNCATE commits the current transaction, so no transaction version is provided.
+//   - Postgres: TRUNCATE TABLE ... RESTART IDENTITY CASCADE (tables referencing it are truncated too)
+//   - MySQL: TRUNCATE TABLE with the foreign key checks disabled for the session
+//   - SQL Server: TRUNCATE TABLE or, if the table is referenced by foreign keys,
+//     DELETE and DBCC CHECKIDENT to reseed the identity
+//   - Oracle: the enabled foreign keys referencing the table are disabled for the TRUNCATE
+//     and enabled afterwards (which fails if other tables still reference removed rows)
+//   - SQLite: DELETE and reset of the sqlite_sequence counter
+func (u *DbUtils) TruncateTable(table string) error {
+	if !identRegexp.MatchString(table) {
+		return fmt.Errorf("invalid table name: %s", table)
+	}
+
+	switch u.dbType {
+	case Postgres:
+		_, err := u.Exec(u.PQuery("TRUNCATE TABLE " + table + " RESTART IDENTITY CASCADE"))
+		return err
+	case MySQL:
+		return u.truncateMySQL(table)
+	case SQLServer:
+		return u.truncateMSSQL(table)
+	case Oracle, Oracle11g, Oci8:
+		return u.truncateOracle(table)
+	case Sqlite3:
+		return u.truncateSqlite(table)
+	}
+
+	_, err := u.Exec(u.PQuery("TRUNCATE TABLE " + table))
+	return err
+}
+
+func (u *DbUtils) truncateMySQL(table string) error {
+	ctx := context.Background()
+
+	// session settings need a dedicated connection
+	conn, err := u.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0")
+	if err != nil {
+		return err
+	}
+
+	_, err = conn.ExecContext(ctx, "TRUNCATE TABLE "+table)
+
+	_, err2 := conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1")
+	if err == nil {
+		err = err2
+	}
+
+	return err
+}
+
+func (u *DbUtils) truncateMSSQL(table string) error {
+	var references int
+
+	pq := u.PQuery("SELECT count(*) FROM sys.foreign_keys WHERE referenced_object_id = OBJECT_ID(?)", table)
+	err := u.db.QueryRow(pq.Query, pq.Args...).Scan(&references)
+	if err != nil {
+		return err
+	}
+
+	if references == 0 {
+		_, err = u.Exec(u.PQuery("TRUNCATE TABLE " + table))
+		return err
+	}
+
+	tx, err := u.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer u.Rollback(tx)
+
+	_, err = u.ExecTx(tx, u.PQuery("DELETE FROM "+table))
+	if err != nil {
+		return err
+	}
+
+	var hasIdentity sql.NullInt64
+	pq = u.PQuery("SELECT OBJECTPROPERTY(OBJECT_ID(?), 'TableHasIdentity')", table)
+	err = tx.QueryRow(pq.Query, pq.Args...).Scan(&hasIdentity)
+	if err != nil {
+		return err
+	}
+
+	if hasIdentity.Int64 == 1 {
+		_, err = u.ExecTx(tx, u.PQuery("DBCC CHECKIDENT ('"+table+"', RESEED, 0)"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return u.Commit(tx)
+}
+
+func (u *DbUtils) truncateOracle(table string) error {
+	owner := ""
+	name := table
+	if i := strings.Index(table, "."); i >= 0 {
+		owner = table[:i]
+		name = table[i+1:]
+	}
+
+	pq := u.PQuery(`
+		SELECT c.owner, c.table_name, c.constraint_name
+		  FROM all_constraints c
+		  JOIN all_constraints p ON p.owner = c.r_owner AND p.constraint_name = c.r_constraint_name
+		 WHERE c.constraint_type = 'R'
+		   AND c.status = 'ENABLED'
+		   AND p.owner = NVL(UPPER(?), USER)
+		   AND p.table_name = UPPER(?)
+	`, owner, name)
+
+	// "owner"."table" and "constraint" of each referencing foreign key
+	var tables, constraints []string
+	err := u.ForEachRow(pq, func(row *sql.Rows, sc *SQLScan) error {
+		var cOwner, cTable, cName string
+		if err := row.Scan(&cOwner, &cTable, &cName); err != nil {
+			return err
+		}
+
+		tables = append(tables, u.QuoteIdent(cOwner)+"."+u.QuoteIdent(cTable))
+		constraints = append(constraints, u.QuoteIdent(cName))
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for i := range constraints {
+		_, err = u.Exec(u.PQuery("ALTER TABLE " + tables[i] + " DISABLE CONSTRAINT " + constraints[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = u.Exec(u.PQuery("TRUNCATE TABLE " + table))
+
+	// the constraints are enabled even if the truncate failed
+	for i := range constraints {
+		_, err2 := u.Exec(u.PQuery("ALTER TABLE " + tables[i] + " ENABLE CONSTRAINT " + constraints[i]))
+		if err == nil {
+			err = err2
+		}
+	}
+
+	return err
+}
+
+func (u *DbUtils) truncateSqlite(table string) error {
+	tx, err := u.BeginTransaction()
+	if err != nil {
+		return err
+	}
+	defer u.Rollback(tx)
+
+	_, err = u.ExecTx(tx, u.PQuery("DELETE FROM "+table))
+	if err != nil {
+		return err
+	}
+
+	var found int
+	pq := u.PQuery("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = 'sqlite_sequence'")
+	err = tx.QueryRow(pq.Query).Scan(&found)
+	if err != nil {
+		return err
+	}
+
+	if found > 0 {
+		_, err = u.ExecTx(tx, u.PQuery("DELETE FROM sqlite_sequence WHERE name = ?", table))
+		if err != nil {
+			return err
+		}
+	}
+
+	return u.Commit(tx)
+}
@@ -0,0 +1,8 @@
+//go:build tzdata
+// +build tzdata
+
+package utils
+
+// embeds the zone database (about 450 KB) in the binary, used by LoadLocation
+// when the system has no zoneinfo files: go build -tags tzdata
+import _ "time/tzdata"
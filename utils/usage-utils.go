@@ -0,0 +1,326 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// UsageTable - table receiving the usage of each consumer, one row per consumer and period:
+//
+//	create table usage_stats (
+//	    period_start timestamp    not null,
+//	    period_end   timestamp    not null,
+//	    consumer     varchar(128) not null,
+//	    queries      bigint       not null,
+//	    rows_read    bigint       not null,
+//	    rows_written bigint       not null,
+//	    export_bytes bigint       not null
+//	);
+const UsageTable string = "usage_stats"
+
+// AnonymousConsumer - consumer of the queries run without one
+const AnonymousConsumer string = "anonymous"
+
+type consumerKeyType struct{}
+
+// WithConsumer - returns a context carrying the consumer (API key, tenant, job name)
+func WithConsumer(ctx context.Context, consumer string) context.Context {
+	return context.WithValue(ctx, consumerKeyType{}, consumer)
+}
+
+// ConsumerFromContext - returns the consumer set with WithConsumer, "" if none
+func ConsumerFromContext(ctx context.Context) string {
+	consumer, _ := ctx.Value(consumerKeyType{}).(string)
+	return consumer
+}
+
+// SetConsumer - sets the consumer the query is accounted to (see UsageMeter).
+// Returns pq, so it can be chained: dbutl.PQuery(q, args...).SetConsumer(utils.ConsumerFromContext(ctx))
+func (pq *PreparedQuery) SetConsumer(consumer string) *PreparedQuery {
+	pq.consumer = consumer
+	return pq
+}
+
+// Consumer - returns the consumer the query is accounted to
+func (pq *PreparedQuery) Consumer() string {
+	return pq.consumer
+}
+
+// ConsumerUsage - resources used by a consumer
+type ConsumerUsage struct {
+	Queries     int64 `json:"queries"`
+	RowsRead    int64 `json:"rows_read"`
+	RowsWritten int64 `json:"rows_written"`
+	ExportBytes int64 `json:"export_bytes"`
+}
+
+// exceeds - checks if u is over any of the non zero limits of quota
+func (u ConsumerUsage) exceeds(quota ConsumerUsage) bool {
+	return (quota.Queries > 0 && u.Queries > quota.Queries) ||
+		(quota.RowsRead > 0 && u.RowsRead > quota.RowsRead) ||
+		(quota.RowsWritten > 0 && u.RowsWritten > quota.RowsWritten) ||
+		(quota.ExportBytes > 0 && u.ExportBytes > quota.ExportBytes)
+}
+
+// QuotaExceededFunc - called (once per period) when a consumer goes over its soft quota
+type QuotaExceededFunc func(consumer string, usage ConsumerUsage, quota ConsumerUsage)
+
+// UsageMeter - accounts the queries run through a DbUtils, the rows they read or wrote and
+// the export bytes generated to their consumer. The usage is kept in memory and written to
+// the UsageTable table every period. Soft quotas only report, they never block queries
+type UsageMeter struct {
+	sync.RWMutex
+	schedule
+	healthGate
+	dbutl       *DbUtils
+	query       string
+	periodStart time.Time
+	usage       map[string]*ConsumerUsage
+	quotas      map[string]ConsumerUsage
+	exceeded    map[string]bool
+	onExceeded  QuotaExceededFunc
+	cancel      context.CancelFunc
+	wg          sync.WaitGroup
+}
+
+// NewUsageMeter - instantiates a UsageMeter and adds its query hook to dbutl
+func NewUsageMeter(dbutl *DbUtils) *UsageMeter {
+	m := &UsageMeter{
+		dbutl:       dbutl,
+		periodStart: time.Now().UTC(),
+		usage:       make(map[string]*ConsumerUsage),
+		quotas:      make(map[string]ConsumerUsage),
+		exceeded:    make(map[string]bool),
+	}
+
+	// prepared once with args of the types Flush binds, Flush runs the text with PQueryNoRewrite
+	var zero int64
+	pq := dbutl.PQuery(`
+		INSERT INTO `+UsageTable+` (
+			period_start, period_end, consumer, queries, rows_read, rows_written, export_bytes
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, m.periodStart, m.periodStart, "", zero, zero, zero, zero)
+	m.query = pq.Preview().Query
+
+	dbutl.AddQueryHook(m.recordQuery)
+
+	return m
+}
+
+// SetSoftQuota - sets the usage allowed to consumer in one period (zero fields are unlimited)
+func (m *UsageMeter) SetSoftQuota(consumer string, quota ConsumerUsage) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.quotas[consumer] = quota
+}
+
+// OnQuotaExceeded - sets the func called when a consumer goes over its soft quota
+func (m *UsageMeter) OnQuotaExceeded(fn QuotaExceededFunc) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.onExceeded = fn
+}
+
+// AddExportBytes - accounts n export bytes to consumer
+func (m *UsageMeter) AddExportBytes(consumer string, n int64) {
+	m.add(consumer, ConsumerUsage{ExportBytes: n})
+}
+
+// Usage - returns the usage of the current period, by consumer
+func (m *UsageMeter) Usage() map[string]ConsumerUsage {
+	m.RLock()
+	defer m.RUnlock()
+
+	res := make(map[string]ConsumerUsage, len(m.usage))
+	for consumer, u := range m.usage {
+		res[consumer] = *u
+	}
+
+	return res
+}
+
+// Start - writes the usage every period in the background. Stop must be called to end it.
+// The writes are skipped while the system is unhealthy (see SetHealthChecker), the usage
+// being kept for the next one
+func (m *UsageMeter) Start(period time.Duration) error {
+	if err := checkInterval(period); err != nil {
+		return err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	if m.cancel != nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+	m.setNextRun(time.Now().Add(period))
+
+	m.wg.Add(1)
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-ticker.C:
+				m.setNextRun(t.Add(period))
+				if m.healthy() {
+					m.Flush()
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Stop - stops the background writes and writes the usage of the current period
+func (m *UsageMeter) Stop() error {
+	m.Lock()
+	cancel := m.cancel
+	m.cancel = nil
+	m.Unlock()
+
+	if cancel != nil {
+		cancel()
+		m.wg.Wait()
+		m.setNextRun(time.Time{})
+	}
+
+	return m.Flush()
+}
+
+// Flush - writes the usage of the current period and starts a new period.
+// If the write fails, the usage is kept for the next flush
+func (m *UsageMeter) Flush() error {
+	m.Lock()
+	usage := m.usage
+	start := m.periodStart
+	end := time.Now().UTC()
+	m.usage = make(map[string]*ConsumerUsage)
+	m.exceeded = make(map[string]bool)
+	m.periodStart = end
+	m.Unlock()
+
+	if len(usage) == 0 {
+		return nil
+	}
+
+	consumers := make([]string, 0, len(usage))
+	for consumer := range usage {
+		consumers = append(consumers, consumer)
+	}
+	sort.Strings(consumers)
+
+	tx, err := m.dbutl.BeginTransaction()
+	if err == nil {
+		for _, consumer := range consumers {
+			u := usage[consumer]
+			pq := m.dbutl.PQueryNoRewrite(m.query,
+				start, end, consumer, u.Queries, u.RowsRead, u.RowsWritten, u.ExportBytes)
+
+			_, err = m.dbutl.ExecTx(tx, pq)
+			if err != nil {
+				break
+			}
+		}
+
+		if err != nil {
+			m.dbutl.Rollback(tx)
+		} else {
+			err = m.dbutl.Commit(tx)
+		}
+	}
+
+	if err != nil {
+		// keep the usage for the next flush
+		m.Lock()
+		m.periodStart = start
+		for consumer, u := range usage {
+			m.addLocked(consumer, *u)
+		}
+		m.Unlock()
+	}
+
+	return err
+}
+
+// recordQuery - query hook
+func (m *UsageMeter) recordQuery(ev *QueryEvent) {
+	// the usage rows themselves are not accounted
+	if ev.Query.Query == m.query {
+		return
+	}
+
+	u := ConsumerUsage{Queries: 1}
+	if ev.Rows > 0 {
+		if ev.Exec {
+			u.RowsWritten = ev.Rows
+		} else {
+			u.RowsRead = ev.Rows
+		}
+	}
+
+	m.add(ev.Query.consumer, u)
+}
+
+func (m *UsageMeter) add(consumer string, u ConsumerUsage) {
+	if consumer == "" {
+		consumer = AnonymousConsumer
+	}
+
+	m.Lock()
+	total := m.addLocked(consumer, u)
+
+	quota, hasQuota := m.quotas[consumer]
+	notify := hasQuota && !m.exceeded[consumer] && total.exceeds(quota) && m.onExceeded != nil
+	if notify {
+		m.exceeded[consumer] = true
+	}
+	onExceeded := m.onExceeded
+	m.Unlock()
+
+	if notify {
+		onExceeded(consumer, total, quota)
+	}
+}
+
+func (m *UsageMeter) addLocked(consumer string, u ConsumerUsage) ConsumerUsage {
+	total, ok := m.usage[consumer]
+	if !ok {
+		total = new(ConsumerUsage)
+		m.usage[consumer] = total
+	}
+
+	total.Queries += u.Queries
+	total.RowsRead += u.RowsRead
+	total.RowsWritten += u.RowsWritten
+	total.ExportBytes += u.ExportBytes
+
+	return *total
+}
+
+// countingWriter - counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
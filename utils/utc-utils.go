@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// UTCViolation - a time breaking the "UTC everywhere" convention
+type UTCViolation struct {
+	// Kind - "arg" for a bound argument not in UTC, "column" for a scanned time with a non UTC offset
+	Kind   string
+	Query  string
+	Arg    int
+	Column string
+	Value  time.Time
+	// Caller - file:line of the first caller outside this package
+	Caller string
+}
+
+// String - describes the violation
+func (v UTCViolation) String() string {
+	if v.Kind == "column" {
+		return fmt.Sprintf("%s: column %s scanned as %s (not UTC)", v.Caller, v.Column, v.Value.Format(time.RFC3339Nano))
+	}
+
+	return fmt.Sprintf("%s: arg %d bound as %s (not UTC) in %s", v.Caller, v.Arg+1, v.Value.Format(time.RFC3339Nano), strings.TrimSpace(v.Query))
+}
+
+// SetStrictUTC - diagnostic mode: report is called for each bound time.Time (or NullTime)
+// argument whose location is not UTC and for each time scanned by SQLScan with a non UTC offset.
+// nil disables the checks
+func (u *DbUtils) SetStrictUTC(report func(v UTCViolation)) {
+	u.utcMux.Lock()
+	defer u.utcMux.Unlock()
+
+	u.utcReport = report
+}
+
+// utcReporter - the report func set by SetStrictUTC, nil if the checks are disabled
+func (u *DbUtils) utcReporter() func(v UTCViolation) {
+	u.utcMux.RLock()
+	defer u.utcMux.RUnlock()
+
+	return u.utcReport
+}
+
+// LogUTCViolation - logs v in the audit log. Usable as the report func of DbUtils.SetStrictUTC
+func (a *AuditLog) LogUTCViolation(v UTCViolation) {
+	a.Log(errors.New("time not in UTC"), "utc", v.String(),
+		"kind", v.Kind,
+		"caller", v.Caller,
+		"value", v.Value.Format(time.RFC3339Nano))
+}
+
+// checkArgsUTC - reports the time args of pq not in UTC.
+// Called once per query run, by the entry points (exec, query, ExecReturningTx)
+func (u *DbUtils) checkArgsUTC(pq *PreparedQuery) {
+	report := u.utcReporter()
+	if report == nil {
+		return
+	}
+
+	for i, arg := range pq.Args {
+		t, ok := timeValue(arg)
+		if !ok || t.Location() == time.UTC {
+			continue
+		}
+
+		report(UTCViolation{
+			Kind:   "arg",
+			Query:  pq.SourceQuery(),
+			Arg:    i,
+			Value:  t,
+			Caller: callerSite(),
+		})
+	}
+}
+
+// checkScannedUTC - reports the scanned time with a non UTC offset
+func checkScannedUTC(report func(v UTCViolation), column string, dest interface{}) {
+	t, ok := timeValue(dest)
+	if !ok {
+		return
+	}
+
+	if _, offset := t.Zone(); offset == 0 {
+		return
+	}
+
+	report(UTCViolation{
+		Kind:   "column",
+		Column: column,
+		Value:  t,
+		Caller: callerSite(),
+	})
+}
+
+// timeValue - returns the time held by v (time.Time, NullTime, sql.NullTime or pointers to them)
+func timeValue(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case *time.Time:
+		if t != nil {
+			return *t, true
+		}
+	case NullTime:
+		return t.Time, t.Valid
+	case *NullTime:
+		if t != nil {
+			return t.Time, t.Valid
+		}
+	case sql.NullTime:
+		return t.Time, t.Valid
+	case *sql.NullTime:
+		if t != nil {
+			return t.Time, t.Valid
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// pkgFuncPrefix - prefix of the function names of this package, as returned by runtime
+var pkgFuncPrefix = strings.TrimSuffix(runtime.FuncForPC(reflect.ValueOf(pkgAnchor).Pointer()).Name(), "pkgAnchor")
+
+func pkgAnchor() {}
+
+// callerSite - returns file:line of the first caller outside this package
+func callerSite() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, pkgFuncPrefix) {
+			return fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+
+		if !more {
+			return "unknown"
+		}
+	}
+}
@@ -20,9 +20,79 @@ func GetUserHomeDir() string {
 	return os.Getenv("HOME")
 }
 
-// InTimeSpan - Checks if date is in time interval
+// InTimeSpan - Checks if date is in time interval.
+// Both ends are excluded (start < check < end), see InTimeSpanBounds to include them
 func InTimeSpan(start, end, check time.Time) bool {
-	return check.After(start) && check.Before(end)
+	return InTimeSpanBounds(start, end, check, SpanOpen)
+}
+
+// SpanBounds - which ends of a time span are part of it
+type SpanBounds int
+
+const (
+	// SpanOpen - start < t < end (InTimeSpan)
+	SpanOpen SpanBounds = iota
+	// SpanClosed - start <= t <= end
+	SpanClosed
+	// SpanClosedOpen - start <= t < end (DateRange.Contains)
+	SpanClosedOpen
+	// SpanOpenClosed - start < t <= end
+	SpanOpenClosed
+)
+
+// InTimeSpanBounds - Checks if date is in time interval, with the given bounds
+func InTimeSpanBounds(start, end, check time.Time, bounds SpanBounds) bool {
+	afterStart := check.After(start)
+	if bounds == SpanClosed || bounds == SpanClosedOpen {
+		afterStart = afterStart || check.Equal(start)
+	}
+
+	beforeEnd := check.Before(end)
+	if bounds == SpanClosed || bounds == SpanOpenClosed {
+		beforeEnd = beforeEnd || check.Equal(end)
+	}
+
+	return afterStart && beforeEnd
+}
+
+// MinTime - returns the earliest of the times
+func MinTime(t time.Time, times ...time.Time) time.Time {
+	for _, x := range times {
+		if x.Before(t) {
+			t = x
+		}
+	}
+	return t
+}
+
+// MaxTime - returns the latest of the times
+func MaxTime(t time.Time, times ...time.Time) time.Time {
+	for _, x := range times {
+		if x.After(t) {
+			t = x
+		}
+	}
+	return t
+}
+
+// ClampTime - returns t limited to [min, max]
+func ClampTime(t, min, max time.Time) time.Time {
+	if t.Before(min) {
+		return min
+	}
+	if t.After(max) {
+		return max
+	}
+	return t
+}
+
+// ZeroIfBefore - returns the zero time if t is before min (ex: the 0001-01-01 or 1900-01-01
+// sentinels some databases store for a missing date), else t
+func ZeroIfBefore(t, min time.Time) time.Time {
+	if t.Before(min) {
+		return time.Time{}
+	}
+	return t
 }
 
 // InvokeMethodByName - Invokes Method By Name
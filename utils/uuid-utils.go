@@ -0,0 +1,213 @@
+package utils
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// UUID - universally unique identifier, scanned from Postgres uuid, SQL Server
+// uniqueidentifier, Oracle RAW(16) and text columns. It is bound as its text form
+// ("xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx"), except in Oracle where it is bound as 16 bytes
+type UUID [16]byte
+
+// NewUUID - returns a random (version 4) UUID
+func NewUUID() (UUID, error) {
+	var u UUID
+
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, err
+	}
+
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+
+	return u, nil
+}
+
+// ParseUUID - parses the text form of a UUID, with or without dashes and braces
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+
+	h := strings.Replace(strings.Trim(s, "{}"), "-", "", -1)
+	if len(h) != 32 {
+		return u, fmt.Errorf("invalid UUID %q", s)
+	}
+
+	if _, err := hex.Decode(u[:], []byte(h)); err != nil {
+		return u, fmt.Errorf("invalid UUID %q: %w", s, err)
+	}
+
+	return u, nil
+}
+
+// String - returns the text form of the UUID
+func (u UUID) String() string {
+	h := hex.EncodeToString(u[:])
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+// IsZero - checks if all the bytes of the UUID are 0
+func (u UUID) IsZero() bool {
+	return u == UUID{}
+}
+
+// Scan implements the Scanner interface.
+// 16 bytes are read in RFC 4122 order (Postgres, Oracle RAW(16), BINARY(16)).
+// SQL Server sends uniqueidentifier mixed endian: scan it with DbUtils.UUIDScanner
+// or SQLScan, which know the database type
+func (u *UUID) Scan(value interface{}) error {
+	v, err := uuidFromDriver(value, false)
+	if err != nil {
+		return err
+	}
+
+	*u = v
+	return nil
+}
+
+// uuidScanner - scans a UUID in the byte order of the database
+type uuidScanner struct {
+	dest  *UUID
+	mssql bool
+}
+
+// Scan implements the Scanner interface.
+func (s uuidScanner) Scan(value interface{}) error {
+	v, err := uuidFromDriver(value, s.mssql)
+	if err != nil {
+		return err
+	}
+
+	*s.dest = v
+	return nil
+}
+
+// UUIDScanner - returns a rows.Scan destination reading into dest, in the byte
+// order of the database (mixed endian for a SQL Server uniqueidentifier)
+func (u *DbUtils) UUIDScanner(dest *UUID) sql.Scanner {
+	return uuidScanner{dest: dest, mssql: u.dbType == SQLServer}
+}
+
+// Value implements the driver Valuer interface.
+func (u UUID) Value() (driver.Value, error) {
+	return u.String(), nil
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (u UUID) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (u *UUID) UnmarshalText(b []byte) error {
+	v, err := ParseUUID(string(b))
+	if err != nil {
+		return err
+	}
+
+	*u = v
+	return nil
+}
+
+// uuidFromDriver - reads a uuid from its text or 16 byte form (mixed endian in SQL Server)
+func uuidFromDriver(value interface{}, mssql bool) (UUID, error) {
+	var u UUID
+
+	switch v := value.(type) {
+	case nil:
+		return u, nil
+	case string:
+		return ParseUUID(v)
+	case []byte:
+		if len(v) != 16 {
+			return ParseUUID(string(v))
+		}
+
+		copy(u[:], v)
+		if mssql {
+			// uniqueidentifier stores the first 3 groups little endian
+			u[0], u[1], u[2], u[3] = v[3], v[2], v[1], v[0]
+			u[4], u[5] = v[5], v[4]
+			u[6], u[7] = v[7], v[6]
+		}
+
+		return u, nil
+	default:
+		return u, fmt.Errorf("can't read %T as a UUID", value)
+	}
+}
+
+var (
+	uuidType    = reflect.TypeOf(UUID{})
+	uuidPtrType = reflect.TypeOf(&UUID{})
+	bytes16Type = reflect.TypeOf([16]byte{})
+	stringType  = reflect.TypeOf("")
+)
+
+// uuidConverter - returns the scan converter of UUID and *UUID fields and of the
+// [16]byte and string fields tagged with the uuid option, nil for other fields
+func uuidConverter(dbType string, fieldType reflect.Type, tagOpts []string) ConverterFunc {
+	isUUID := fieldType == uuidType || fieldType == uuidPtrType
+	tagged := hasTagOption(tagOpts, "uuid") && (fieldType == bytes16Type || fieldType == stringType)
+
+	if !isUUID && !tagged {
+		return nil
+	}
+
+	mssql := dbType == SQLServer
+
+	return func(src interface{}) (interface{}, error) {
+		if src == nil {
+			return nil, nil
+		}
+
+		u, err := uuidFromDriver(src, mssql)
+		if err != nil {
+			return nil, err
+		}
+
+		switch fieldType {
+		case uuidPtrType:
+			return &u, nil
+		case stringType:
+			return u.String(), nil
+		default:
+			return u, nil
+		}
+	}
+}
+
+// bindUUIDs - binds the UUID args as 16 bytes in Oracle (RAW(16)).
+// A raw [16]byte is bound as its bytes, as is, in all databases
+func (pq *PreparedQuery) bindUUIDs() {
+	oracle := false
+	switch pq.DbType {
+	case Oracle, Oracle11g, Oci8:
+		oracle = true
+	}
+
+	for i, arg := range pq.Args {
+		if b, ok := arg.([16]byte); ok {
+			pq.Args[i] = append([]byte(nil), b[:]...)
+			continue
+		}
+
+		if !oracle {
+			continue
+		}
+
+		switch u := arg.(type) {
+		case UUID:
+			pq.Args[i] = append([]byte(nil), u[:]...)
+		case *UUID:
+			if u != nil {
+				pq.Args[i] = append([]byte(nil), u[:]...)
+			}
+		}
+	}
+}
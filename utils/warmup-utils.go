@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// Warmup - rewrites and prepares the given statements ahead of their first use.
+// Exec, RunQuery and ForEachRow (and their Tx variants) reuse the prepared statements.
+// dests are the structs (or pointers to them) the queries are scanned into: the part of
+// the SQLScan mapping that depends only on the struct type (tags, converters) is computed
+// and cached now. The column to field mapping itself needs the columns of a result set,
+// it is cached at the first scan.
+// Returns the statements which failed to prepare and their errors (and the dests which
+// are not structs, by type name)
+func (u *DbUtils) Warmup(queries []string, dests ...interface{}) map[string]error {
+	failed := make(map[string]error)
+
+	for _, dest := range dests {
+		typ := reflect.TypeOf(dest)
+		for typ != nil && typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+
+		if typ == nil || typ.Kind() != reflect.Struct {
+			failed[fmt.Sprintf("%T", dest)] = fmt.Errorf("scan destination must be a struct, not %T", dest)
+			continue
+		}
+
+		getTypePlan(u, typ)
+	}
+
+	for _, query := range queries {
+		pq := u.PQuery(query)
+
+		if u.preparedStmt(pq.Query) != nil {
+			continue
+		}
+
+		stmt, err := u.db.Prepare(pq.Query)
+		if err != nil {
+			failed[query] = err
+			continue
+		}
+
+		u.stmtMux.Lock()
+		if u.stmts == nil {
+			u.stmts = make(map[string]*sql.Stmt)
+		}
+		if _, ok := u.stmts[pq.Query]; ok {
+			stmt.Close()
+		} else {
+			u.stmts[pq.Query] = stmt
+		}
+		u.stmtMux.Unlock()
+	}
+
+	return failed
+}
+
+// CloseStatements - closes the statements prepared by Warmup
+func (u *DbUtils) CloseStatements() error {
+	u.stmtMux.Lock()
+	defer u.stmtMux.Unlock()
+
+	var err error
+	for query, stmt := range u.stmts {
+		if e := stmt.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(u.stmts, query)
+	}
+
+	return err
+}
+
+func (u *DbUtils) preparedStmt(query string) *sql.Stmt {
+	u.stmtMux.RLock()
+	defer u.stmtMux.RUnlock()
+
+	if u.stmts == nil {
+		return nil
+	}
+
+	return u.stmts[query]
+}
@@ -1,225 +1,963 @@
-package utils
-
-import (
-	"archive/zip"
-	"bytes"
-	"errors"
-	"io"
-	"os"
-	"sync"
-)
-
-// ErrinvalidEntry - invalid entry index
-var ErrinvalidEntry = errors.New("invalid entry index")
-
-// ErrEOF - if the end of the zip archive was already reached
-var ErrEOF = errors.New("no more entries")
-
-// ErrEntryNotFound - entry not found
-var ErrEntryNotFound = errors.New("entry name not found")
-
-// ZipWriter - zip creator helper
-type ZipWriter struct {
-	sync.RWMutex
-	dest io.Writer
-	w    *zip.Writer
-}
-
-// NewZipWriter - instantiates a ZipWriter
-func NewZipWriter(dest io.Writer) *ZipWriter {
-	z := ZipWriter{}
-
-	z.dest = dest
-	z.w = zip.NewWriter(dest)
-
-	return &z
-}
-
-// AddFile - add file
-func (z *ZipWriter) AddFile(name string, sourcefile string) error {
-	f, err := os.Open(sourcefile)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	return z.AddFromReader(name, f)
-}
-
-// AddFromReader - add entry from io.reader
-func (z *ZipWriter) AddFromReader(name string, source io.Reader) error {
-	z.Lock()
-	defer z.Unlock()
-
-	f, err := z.w.Create(name)
-	if err != nil {
-		return err
-	}
-
-	_, err = io.Copy(f, source)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// AddEntry - add file
-func (z *ZipWriter) AddEntry(name string, content []byte) error {
-	z.Lock()
-	defer z.Unlock()
-
-	f, err := z.w.Create(name)
-	if err != nil {
-		return err
-	}
-	_, err = f.Write(content)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// Close - closes the archive and makes it ready to use
-// must call Close prior trying to using the newly created archive
-func (z *ZipWriter) Close() error {
-	z.Lock()
-	defer z.Unlock()
-
-	err := z.w.Close()
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// ZipReader - ZipReader helper
-type ZipReader struct {
-	sync.RWMutex
-	r            *zip.Reader
-	nrEntries    int
-	entries      []string
-	currentEntry int
-}
-
-// NewZipReader - instantiates a new ZipReader
-func NewZipReader(zipcontent []byte) (*ZipReader, error) {
-	z := ZipReader{}
-
-	n := int64(len(zipcontent))
-	r, err := zip.NewReader(bytes.NewReader(zipcontent), n)
-	if err != nil {
-		return nil, err
-	}
-
-	z.r = r
-	z.currentEntry = -1
-
-	z.nrEntries = len(z.r.File)
-	z.entries = make([]string, z.nrEntries)
-	for i, f := range z.r.File {
-		z.entries[i] = f.Name
-	}
-
-	return &z, nil
-}
-
-// GetEntries - get file names
-func (z *ZipReader) GetEntries() []string {
-	z.RLock()
-	defer z.RUnlock()
-
-	return z.entries
-}
-
-// GetEntry - get file content
-func (z *ZipReader) GetEntry(name string, dest io.Writer) error {
-	z.Lock()
-	defer z.Unlock()
-
-	for i, f := range z.r.File {
-		if name == f.Name {
-			err := z.readAtIndex(i, dest)
-			if err != nil {
-				return err
-			}
-		}
-	}
-
-	return ErrEntryNotFound
-}
-
-// ReadCurrentEntry - get current entry content
-func (z *ZipReader) ReadCurrentEntry(dest io.Writer) error {
-	z.Lock()
-	defer z.Unlock()
-	return z.readAtIndex(z.currentEntry, dest)
-}
-
-func (z *ZipReader) readAtIndex(i int, dest io.Writer) error {
-	if i < 0 {
-		return ErrinvalidEntry
-	}
-
-	if i > z.nrEntries-1 {
-		return ErrEOF
-	}
-
-	f := z.r.File[i]
-
-	rc, err := f.Open()
-	if err != nil {
-		return err
-	}
-	defer rc.Close()
-
-	_, err = io.Copy(dest, rc)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-// HasNextEntry - tests if there are more files to get
-func (z *ZipReader) HasNextEntry() bool {
-	z.Lock()
-	defer z.Unlock()
-
-	if z.currentEntry >= z.nrEntries-1 {
-		return false
-	}
-
-	return true
-}
-
-// GetNextEntry - gets the next file name
-func (z *ZipReader) GetNextEntry() (string, error) {
-	z.Lock()
-	defer z.Unlock()
-
-	if z.currentEntry >= z.nrEntries-1 {
-		return "", ErrEOF
-	}
-
-	z.currentEntry++
-	return z.r.File[z.currentEntry].Name, nil
-}
-
-// ResetEntryIndex - resets current index to the first file
-func (z *ZipReader) ResetEntryIndex() {
-	z.Lock()
-	defer z.Unlock()
-
-	z.currentEntry = -1
-}
-
-// Close - free
-func (z *ZipReader) Close() error {
-	z.Lock()
-	defer z.Unlock()
-
-	return nil
-}
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// copyChunkSize - number of bytes copied between context checks
+const copyChunkSize int64 = 1024 * 1024
+
+// largeEntrySize - entries from this size up are written as Zip64 entries (see ZipEntryOptions.Zip64),
+// under 4GB so the compressed size of an uncompressible content fits too
+const largeEntrySize int64 = 1<<32 - 1<<24
+
+// ErrinvalidEntry - invalid entry index
+var ErrinvalidEntry = errors.New("invalid entry index")
+
+// ErrEOF - if the end of the zip archive was already reached
+var ErrEOF = errors.New("no more entries")
+
+// ErrEntryNotFound - entry not found
+var ErrEntryNotFound = errors.New("entry name not found")
+
+// ZipWriter - zip creator helper
+type ZipWriter struct {
+	sync.RWMutex
+	dest  io.Writer
+	w     *zip.Writer
+	level int
+	store bool
+	zip64 bool
+	// deterministic mode: the entries are held until Close, see SetDeterministic
+	deterministic bool
+	modTime       time.Time
+	held          []*zipJob
+	// the entries compressed by workers (see SetConcurrency)
+	sem     chan struct{}
+	pending chan *zipJob
+	written chan struct{}
+	err     error
+}
+
+// ZipEntryOptions - the options of an entry, overriding the ones of the ZipWriter
+type ZipEntryOptions struct {
+	// Level - the Deflate level (flate.BestSpeed to flate.BestCompression, flate.HuffmanOnly),
+	// 0 for the level of the writer
+	Level int
+	// Store - the entry is stored without compression (already compressed content: jpg, zip, gz)
+	Store bool
+	// Modified - the modification time of the entry, none if zero
+	Modified time.Time
+	// Mode - the unix mode of the entry (permissions and type), none if zero
+	Mode os.FileMode
+	// Comment - the comment of the entry
+	Comment string
+	// Zip64 - the entry can be over 4GB: it is compressed first in a temporary file,
+	// so the local header holds its sizes in a Zip64 extra field, as the strict readers expect
+	// (a streamed entry has them only in its data descriptor and the central directory)
+	Zip64 bool
+}
+
+// NewZipWriter - instantiates a ZipWriter
+func NewZipWriter(dest io.Writer) *ZipWriter {
+	z := ZipWriter{}
+
+	z.dest = dest
+	z.w = zip.NewWriter(dest)
+	z.level = flate.DefaultCompression
+
+	return &z
+}
+
+// SetCompressionLevel - sets the Deflate level of the entries: flate.BestSpeed to
+// flate.BestCompression, flate.DefaultCompression or flate.HuffmanOnly
+func (z *ZipWriter) SetCompressionLevel(level int) error {
+	if err := checkDeflateLevel(level); err != nil {
+		return err
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	z.level = level
+
+	return nil
+}
+
+// SetStore - when enabled, the entries are stored without compression
+// (see ZipEntryOptions to choose per entry)
+func (z *ZipWriter) SetStore(store bool) {
+	z.Lock()
+	defer z.Unlock()
+
+	z.store = store
+}
+
+// SetZip64 - when enabled, the entries added from readers (of unknown size) are written
+// as entries that can be over 4GB (see ZipEntryOptions.Zip64). AddFile does it for the large files
+func (z *ZipWriter) SetZip64(zip64 bool) {
+	z.Lock()
+	defer z.Unlock()
+
+	z.zip64 = zip64
+}
+
+// deterministicModTime - the modification time of the entries in the deterministic mode
+// when none is set: the MS-DOS epoch
+var deterministicModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// SetDeterministic - enables the deterministic mode, so the same entries produce a byte-identical
+// archive: they are written sorted by name on Close, with modTime as modification time
+// (zero for 1980-01-01 UTC), mode 0644 (0755 for directories) and no data descriptor.
+// Must be called before adding entries. The compressed entries are held in memory
+// (in temporary files for the Zip64 ones) until Close
+func (z *ZipWriter) SetDeterministic(modTime time.Time) {
+	z.Lock()
+	defer z.Unlock()
+
+	if modTime.IsZero() {
+		modTime = deterministicModTime
+	}
+
+	z.deterministic = true
+	z.modTime = modTime
+}
+
+// fixHeader - sets the fixed attributes of the deterministic mode on h,
+// returns true for a directory entry (stored, empty)
+func (z *ZipWriter) fixHeader(h *zip.FileHeader) bool {
+	h.Modified = z.modTime
+
+	if strings.HasSuffix(h.Name, "/") {
+		h.SetMode(os.ModeDir | 0755)
+		return true
+	}
+
+	h.SetMode(0644)
+
+	return false
+}
+
+func checkDeflateLevel(level int) error {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("invalid compression level: %d", level)
+	}
+	return nil
+}
+
+// entrySettings - applies opts (if not nil) to h, returns the compression of the entry.
+// Must be called with the lock held
+func (z *ZipWriter) entrySettings(h *zip.FileHeader, opts *ZipEntryOptions) (int, bool, error) {
+	level, store := z.level, z.store
+	if opts != nil {
+		if !opts.Modified.IsZero() {
+			h.Modified = opts.Modified
+		}
+		if opts.Mode != 0 {
+			h.SetMode(opts.Mode)
+		}
+		if opts.Comment != "" {
+			h.Comment = opts.Comment
+		}
+
+		if opts.Level != 0 {
+			if err := checkDeflateLevel(opts.Level); err != nil {
+				return 0, false, err
+			}
+			level, store = opts.Level, false
+		}
+		store = store || opts.Store
+	}
+
+	return level, store, nil
+}
+
+// createEntry - adds the entry of header h, compressed as set by opts (if not nil) or the writer.
+// Must be called with the lock held
+func (z *ZipWriter) createEntry(h *zip.FileHeader, opts *ZipEntryOptions) (io.Writer, error) {
+	level, store, err := z.entrySettings(h, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if store {
+		h.Method = zip.Store
+		return z.w.CreateHeader(h)
+	}
+
+	// the compressor is looked up by CreateHeader, so each entry can have its own level
+	h.Method = zip.Deflate
+	z.w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
+
+	return z.w.CreateHeader(h)
+}
+
+// addSpooled - adds the entry of header h, compressed first in a temporary file,
+// so its sizes are known when the local header is written. Must be called with the lock held
+func (z *ZipWriter) addSpooled(ctx context.Context, h *zip.FileHeader, source io.Reader, opts *ZipEntryOptions) error {
+	level, store, err := z.entrySettings(h, opts)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile("", "zip-entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := compressEntry(ctx, tmp, source, h, level, store); err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return z.createRaw(ctx, h, tmp)
+}
+
+// compressEntry - compresses source in dest, setting the method, the sizes and the CRC32 of h
+func compressEntry(ctx context.Context, dest io.Writer, source io.Reader, h *zip.FileHeader, level int, store bool) error {
+	cw := &countingWriter{w: dest}
+	sum := crc32.NewIEEE()
+
+	var out io.WriteCloser = nopWriteCloser{cw}
+	h.Method = zip.Store
+
+	if !store {
+		fw, err := flate.NewWriter(cw, level)
+		if err != nil {
+			return err
+		}
+
+		out = fw
+		h.Method = zip.Deflate
+	}
+
+	n, err := copyContext(ctx, io.MultiWriter(out, sum), source)
+	if err != nil {
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	h.UncompressedSize64 = uint64(n)
+	h.CompressedSize64 = uint64(cw.n)
+	h.CRC32 = sum.Sum32()
+
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// createRaw - adds the entry of header h, with the content r already compressed and the
+// sizes and CRC32 set in h. Written with no data descriptor, the local header holds the sizes
+// (in a Zip64 extra field when over 4GB). Must be called with the lock held
+func (z *ZipWriter) createRaw(ctx context.Context, h *zip.FileHeader, r io.Reader) error {
+	// CreateRaw writes h as is, so it gets the fields set by CreateHeader.
+	// The Zip64 and timestamp extra fields of a copied header are written again
+	h.Flags &^= 0x8
+	h.Extra = removeExtra(h.Extra, 0x0001, 0x5455)
+	if !h.Modified.IsZero() {
+		h.ModifiedDate, h.ModifiedTime = msDosTime(h.Modified)
+		h.Extra = append(h.Extra, extTimeExtra(h.Modified)...)
+	}
+	if !isASCII(h.Name) || !isASCII(h.Comment) {
+		h.Flags |= 0x800
+	}
+	h.CreatorVersion = h.CreatorVersion&0xff00 | 20
+	h.ReaderVersion = 20
+
+	w, err := z.w.CreateRaw(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = copyContext(ctx, w, r)
+
+	return err
+}
+
+// extTimeExtra - the extended timestamp extra field (0x5455) holding the modification time
+func extTimeExtra(t time.Time) []byte {
+	b := make([]byte, 9)
+	binary.LittleEndian.PutUint16(b, 0x5455)
+	binary.LittleEndian.PutUint16(b[2:], 5)
+	b[4] = 1
+	binary.LittleEndian.PutUint32(b[5:], uint32(t.Unix()))
+
+	return b
+}
+
+// removeExtra - returns the extra fields of extra, without the ones of ids
+func removeExtra(extra []byte, ids ...uint16) []byte {
+	var out []byte
+
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := 4 + int(binary.LittleEndian.Uint16(extra[2:]))
+		if size > len(extra) {
+			break
+		}
+
+		keep := true
+		for _, rid := range ids {
+			if id == rid {
+				keep = false
+			}
+		}
+
+		if keep {
+			out = append(out, extra[:size]...)
+		}
+		extra = extra[size:]
+	}
+
+	return out
+}
+
+// msDosTime - the MS-DOS date and time fields of t, in its location.
+// The MS-DOS dates go from 1980 to 2107, the times out of range are clamped
+func msDosTime(t time.Time) (uint16, uint16) {
+	switch {
+	case t.Year() < 1980:
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, t.Location())
+	case t.Year() > 2107:
+		t = time.Date(2107, 12, 31, 23, 59, 58, 0, t.Location())
+	}
+
+	date := uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	clock := uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+
+	return date, clock
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// AddFile - add file
+func (z *ZipWriter) AddFile(name string, sourcefile string) error {
+	return z.AddFileContext(context.Background(), name, sourcefile)
+}
+
+// AddFileContext - add file, stops if ctx is done
+func (z *ZipWriter) AddFileContext(ctx context.Context, name string, sourcefile string) error {
+	if z.queued() {
+		fi, err := os.Stat(sourcefile)
+		if err != nil {
+			return err
+		}
+
+		opts := &ZipEntryOptions{Modified: fi.ModTime(), Mode: fi.Mode(), Zip64: fi.Size() >= largeEntrySize}
+		open := func() (io.ReadCloser, error) {
+			return os.Open(sourcefile)
+		}
+
+		return z.addJob(ctx, &zip.FileHeader{Name: name}, opts, open, jobCompress)
+	}
+
+	f, err := os.Open(sourcefile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the entry keeps the modification time and the permissions of the file
+	opts := &ZipEntryOptions{Modified: fi.ModTime(), Mode: fi.Mode(), Zip64: fi.Size() >= largeEntrySize}
+
+	return z.AddFromReaderWithOptions(ctx, name, f, opts)
+}
+
+// AddDir - adds all files from dir (recursively), entry names are prefixed with prefix
+func (z *ZipWriter) AddDir(dir string, prefix string) error {
+	return z.AddDirContext(context.Background(), dir, prefix)
+}
+
+// AddDirContext - adds all files from dir (recursively), stops if ctx is done
+func (z *ZipWriter) AddDirContext(ctx context.Context, dir string, prefix string) error {
+	return walkFiles(ctx, dir, prefix, func(name string, fpath string) error {
+		return z.AddFileContext(ctx, name, fpath)
+	})
+}
+
+// walkFiles - calls fn for the regular files of dir (recursively), with their entry name
+// prefixed with prefix, stops if ctx is done
+func walkFiles(ctx context.Context, dir string, prefix string, fn func(name string, fpath string) error) error {
+	return filepath.Walk(dir, func(fpath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, fpath)
+		if err != nil {
+			return err
+		}
+
+		return fn(path.Join(prefix, filepath.ToSlash(rel)), fpath)
+	})
+}
+
+// AddFromReader - add entry from io.reader
+func (z *ZipWriter) AddFromReader(name string, source io.Reader) error {
+	return z.AddFromReaderContext(context.Background(), name, source)
+}
+
+// AddFromReaderContext - add entry from io.reader, stops if ctx is done
+func (z *ZipWriter) AddFromReaderContext(ctx context.Context, name string, source io.Reader) error {
+	return z.AddFromReaderWithOptions(ctx, name, source, nil)
+}
+
+// AddFromReaderWithOptions - add entry from io.reader, with its own options, stops if ctx is done
+func (z *ZipWriter) AddFromReaderWithOptions(ctx context.Context, name string, source io.Reader, opts *ZipEntryOptions) error {
+	if z.queued() {
+		open := func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(source), nil
+		}
+
+		return z.addJob(ctx, &zip.FileHeader{Name: name}, opts, open, jobInline)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	if z.zip64 || (opts != nil && opts.Zip64) {
+		return z.addSpooled(ctx, &zip.FileHeader{Name: name}, source, opts)
+	}
+
+	f, err := z.createEntry(&zip.FileHeader{Name: name}, opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = copyContext(ctx, f, source)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// AddEntry - add file
+func (z *ZipWriter) AddEntry(name string, content []byte) error {
+	return z.AddEntryWithOptions(name, content, nil)
+}
+
+// AddEntryWithHeader - add file, with the modification time, mode, comment, extra fields
+// of h (see zip.FileInfoHeader). h.Method zip.Store stores the entry, else it is compressed
+// as set on the writer
+func (z *ZipWriter) AddEntryWithHeader(h *zip.FileHeader, content []byte) error {
+	opts := &ZipEntryOptions{Store: h.Method == zip.Store}
+
+	if z.queued() {
+		return z.addJob(context.Background(), h, opts, contentOpener(content), jobCompress)
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	if int64(len(content)) >= largeEntrySize {
+		return z.addSpooled(context.Background(), h, bytes.NewReader(content), opts)
+	}
+
+	f, err := z.createEntry(h, opts)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(content)
+
+	return err
+}
+
+// AddEntryWithOptions - add file, with its own options
+func (z *ZipWriter) AddEntryWithOptions(name string, content []byte, opts *ZipEntryOptions) error {
+	if z.queued() {
+		return z.addJob(context.Background(), &zip.FileHeader{Name: name}, opts, contentOpener(content), jobCompress)
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	if int64(len(content)) >= largeEntrySize || (opts != nil && opts.Zip64) {
+		return z.addSpooled(context.Background(), &zip.FileHeader{Name: name}, bytes.NewReader(content), opts)
+	}
+
+	f, err := z.createEntry(&zip.FileHeader{Name: name}, opts)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// CopyEntryFrom - copies the entry name of reader as it is compressed, with no decompression
+// and recompression (ex: to merge archives), keeping its header
+func (z *ZipWriter) CopyEntryFrom(reader *ZipReader, name string) error {
+	return z.CopyEntryFromContext(context.Background(), reader, name)
+}
+
+// CopyEntryFromContext - copies the entry name of reader as it is compressed, stops if ctx is done
+func (z *ZipWriter) CopyEntryFromContext(ctx context.Context, reader *ZipReader, name string) error {
+	f, err := reader.file(name)
+	if err != nil {
+		return err
+	}
+
+	return z.copyFile(ctx, f)
+}
+
+// CopyAllFrom - copies all the entries of reader as they are compressed, in the archive order
+func (z *ZipWriter) CopyAllFrom(reader *ZipReader) error {
+	return z.CopyAllFromContext(context.Background(), reader)
+}
+
+// CopyAllFromContext - copies all the entries of reader, stops if ctx is done
+func (z *ZipWriter) CopyAllFromContext(ctx context.Context, reader *ZipReader) error {
+	reader.RLock()
+	files := reader.r.File
+	reader.RUnlock()
+
+	for _, f := range files {
+		if err := z.copyFile(ctx, f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (z *ZipWriter) copyFile(ctx context.Context, f *zip.File) error {
+	h := f.FileHeader
+
+	// a modification time read from the MS-DOS fields only is kept in them
+	if len(removeExtra(h.Extra, 0x5455)) == len(h.Extra) {
+		h.Modified = time.Time{}
+	}
+
+	if z.queued() {
+		open := func() (io.ReadCloser, error) {
+			r, err := f.OpenRaw()
+			if err != nil {
+				return nil, err
+			}
+			return ioutil.NopCloser(r), nil
+		}
+
+		return z.addJob(ctx, &h, nil, open, jobRaw)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	r, err := f.OpenRaw()
+	if err != nil {
+		return fmt.Errorf("entry %s: %w", f.Name, err)
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	return z.createRaw(ctx, &h, r)
+}
+
+func contentOpener(content []byte) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), nil
+	}
+}
+
+// Close - closes the archive and makes it ready to use
+// must call Close prior trying to using the newly created archive
+func (z *ZipWriter) Close() error {
+	z.Lock()
+	pending := z.pending
+	z.pending = nil
+	z.Unlock()
+
+	// the queued entries are written first
+	if pending != nil {
+		close(pending)
+		<-z.written
+	}
+
+	z.Lock()
+	defer z.Unlock()
+
+	if err := z.writeHeld(); err != nil {
+		return err
+	}
+
+	err := z.w.Close()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ZipReader - ZipReader helper
+type ZipReader struct {
+	sync.RWMutex
+	r            *zip.Reader
+	closer       io.Closer
+	nrEntries    int
+	entries      []string
+	currentEntry int
+}
+
+// NewZipReader - instantiates a new ZipReader
+func NewZipReader(zipcontent []byte) (*ZipReader, error) {
+	return NewZipReaderAt(bytes.NewReader(zipcontent), int64(len(zipcontent)))
+}
+
+// NewZipReaderAt - instantiates a new ZipReader reading the archive of size bytes from r,
+// as the entries are read: only the central directory is loaded
+func NewZipReaderAt(r io.ReaderAt, size int64) (*ZipReader, error) {
+	z := ZipReader{}
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	z.r = zr
+	z.currentEntry = -1
+
+	z.nrEntries = len(z.r.File)
+	z.entries = make([]string, z.nrEntries)
+	for i, f := range z.r.File {
+		z.entries[i] = f.Name
+	}
+
+	return &z, nil
+}
+
+// NewZipReaderFromFile - instantiates a new ZipReader reading the archive file from disk,
+// as the entries are read. Close closes the file
+func NewZipReaderFromFile(fpath string) (*ZipReader, error) {
+	f, err := os.Open(fpath)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	z, err := NewZipReaderAt(f, fi.Size())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", fpath, err)
+	}
+
+	z.closer = f
+
+	return z, nil
+}
+
+// GetEntries - get file names
+func (z *ZipReader) GetEntries() []string {
+	z.RLock()
+	defer z.RUnlock()
+
+	return z.entries
+}
+
+// EntryInfo - the header data of an archive entry
+type EntryInfo struct {
+	Name string `json:"name"`
+	// Size - the uncompressed size
+	Size           int64       `json:"size"`
+	CompressedSize int64       `json:"compressed_size"`
+	CRC32          uint32      `json:"crc32"`
+	Modified       time.Time   `json:"modified"`
+	Mode           os.FileMode `json:"mode"`
+	IsDir          bool        `json:"is_dir"`
+}
+
+func newEntryInfo(f *zip.File) EntryInfo {
+	return EntryInfo{
+		Name:           f.Name,
+		Size:           int64(f.UncompressedSize64),
+		CompressedSize: int64(f.CompressedSize64),
+		CRC32:          f.CRC32,
+		Modified:       f.Modified,
+		Mode:           f.Mode(),
+		IsDir:          f.Mode().IsDir(),
+	}
+}
+
+// EntryInfos - get the header data of the entries, in the archive order
+func (z *ZipReader) EntryInfos() []EntryInfo {
+	z.RLock()
+	defer z.RUnlock()
+
+	infos := make([]EntryInfo, len(z.r.File))
+	for i, f := range z.r.File {
+		infos[i] = newEntryInfo(f)
+	}
+
+	return infos
+}
+
+// GetEntryInfo - get the header data of the entry name
+func (z *ZipReader) GetEntryInfo(name string) (EntryInfo, error) {
+	f, err := z.file(name)
+	if err != nil {
+		return EntryInfo{}, err
+	}
+
+	return newEntryInfo(f), nil
+}
+
+// file - the first entry name
+func (z *ZipReader) file(name string) (*zip.File, error) {
+	z.RLock()
+	defer z.RUnlock()
+
+	for _, f := range z.r.File {
+		if f.Name == name {
+			return f, nil
+		}
+	}
+
+	return nil, ErrEntryNotFound
+}
+
+// GetEntry - get file content
+func (z *ZipReader) GetEntry(name string, dest io.Writer) error {
+	return z.GetEntryContext(context.Background(), name, dest)
+}
+
+// GetEntryContext - get file content, stops if ctx is done
+func (z *ZipReader) GetEntryContext(ctx context.Context, name string, dest io.Writer) error {
+	z.Lock()
+	defer z.Unlock()
+
+	for i, f := range z.r.File {
+		if name == f.Name {
+			return z.readAtIndex(ctx, i, dest)
+		}
+	}
+
+	return ErrEntryNotFound
+}
+
+// OpenEntry - opens the entry name for reading (ex: into a json.Decoder), the caller closes it.
+// The reader checks the size and CRC32 of the entry at its end, and does not use the current
+// entry of GetNextEntry, so entries can be read concurrently
+func (z *ZipReader) OpenEntry(name string) (io.ReadCloser, error) {
+	f, err := z.file(name)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("entry %s: %w", name, err)
+	}
+
+	return rc, nil
+}
+
+// ZipEntryCallback - callback type, r reads the content of the entry
+type ZipEntryCallback func(name string, info EntryInfo, r io.Reader) error
+
+// ForEachEntry - runs a function for every entry, in the archive order.
+// A non nil error returned by fn stops the iteration and is returned.
+// It does not use the current entry of GetNextEntry, so it can run concurrently
+func (z *ZipReader) ForEachEntry(fn ZipEntryCallback) error {
+	return z.ForEachEntryContext(context.Background(), fn)
+}
+
+// ForEachEntryContext - runs a function for every entry, stops if ctx is done
+func (z *ZipReader) ForEachEntryContext(ctx context.Context, fn ZipEntryCallback) error {
+	z.RLock()
+	files := z.r.File
+	z.RUnlock()
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := forEntry(f, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func forEntry(f *zip.File, fn ZipEntryCallback) error {
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("entry %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	return fn(f.Name, newEntryInfo(f), rc)
+}
+
+// ReadCurrentEntry - get current entry content
+func (z *ZipReader) ReadCurrentEntry(dest io.Writer) error {
+	return z.ReadCurrentEntryContext(context.Background(), dest)
+}
+
+// ReadCurrentEntryContext - get current entry content, stops if ctx is done
+func (z *ZipReader) ReadCurrentEntryContext(ctx context.Context, dest io.Writer) error {
+	z.Lock()
+	defer z.Unlock()
+	return z.readAtIndex(ctx, z.currentEntry, dest)
+}
+
+func (z *ZipReader) readAtIndex(ctx context.Context, i int, dest io.Writer) error {
+	if i < 0 {
+		return ErrinvalidEntry
+	}
+
+	if i > z.nrEntries-1 {
+		return ErrEOF
+	}
+
+	f := z.r.File[i]
+
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	_, err = copyContext(ctx, dest, rc)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// HasNextEntry - tests if there are more files to get
+func (z *ZipReader) HasNextEntry() bool {
+	z.Lock()
+	defer z.Unlock()
+
+	if z.currentEntry >= z.nrEntries-1 {
+		return false
+	}
+
+	return true
+}
+
+// GetNextEntry - gets the next file name
+func (z *ZipReader) GetNextEntry() (string, error) {
+	z.Lock()
+	defer z.Unlock()
+
+	if z.currentEntry >= z.nrEntries-1 {
+		return "", ErrEOF
+	}
+
+	z.currentEntry++
+	return z.r.File[z.currentEntry].Name, nil
+}
+
+// ResetEntryIndex - resets current index to the first file
+func (z *ZipReader) ResetEntryIndex() {
+	z.Lock()
+	defer z.Unlock()
+
+	z.currentEntry = -1
+}
+
+// Close - free, closes the archive file opened by NewZipReaderFromFile
+func (z *ZipReader) Close() error {
+	z.Lock()
+	defer z.Unlock()
+
+	if z.closer == nil {
+		return nil
+	}
+
+	err := z.closer.Close()
+	z.closer = nil
+
+	return err
+}
+
+// copyContext - io.Copy in chunks, checking ctx between them
+func copyContext(ctx context.Context, dst io.Writer, src io.Reader) (int64, error) {
+	var written int64
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		n, err := io.CopyN(dst, src, copyChunkSize)
+		written += n
+
+		if err == io.EOF {
+			return written, nil
+		}
+
+		if err != nil {
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package utils
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// zip64EntrySize - just over 4GB, so the sizes don't fit in the 32 bit header fields
+const zip64EntrySize int64 = 1<<32 + 1<<20
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestZipWriterZip64FromReader(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes and reads back a 4GB entry")
+	}
+
+	zpath := filepath.Join(t.TempDir(), "large.zip")
+
+	writeZip(t, zpath, func(z *ZipWriter) error {
+		opts := &ZipEntryOptions{Zip64: true, Modified: time.Date(2020, 5, 6, 7, 8, 10, 0, time.UTC)}
+		return z.AddFromReaderWithOptions(context.Background(), "large.bin", io.LimitReader(zeroReader{}, zip64EntrySize), opts)
+	})
+
+	checkZip64Entry(t, zpath, "large.bin")
+}
+
+func TestZipWriterZip64SparseFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes and reads back a 4GB entry")
+	}
+
+	dir := t.TempDir()
+
+	// a sparse file: the 4GB of zeros take no disk space
+	src := filepath.Join(dir, "large.bin")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Truncate(zip64EntrySize); err != nil {
+		f.Close()
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zpath := filepath.Join(dir, "large.zip")
+
+	// AddFile writes the files from largeEntrySize up as Zip64 entries by itself
+	writeZip(t, zpath, func(z *ZipWriter) error {
+		if err := z.AddEntry("small.txt", []byte("small")); err != nil {
+			return err
+		}
+		return z.AddFile("large.bin", src)
+	})
+
+	checkZip64Entry(t, zpath, "large.bin")
+}
+
+func TestMsDosTimeClamp(t *testing.T) {
+	tests := []struct {
+		t    time.Time
+		want time.Time
+	}{
+		{time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(1979, 12, 31, 23, 59, 59, 0, time.UTC), time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC), time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC)},
+		{time.Date(2200, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2107, 12, 31, 23, 59, 58, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		date, clock := msDosTime(tt.t)
+		h := zip.FileHeader{ModifiedDate: date, ModifiedTime: clock}
+
+		//lint:ignore SA1019 the MS-DOS fields are the ones tested
+		if got := h.ModTime(); !got.Equal(tt.want) {
+			t.Errorf("msDosTime(%v) = %v, want %v", tt.t, got, tt.want)
+		}
+	}
+}
+
+func writeZip(t *testing.T, zpath string, add func(z *ZipWriter) error) {
+	t.Helper()
+
+	out, err := os.Create(zpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+
+	z := NewZipWriter(out)
+	if err := z.SetCompressionLevel(flate.BestSpeed); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := add(z); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := out.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkZip64Entry - reads the entry name of the archive zpath back and checks that
+// its local header holds the sizes in a Zip64 extra field
+func checkZip64Entry(t *testing.T, zpath string, name string) {
+	t.Helper()
+
+	zr, err := zip.OpenReader(zpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+
+	var f *zip.File
+	for _, zf := range zr.File {
+		if zf.Name == name {
+			f = zf
+		}
+	}
+	if f == nil {
+		t.Fatalf("entry %s not found", name)
+	}
+
+	if f.UncompressedSize64 != uint64(zip64EntrySize) {
+		t.Fatalf("uncompressed size %d, want %d", f.UncompressedSize64, zip64EntrySize)
+	}
+
+	offset, err := f.DataOffset()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	uncompressed, compressed := localZip64Sizes(t, zpath, name, offset)
+	if uncompressed != f.UncompressedSize64 || compressed != f.CompressedSize64 {
+		t.Fatalf("local Zip64 sizes %d / %d, central directory %d / %d",
+			uncompressed, compressed, f.UncompressedSize64, f.CompressedSize64)
+	}
+
+	// the content is read back through ZipReader, checked with the CRC32 of the zeros
+	r, err := NewZipReaderFromFile(zpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	h := crc32.NewIEEE()
+	if err := r.GetEntry(name, h); err != nil {
+		t.Fatal(err)
+	}
+
+	want := crc32.NewIEEE()
+	if _, err := io.Copy(want, io.LimitReader(zeroReader{}, zip64EntrySize)); err != nil {
+		t.Fatal(err)
+	}
+
+	if h.Sum32() != want.Sum32() || f.CRC32 != want.Sum32() {
+		t.Fatalf("crc32 read %08x, header %08x, want %08x", h.Sum32(), f.CRC32, want.Sum32())
+	}
+}
+
+// localZip64Sizes - the sizes in the Zip64 extra field of the local header of the
+// entry name, whose content starts at dataOffset
+func localZip64Sizes(t *testing.T, zpath string, name string, dataOffset int64) (uint64, uint64) {
+	t.Helper()
+
+	file, err := os.Open(zpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// the local extra fields can differ from the central ones: the header is the one
+	// whose name and extra fields end at dataOffset
+	fixed := make([]byte, 30)
+	last := dataOffset - int64(len(fixed)+len(name))
+	first := last - 0xffff
+	if first < 0 {
+		first = 0
+	}
+
+	start := last
+	for ; start >= first; start-- {
+		if _, err := file.ReadAt(fixed, start); err != nil {
+			t.Fatal(err)
+		}
+
+		nameLen := int64(binary.LittleEndian.Uint16(fixed[26:]))
+		extraLen := int64(binary.LittleEndian.Uint16(fixed[28:]))
+		if binary.LittleEndian.Uint32(fixed) == 0x04034b50 && nameLen == int64(len(name)) &&
+			start+int64(len(fixed))+nameLen+extraLen == dataOffset {
+			break
+		}
+	}
+	if start < first {
+		t.Fatal("local header not found")
+	}
+
+	if binary.LittleEndian.Uint32(fixed[18:]) != 0xffffffff || binary.LittleEndian.Uint32(fixed[22:]) != 0xffffffff {
+		t.Fatal("local header sizes not set to 0xffffffff")
+	}
+
+	extra := make([]byte, binary.LittleEndian.Uint16(fixed[28:]))
+	if _, err := file.ReadAt(extra, start+int64(len(fixed)+len(name))); err != nil {
+		t.Fatal(err)
+	}
+
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra)
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if 4+size > len(extra) {
+			break
+		}
+
+		if id == 0x0001 && size >= 16 {
+			return binary.LittleEndian.Uint64(extra[4:]), binary.LittleEndian.Uint64(extra[12:])
+		}
+
+		extra = extra[4+size:]
+	}
+
+	t.Fatal("no Zip64 extra field in the local header")
+
+	return 0, 0
+}
@@ -0,0 +1,393 @@
+package utils
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrUnsafePath - an entry would be written outside the destination directory
+// (zip slip: ../ in its name, an absolute name or a symlink leading out)
+var ErrUnsafePath = errors.New("entry path outside the destination directory")
+
+// ExtractOptions - ExtractAll options, the zero value restores the modification times and
+// the permissions, refuses to overwrite files and skips the symlinks
+type ExtractOptions struct {
+	// Overwrite - replaces the existing files, else the extraction fails on them
+	Overwrite bool
+	// IgnoreModTimes - the files get the time of the extraction
+	IgnoreModTimes bool
+	// IgnorePermissions - the files get the default permissions (0644 less the umask)
+	IgnorePermissions bool
+	// Symlinks - creates the symlink entries whose target is inside the destination directory
+	// (the others are an ErrUnsafePath), else they are skipped
+	Symlinks bool
+	// Limits - the limits of the extracted entries (see ZipLimits), checked before
+	// extracting anything from a zip and as the entries are read from a tar
+	Limits *ZipLimits
+}
+
+// ExtractAll - extracts the archive into destDir (created if missing), see ExtractOptions.
+// A nil opts uses the defaults
+func (z *ZipReader) ExtractAll(destDir string, opts *ExtractOptions) error {
+	return z.ExtractAllContext(context.Background(), destDir, opts)
+}
+
+// ExtractAllContext - extracts the archive into destDir, stops if ctx is done
+func (z *ZipReader) ExtractAllContext(ctx context.Context, destDir string, opts *ExtractOptions) error {
+	return z.extract(ctx, destDir, opts, nil)
+}
+
+// extract - extracts the entries accepted by filter (all if nil) into destDir
+func (z *ZipReader) extract(ctx context.Context, destDir string, opts *ExtractOptions, filter func(f *zip.File) bool) error {
+	z.RLock()
+	defer z.RUnlock()
+
+	files := make([]*zip.File, 0, len(z.r.File))
+	for _, f := range z.r.File {
+		if filter == nil || filter(f) {
+			files = append(files, f)
+		}
+	}
+
+	if opts != nil {
+		if err := checkZipLimits(files, opts.Limits); err != nil {
+			return err
+		}
+	}
+
+	x, err := newExtractor(destDir, opts)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := x.extractZipFile(ctx, f); err != nil {
+			return err
+		}
+	}
+
+	return x.finish()
+}
+
+func (x *extractor) extractZipFile(ctx context.Context, f *zip.File) error {
+	mode := f.Mode()
+
+	if mode.IsDir() || (mode&os.ModeSymlink != 0 && !x.opts.Symlinks) {
+		return x.add(ctx, f.Name, mode, f.Modified, nil, "")
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("entry %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	if mode&os.ModeSymlink == 0 {
+		return x.add(ctx, f.Name, mode, f.Modified, rc, "")
+	}
+
+	// the content of a symlink entry is its target
+	b, err := ioutil.ReadAll(io.LimitReader(rc, 4096))
+	if err != nil {
+		return fmt.Errorf("entry %s: %w", f.Name, err)
+	}
+
+	return x.add(ctx, f.Name, mode, f.Modified, nil, string(b))
+}
+
+// extractor - writes the entries of an archive (zip, tar) in a destination directory
+type extractor struct {
+	root string
+	opts *ExtractOptions
+	dirs []dirTime
+}
+
+type dirTime struct {
+	path    string
+	modTime time.Time
+}
+
+func newExtractor(destDir string, opts *ExtractOptions) (*extractor, error) {
+	if opts == nil {
+		opts = &ExtractOptions{}
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return nil, err
+	}
+
+	root, err := filepath.Abs(destDir)
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &extractor{root: root, opts: opts}, nil
+}
+
+// add - extracts the entry name: a directory, a symlink to link, or a file with the content of r.
+// The entries of other types are skipped
+func (x *extractor) add(ctx context.Context, name string, mode os.FileMode, modTime time.Time, r io.Reader, link string) error {
+	target, err := entryPath(x.root, name)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case mode.IsDir():
+		err = x.dir(target, mode, modTime)
+	case mode&os.ModeSymlink != 0:
+		if !x.opts.Symlinks {
+			return nil
+		}
+
+		err = extractSymlink(x.root, target, link, x.opts.Overwrite)
+	case mode.IsRegular():
+		err = extractFile(ctx, x.root, target, r, mode, modTime, x.opts)
+	}
+
+	if err != nil {
+		return fmt.Errorf("entry %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (x *extractor) dir(target string, mode os.FileMode, modTime time.Time) error {
+	perm := mode.Perm() | 0700
+	if x.opts.IgnorePermissions {
+		perm = 0755
+	}
+
+	if err := mkdirInside(x.root, target, perm); err != nil {
+		return err
+	}
+
+	if !x.opts.IgnorePermissions {
+		if err := os.Chmod(target, perm); err != nil {
+			return err
+		}
+	}
+
+	x.dirs = append(x.dirs, dirTime{target, modTime})
+
+	return nil
+}
+
+// finish - sets the directory times, last as the files written in them change them
+func (x *extractor) finish() error {
+	if x.opts.IgnoreModTimes {
+		return nil
+	}
+
+	for i := len(x.dirs) - 1; i >= 0; i-- {
+		if x.dirs[i].modTime.IsZero() {
+			continue
+		}
+
+		if err := os.Chtimes(x.dirs[i].path, x.dirs[i].modTime, x.dirs[i].modTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// entryPath - returns the path of the entry name in root, refusing the names leading outside it
+func entryPath(root, name string) (string, error) {
+	name = strings.Replace(name, "\\", "/", -1)
+
+	if name == "" || path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("entry %s: %w", name, ErrUnsafePath)
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("entry %s: %w", name, ErrUnsafePath)
+		}
+	}
+
+	return filepath.Join(root, filepath.FromSlash(name)), nil
+}
+
+// isInside - checks if p is root or in root
+func isInside(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel))
+}
+
+// mkdirInside - creates dir (and its parents), checking it does not lead outside root
+// through a symlink extracted earlier or already there
+func mkdirInside(root, dir string, perm os.FileMode) error {
+	// the closest existing parent is checked before anything is created
+	existing := dir
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+
+	if err := checkInside(root, existing); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, perm); err != nil {
+		return err
+	}
+
+	return checkInside(root, dir)
+}
+
+// checkInside - checks that p, its symlinks followed, is in root
+func checkInside(root, p string) error {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return err
+	}
+
+	if !isInside(root, resolved) {
+		return ErrUnsafePath
+	}
+
+	return nil
+}
+
+func extractFile(ctx context.Context, root, target string, r io.Reader, mode os.FileMode, modTime time.Time, opts *ExtractOptions) error {
+	if err := mkdirInside(root, filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	// an existing symlink would be followed by the write
+	if fi, err := os.Lstat(target); err == nil {
+		if !opts.Overwrite {
+			return os.ErrExist
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 || fi.IsDir() {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+	}
+
+	perm := mode.Perm()
+	if perm == 0 || opts.IgnorePermissions {
+		perm = 0644
+	}
+
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+
+	_, err = copyContext(ctx, out, r)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	// the umask applied by OpenFile, or the mode of an overwritten file
+	if !opts.IgnorePermissions {
+		if err := os.Chmod(target, perm); err != nil {
+			return err
+		}
+	}
+
+	if !opts.IgnoreModTimes && !modTime.IsZero() {
+		return os.Chtimes(target, modTime, modTime)
+	}
+
+	return nil
+}
+
+func extractSymlink(root, target, link string, overwrite bool) error {
+	link = filepath.FromSlash(link)
+
+	if link == "" || filepath.IsAbs(link) || filepath.VolumeName(link) != "" {
+		return ErrUnsafePath
+	}
+
+	if err := mkdirInside(root, filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	if err := checkLinkInside(root, filepath.Dir(target), link); err != nil {
+		return err
+	}
+
+	if _, err := os.Lstat(target); err == nil {
+		if !overwrite {
+			return os.ErrExist
+		}
+
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+
+	return os.Symlink(link, target)
+}
+
+// checkLinkInside - checks that the symlink link, created in dir, leads inside root.
+// The target is resolved as the system does, following the symlinks already there
+// (a lexical check lets "l2 -> ." and "l1 -> l2/.." out). ".." is allowed only at
+// the start of the target: after a symlink, or a name that can become one later,
+// it would depend on where that symlink points
+func checkLinkInside(root, dir, link string) error {
+	cur, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+
+	named := false
+	for _, part := range strings.Split(link, string(filepath.Separator)) {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			if named {
+				return ErrUnsafePath
+			}
+			cur = filepath.Dir(cur)
+		default:
+			named = true
+			cur = filepath.Join(cur, part)
+			if resolved, err := filepath.EvalSymlinks(cur); err == nil {
+				cur = resolved
+			}
+		}
+
+		if !isInside(root, cur) {
+			return ErrUnsafePath
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"archive/zip"
+	"context"
+	"path"
+	"strings"
+)
+
+// MatchEntryName - checks if the entry name matches pattern, a path.Match pattern where
+// a ** segment matches any number of directories: "reports/**/*.csv" matches
+// reports/a.csv and reports/2021/01/a.csv. A trailing / of the directory entries is ignored
+func MatchEntryName(pattern, name string) (bool, error) {
+	pattern = strings.TrimSuffix(pattern, "/")
+	name = strings.TrimSuffix(name, "/")
+
+	patterns := strings.Split(pattern, "/")
+
+	// the pattern is checked whole, not only up to the first mismatch
+	for _, p := range patterns {
+		if p == "**" {
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			return false, err
+		}
+	}
+
+	return matchSegments(patterns, strings.Split(name, "/")), nil
+}
+
+func matchSegments(patterns, names []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			// ** takes 0, 1, ... segments
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(patterns[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(names) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(patterns[0], names[0]); !ok {
+			return false
+		}
+
+		patterns, names = patterns[1:], names[1:]
+	}
+
+	return len(names) == 0
+}
+
+// GetEntriesMatching - get the file names matching pattern (see MatchEntryName)
+func (z *ZipReader) GetEntriesMatching(pattern string) ([]string, error) {
+	if _, err := MatchEntryName(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	z.RLock()
+	defer z.RUnlock()
+
+	var names []string
+	for _, name := range z.entries {
+		if ok, _ := MatchEntryName(pattern, name); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names, nil
+}
+
+// ExtractMatching - extracts the entries matching pattern (see MatchEntryName) into destDir,
+// as ExtractAll
+func (z *ZipReader) ExtractMatching(destDir, pattern string, opts *ExtractOptions) error {
+	return z.ExtractMatchingContext(context.Background(), destDir, pattern, opts)
+}
+
+// ExtractMatchingContext - extracts the entries matching pattern into destDir, stops if ctx is done
+func (z *ZipReader) ExtractMatchingContext(ctx context.Context, destDir, pattern string, opts *ExtractOptions) error {
+	if _, err := MatchEntryName(pattern, ""); err != nil {
+		return err
+	}
+
+	return z.extract(ctx, destDir, opts, func(f *zip.File) bool {
+		ok, _ := MatchEntryName(pattern, f.Name)
+		return ok
+	})
+}
+
+// ExtractFunc - extracts the entries for which accept returns true into destDir, as ExtractAll
+func (z *ZipReader) ExtractFunc(destDir string, opts *ExtractOptions, accept func(info EntryInfo) bool) error {
+	return z.extract(context.Background(), destDir, opts, func(f *zip.File) bool {
+		return accept(newEntryInfo(f))
+	})
+}
@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"archive/zip"
+	"fmt"
+	"math"
+)
+
+// ratioMinSize - the compression ratio is checked for the entries from this size up,
+// as small files (of repeated bytes) can legitimately have high ratios
+const ratioMinSize int64 = 1024 * 1024
+
+// ZipLimits - limits of the archives read, against the zip bombs (archives with many
+// entries or small entries expanding to huge files). A zero field is no limit
+type ZipLimits struct {
+	// MaxEntries - the maximum number of entries
+	MaxEntries int
+	// MaxEntrySize - the maximum uncompressed size of an entry
+	MaxEntrySize int64
+	// MaxTotalSize - the maximum uncompressed size of all the entries
+	MaxTotalSize int64
+	// MaxRatio - the maximum compression ratio (uncompressed / compressed size) of an entry
+	// (of the archive for a tar.gz), checked from 1MB up
+	MaxRatio int64
+}
+
+// ZipLimit - a limit of ZipLimits
+type ZipLimit string
+
+// ZipLimits fields
+const (
+	LimitEntries   ZipLimit = "entries"
+	LimitEntrySize ZipLimit = "entry size"
+	LimitTotalSize ZipLimit = "total size"
+	LimitRatio     ZipLimit = "compression ratio"
+)
+
+// ZipLimitError - returned when an archive exceeds one of its ZipLimits
+type ZipLimitError struct {
+	Limit ZipLimit
+	// Entry - the entry exceeding the limit, empty for the limits of the archive
+	Entry string
+	Value int64
+	Max   int64
+}
+
+// Error - describes the limit exceeded
+func (e *ZipLimitError) Error() string {
+	if e.Entry == "" {
+		return fmt.Sprintf("archive exceeds the %s limit: %d > %d", e.Limit, e.Value, e.Max)
+	}
+
+	return fmt.Sprintf("entry %s exceeds the %s limit: %d > %d", e.Entry, e.Limit, e.Value, e.Max)
+}
+
+// limitsCounter - checks the entries of an archive as they are read
+type limitsCounter struct {
+	limits  *ZipLimits
+	entries int
+	total   int64
+}
+
+// add - accounts an entry of size bytes, compressed in compressed bytes (ratio not checked if < 0)
+func (c *limitsCounter) add(name string, size int64, compressed int64) error {
+	l := c.limits
+	if l == nil {
+		return nil
+	}
+
+	c.entries++
+	c.total += size
+
+	switch {
+	case l.MaxEntries > 0 && c.entries > l.MaxEntries:
+		return &ZipLimitError{Limit: LimitEntries, Value: int64(c.entries), Max: int64(l.MaxEntries)}
+	case l.MaxEntrySize > 0 && size > l.MaxEntrySize:
+		return &ZipLimitError{Limit: LimitEntrySize, Entry: name, Value: size, Max: l.MaxEntrySize}
+	case l.MaxTotalSize > 0 && c.total > l.MaxTotalSize:
+		return &ZipLimitError{Limit: LimitTotalSize, Value: c.total, Max: l.MaxTotalSize}
+	case compressed >= 0:
+		return l.checkRatio(name, size, compressed)
+	}
+
+	return nil
+}
+
+func (l *ZipLimits) checkRatio(name string, size int64, compressed int64) error {
+	if l.MaxRatio <= 0 || size < ratioMinSize {
+		return nil
+	}
+
+	if compressed < 1 {
+		compressed = 1
+	}
+
+	if ratio := size / compressed; ratio > l.MaxRatio {
+		return &ZipLimitError{Limit: LimitRatio, Entry: name, Value: ratio, Max: l.MaxRatio}
+	}
+
+	return nil
+}
+
+// CheckLimits - checks the archive against limits, before reading its entries.
+// The sizes checked are the ones of the central directory, the entries being read
+// failing with zip.ErrFormat if their content is larger
+func (z *ZipReader) CheckLimits(limits *ZipLimits) error {
+	z.RLock()
+	defer z.RUnlock()
+
+	return checkZipLimits(z.r.File, limits)
+}
+
+func checkZipLimits(files []*zip.File, limits *ZipLimits) error {
+	c := limitsCounter{limits: limits}
+
+	for _, f := range files {
+		if err := c.add(f.Name, clampSize(f.UncompressedSize64), clampSize(f.CompressedSize64)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clampSize - the size u of a header, a forged one over the int64 range being the maximum
+func clampSize(u uint64) int64 {
+	if u > math.MaxInt64 {
+		return math.MaxInt64
+	}
+
+	return int64(u)
+}
@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// SetConcurrency - compresses up to workers entries at a time, the entries being written
+// in the order they were added. Must be called before adding entries, workers < 2 keeps
+// compressing them one at a time.
+// The compressed entries are buffered in memory (in temporary files for the Zip64 ones)
+// until written. AddEntry, AddFile return before their entry is written, so the content
+// passed to AddEntry must not be changed until Close, and the errors are returned by the
+// next call or by Close. AddFromReader compresses its entry before returning, as the reader
+// is not used after, the entries of several goroutines being compressed concurrently
+func (z *ZipWriter) SetConcurrency(workers int) {
+	z.Lock()
+	defer z.Unlock()
+
+	if workers < 2 || z.pending != nil {
+		return
+	}
+
+	z.sem = make(chan struct{}, workers)
+	z.pending = make(chan *zipJob, workers)
+	z.written = make(chan struct{})
+
+	go z.writeJobs(z.pending)
+}
+
+// jobKind - how the content of a queued entry is produced
+type jobKind int
+
+const (
+	// jobCompress - compressed by a worker
+	jobCompress jobKind = iota
+	// jobInline - compressed by the caller, as its reader is not used after the call
+	jobInline
+	// jobRaw - already compressed, copied by the caller (see CopyEntryFrom)
+	jobRaw
+)
+
+// zipJob - an entry compressed by a worker, written by the writer goroutine
+type zipJob struct {
+	ctx  context.Context
+	h    *zip.FileHeader
+	kind jobKind
+	buf  bytes.Buffer
+	tmp  *os.File
+	err  error
+	done chan struct{}
+}
+
+// queued - reports if the entries are compressed before being written: by workers
+// or held until Close in the deterministic mode
+func (z *ZipWriter) queued() bool {
+	z.RLock()
+	defer z.RUnlock()
+
+	return z.pending != nil || z.deterministic
+}
+
+// addJob - queues the entry of header h, whose content is read from open.
+// The entry is compressed by a worker, or by the caller if not a jobCompress or with no workers
+func (z *ZipWriter) addJob(ctx context.Context, h *zip.FileHeader, opts *ZipEntryOptions, open func() (io.ReadCloser, error), kind jobKind) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	z.Lock()
+	level, store, err := z.entrySettings(h, opts)
+	if err == nil {
+		err = z.err
+	}
+	spool := z.zip64 || (opts != nil && opts.Zip64) || h.CompressedSize64 >= uint64(largeEntrySize)
+	sem, pending := z.sem, z.pending
+	if z.deterministic {
+		store = z.fixHeader(h) || store
+	}
+	z.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	job := &zipJob{ctx: ctx, h: h, kind: kind, done: make(chan struct{})}
+
+	if kind != jobCompress || pending == nil {
+		job.run(open, level, store, spool)
+		if job.err != nil {
+			job.cleanup()
+			return job.err
+		}
+	}
+
+	if pending == nil {
+		z.Lock()
+		z.held = append(z.held, job)
+		z.Unlock()
+
+		return nil
+	}
+
+	if kind == jobCompress {
+		sem <- struct{}{}
+		go func() {
+			defer func() { <-sem }()
+			job.run(open, level, store, spool)
+		}()
+	}
+
+	pending <- job
+
+	return nil
+}
+
+func (j *zipJob) run(open func() (io.ReadCloser, error), level int, store bool, spool bool) {
+	defer close(j.done)
+
+	if err := j.compress(open, level, store, spool); err != nil {
+		j.err = fmt.Errorf("entry %s: %w", j.h.Name, err)
+	}
+}
+
+func (j *zipJob) compress(open func() (io.ReadCloser, error), level int, store bool, spool bool) error {
+	src, err := open()
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	var out io.Writer = &j.buf
+
+	if spool {
+		j.tmp, err = ioutil.TempFile("", "zip-entry-*")
+		if err != nil {
+			return err
+		}
+		out = j.tmp
+	}
+
+	if j.kind == jobRaw {
+		_, err = copyContext(j.ctx, out, src)
+		return err
+	}
+
+	return compressEntry(j.ctx, out, src, j.h, level, store)
+}
+
+// content - the compressed content of the entry
+func (j *zipJob) content() (io.Reader, error) {
+	if j.tmp == nil {
+		return &j.buf, nil
+	}
+
+	if _, err := j.tmp.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return j.tmp, nil
+}
+
+func (j *zipJob) cleanup() {
+	if j.tmp != nil {
+		j.tmp.Close()
+		os.Remove(j.tmp.Name())
+	}
+}
+
+// writeHeld - writes the entries held by the deterministic mode, sorted by name,
+// returns the error of a queued entry if any. Must be called with the lock held
+func (z *ZipWriter) writeHeld() error {
+	held := z.held
+	z.held = nil
+
+	defer func() {
+		for _, job := range held {
+			job.cleanup()
+		}
+	}()
+
+	if z.err != nil {
+		return z.err
+	}
+
+	sort.SliceStable(held, func(i, j int) bool {
+		return held[i].h.Name < held[j].h.Name
+	})
+
+	for _, job := range held {
+		r, err := job.content()
+		if err != nil {
+			return err
+		}
+
+		if err := z.createRaw(job.ctx, job.h, r); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writeJobs - writes the entries in the order they were queued, once compressed.
+// After an error the next entries are dropped, the error being returned by the writer
+func (z *ZipWriter) writeJobs(pending <-chan *zipJob) {
+	defer close(z.written)
+
+	for job := range pending {
+		<-job.done
+
+		z.Lock()
+		err := z.err
+		if err == nil {
+			err = job.err
+		}
+		if err == nil && z.deterministic {
+			z.held = append(z.held, job)
+			z.Unlock()
+			continue
+		}
+		if err == nil {
+			var r io.Reader
+			r, err = job.content()
+			if err == nil {
+				err = z.createRaw(job.ctx, job.h, r)
+			}
+		}
+		z.err = err
+		z.Unlock()
+
+		job.cleanup()
+	}
+}
@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// ErrEntryTooLarge - an entry does not fit in a part of a SplitZipWriter
+var ErrEntryTooLarge = errors.New("entry larger than the part size")
+
+// zipEndSize - the size of the end of central directory records (with the Zip64 ones)
+const zipEndSize int64 = 22 + 56 + 20
+
+// ZipPart - an archive written by a SplitZipWriter
+type ZipPart struct {
+	Number  int      `json:"number"`
+	Size    int64    `json:"size"`
+	Entries []string `json:"entries"`
+}
+
+// SplitZipWriter - writes the entries in several archives (parts) of at most maxSize bytes each,
+// for the transfers limiting the file size. Every part is a complete archive, readable alone;
+// the entries are not split between parts
+type SplitZipWriter struct {
+	sync.Mutex
+	maxSize int64
+	create  func(part int) (io.WriteCloser, error)
+	level   int
+	out     io.WriteCloser
+	cw      *countingWriter
+	zw      *ZipWriter
+	size    int64
+	parts   []ZipPart
+}
+
+// NewSplitZipWriter - instantiates a SplitZipWriter writing the parts (numbered from 1)
+// in the writers returned by create, closed when the part is full
+func NewSplitZipWriter(maxSize int64, create func(part int) (io.WriteCloser, error)) *SplitZipWriter {
+	return &SplitZipWriter{maxSize: maxSize, create: create, level: flate.DefaultCompression}
+}
+
+// NewSplitZipFiles - instantiates a SplitZipWriter writing the parts in the files
+// prefix.001.zip, prefix.002.zip, ...
+func NewSplitZipFiles(prefix string, maxSize int64) *SplitZipWriter {
+	return NewSplitZipWriter(maxSize, func(part int) (io.WriteCloser, error) {
+		return os.Create(fmt.Sprintf("%s.%03d.zip", prefix, part))
+	})
+}
+
+// SetCompressionLevel - sets the Deflate level of the entries, as ZipWriter.SetCompressionLevel
+func (s *SplitZipWriter) SetCompressionLevel(level int) error {
+	if err := checkDeflateLevel(level); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.level = level
+
+	return nil
+}
+
+// AddFile - add file
+func (s *SplitZipWriter) AddFile(name string, sourcefile string) error {
+	return s.AddFileContext(context.Background(), name, sourcefile)
+}
+
+// AddFileContext - add file, keeping its modification time and permissions, stops if ctx is done
+func (s *SplitZipWriter) AddFileContext(ctx context.Context, name string, sourcefile string) error {
+	f, err := os.Open(sourcefile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	h := &zip.FileHeader{Name: name, Modified: fi.ModTime()}
+	h.SetMode(fi.Mode())
+
+	return s.add(ctx, h, f)
+}
+
+// AddDir - adds all files from dir (recursively), entry names are prefixed with prefix
+func (s *SplitZipWriter) AddDir(dir string, prefix string) error {
+	return s.AddDirContext(context.Background(), dir, prefix)
+}
+
+// AddDirContext - adds all files from dir (recursively), stops if ctx is done
+func (s *SplitZipWriter) AddDirContext(ctx context.Context, dir string, prefix string) error {
+	return walkFiles(ctx, dir, prefix, func(name string, fpath string) error {
+		return s.AddFileContext(ctx, name, fpath)
+	})
+}
+
+// AddFromReader - add entry from io.reader
+func (s *SplitZipWriter) AddFromReader(name string, source io.Reader) error {
+	return s.AddFromReaderContext(context.Background(), name, source)
+}
+
+// AddFromReaderContext - add entry from io.reader, stops if ctx is done
+func (s *SplitZipWriter) AddFromReaderContext(ctx context.Context, name string, source io.Reader) error {
+	return s.add(ctx, &zip.FileHeader{Name: name}, source)
+}
+
+// AddEntry - add file
+func (s *SplitZipWriter) AddEntry(name string, content []byte) error {
+	return s.AddFromReaderContext(context.Background(), name, bytes.NewReader(content))
+}
+
+// add - compresses the entry in a temporary file, to know its size, then writes it
+// in the current part, or in a new one if it does not fit
+func (s *SplitZipWriter) add(ctx context.Context, h *zip.FileHeader, source io.Reader) error {
+	s.Lock()
+	level := s.level
+	s.Unlock()
+
+	tmp, err := ioutil.TempFile("", "zip-entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if err := compressEntry(ctx, tmp, source, h, level, false); err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	size := rawEntrySize(h)
+	if size+zipEndSize > s.maxSize {
+		return fmt.Errorf("entry %s: %d bytes: %w", h.Name, size, ErrEntryTooLarge)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	if s.zw != nil && s.size+size+zipEndSize > s.maxSize {
+		if err := s.closePart(); err != nil {
+			return err
+		}
+	}
+
+	if s.zw == nil {
+		if err := s.newPart(); err != nil {
+			return err
+		}
+	}
+
+	s.zw.Lock()
+	err = s.zw.createRaw(ctx, h, tmp)
+	s.zw.Unlock()
+	if err != nil {
+		return err
+	}
+
+	s.size += size
+	part := &s.parts[len(s.parts)-1]
+	part.Entries = append(part.Entries, h.Name)
+
+	return nil
+}
+
+// rawEntrySize - the maximum size an entry of h takes in an archive: local header, content
+// and central directory header, with the timestamp (9 bytes) and Zip64 (20, 28 bytes) extra fields
+func rawEntrySize(h *zip.FileHeader) int64 {
+	header := int64(len(h.Name) + len(h.Extra) + 9)
+
+	return 30 + header + 20 + int64(h.CompressedSize64) + 46 + header + 28 + int64(len(h.Comment))
+}
+
+// newPart - starts the next part. Must be called with the lock held
+func (s *SplitZipWriter) newPart() error {
+	number := len(s.parts) + 1
+
+	out, err := s.create(number)
+	if err != nil {
+		return err
+	}
+
+	s.out = out
+	s.cw = &countingWriter{w: out}
+	s.zw = NewZipWriter(s.cw)
+	s.size = 0
+	s.parts = append(s.parts, ZipPart{Number: number})
+
+	return nil
+}
+
+// closePart - completes the current part. Must be called with the lock held
+func (s *SplitZipWriter) closePart() error {
+	err := s.zw.Close()
+	if cerr := s.out.Close(); err == nil {
+		err = cerr
+	}
+
+	s.parts[len(s.parts)-1].Size = s.cw.n
+	s.zw, s.out, s.cw = nil, nil, nil
+
+	return err
+}
+
+// Close - completes the last part. A SplitZipWriter with no entries writes no part
+func (s *SplitZipWriter) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.zw == nil {
+		return nil
+	}
+
+	return s.closePart()
+}
+
+// Parts - the parts written, with their entries: the manifest of the archive
+func (s *SplitZipWriter) Parts() []ZipPart {
+	s.Lock()
+	defer s.Unlock()
+
+	parts := make([]ZipPart, len(s.parts))
+	copy(parts, s.parts)
+
+	return parts
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+)
+
+// ErrVerifyFailed - entries of the archive failed the verification, see the VerifyReport
+var ErrVerifyFailed = errors.New("archive verification failed")
+
+// EntryCheck - the verification of an entry
+type EntryCheck struct {
+	Name string `json:"name"`
+	// Size - the bytes read (uncompressed)
+	Size int64 `json:"size"`
+	// CRC32 - the checksum of the header, Computed - the one of the content read
+	CRC32    uint32 `json:"crc32"`
+	Computed uint32 `json:"computed_crc32"`
+	// Err - why the entry failed (zip.ErrChecksum, zip.ErrFormat, ...), nil if valid
+	Err   error  `json:"-"`
+	Error string `json:"error,omitempty"`
+}
+
+// VerifyReport - the verification of the entries of an archive, in the archive order
+type VerifyReport struct {
+	Entries []EntryCheck `json:"entries"`
+	Failed  int          `json:"failed"`
+}
+
+// OK - reports if all the entries are valid
+func (r *VerifyReport) OK() bool {
+	return r.Failed == 0
+}
+
+// Verify - reads every entry, checking its size and CRC32 against its header, without
+// extracting it. Returns ErrVerifyFailed if entries are invalid, the report listing them
+func (z *ZipReader) Verify() (*VerifyReport, error) {
+	return z.VerifyContext(context.Background())
+}
+
+// VerifyContext - verifies the entries, stops if ctx is done
+func (z *ZipReader) VerifyContext(ctx context.Context) (*VerifyReport, error) {
+	z.RLock()
+	files := z.r.File
+	z.RUnlock()
+
+	report := &VerifyReport{Entries: make([]EntryCheck, 0, len(files))}
+
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		check := verifyEntry(ctx, f)
+		if check.Err != nil {
+			if check.Err == ctx.Err() {
+				return report, check.Err
+			}
+
+			check.Error = check.Err.Error()
+			report.Failed++
+		}
+
+		report.Entries = append(report.Entries, check)
+	}
+
+	if report.Failed > 0 {
+		return report, ErrVerifyFailed
+	}
+
+	return report, nil
+}
+
+func verifyEntry(ctx context.Context, f *zip.File) EntryCheck {
+	check := EntryCheck{Name: f.Name, CRC32: f.CRC32}
+
+	rc, err := f.Open()
+	if err != nil {
+		check.Err = err
+		return check
+	}
+	defer rc.Close()
+
+	sum := crc32.NewIEEE()
+
+	// the reader of the entry checks the size and, unless zero, the CRC32 of the header
+	check.Size, check.Err = copyContext(ctx, ioutil.Discard, io.TeeReader(rc, sum))
+	check.Computed = sum.Sum32()
+
+	if check.Err == nil && check.Computed != f.CRC32 {
+		check.Err = zip.ErrChecksum
+	}
+
+	return check
+}